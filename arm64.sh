@@ -1,2 +1,2 @@
-GOOS=linux GOARCH=arm64 go build -o spi-go-core-arm64 ./cmd/main.go
+GOOS=linux GOARCH=arm64 go build -o spi-go-core-arm64 ./cmd
 
@@ -0,0 +1,243 @@
+// Package client is a Go client for the SPI core API. It performs the
+// three-step RSA handshake, keeps the resulting session and transparently
+// re-handshakes when the server no longer accepts it.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// SessionHeader carries the session ID issued during the key exchange
+const SessionHeader = "X-Request-ID"
+
+// Client talks to a single SPI core server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	privateKey *rsa.PrivateKey
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for all requests, e.g. one with a custom TLS config
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithPrivateKey sets the RSA key the client identifies itself with during the handshake
+func WithPrivateKey(key *rsa.PrivateKey) Option {
+	return func(c *Client) {
+		c.privateKey = key
+	}
+}
+
+// New creates a client for the server at baseURL (e.g. "https://localhost:8443").
+// A fresh 2048-bit RSA key is generated unless WithPrivateKey is given.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.privateKey == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate client key: %w", err)
+		}
+		c.privateKey = key
+	}
+	return c, nil
+}
+
+// SessionID returns the current session ID, or an empty string before the first handshake
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// APIError is returned when the server answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("spi: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsUnauthorized reports whether err is an API error caused by a missing or expired session
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// Exec runs a whitelisted command synchronously and returns its output
+func (c *Client) Exec(ctx context.Context, command string) (string, error) {
+	var output string
+	err := c.call(ctx, http.MethodPost, "/api/exec", execRequest{Command: command}, &output)
+	return output, err
+}
+
+// ExecPlan is the server's answer to a plan-mode exec request
+type ExecPlan struct {
+	Command string   `json:"command"`
+	Argv    []string `json:"argv"`
+	Allowed bool     `json:"allowed"`
+	Reason  string   `json:"reason"`
+}
+
+// PlanExec asks whether command would pass policy and how it would be run, without running it
+func (c *Client) PlanExec(ctx context.Context, command string) (*ExecPlan, error) {
+	var plan ExecPlan
+	if err := c.call(ctx, http.MethodPost, "/api/exec", execRequest{Command: command, Plan: true}, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// call performs an authenticated JSON request, handshaking first if there is no
+// session and once more if the server rejects the current one
+func (c *Client) call(ctx context.Context, method, path string, in, out any) error {
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+// send performs an authenticated request and returns the successful response
+// with its body unread. Non-2xx responses are turned into an *APIError.
+func (c *Client) send(ctx context.Context, method, path string, in any) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		sessionID, err := c.ensureSession(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(ctx, method, path, sessionID, body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			// The session expired or was dropped by the server: start over once
+			resp.Body.Close()
+			c.resetSession(sessionID)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			defer resp.Body.Close()
+			return nil, readAPIError(resp)
+		}
+		return resp, nil
+	}
+}
+
+// do sends a single request without any retry logic
+func (c *Client) do(ctx context.Context, method, path, sessionID string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if sessionID != "" {
+		req.Header.Set(SessionHeader, sessionID)
+	}
+	// Continue the caller's trace, if ctx has one, on the server
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return c.httpClient.Do(req)
+}
+
+// ensureSession returns the current session, performing the handshake if there is none
+func (c *Client) ensureSession(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sessionID != "" {
+		return c.sessionID, nil
+	}
+	sessionID, err := c.handshake(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.sessionID = sessionID
+	return sessionID, nil
+}
+
+// resetSession forgets sessionID unless another goroutine already replaced it
+func (c *Client) resetSession(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessionID == sessionID {
+		c.sessionID = ""
+	}
+}
+
+// decodeResponse turns a response into out, or into an *APIError for non-2xx statuses
+func decodeResponse(resp *http.Response, out any) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return readAPIError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("spi: failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// readAPIError builds an *APIError from either a JSON error body or plain text
+func readAPIError(resp *http.Response) error {
+	raw, _ := io.ReadAll(resp.Body)
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(raw, &body) == nil && body.Message != "" {
+		apiErr.Message = body.Message
+	}
+	return apiErr
+}
+
+type execRequest struct {
+	Command string `json:"command"`
+	Plan    bool   `json:"plan,omitempty"`
+}
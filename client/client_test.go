@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spi-go-core/internal/testutil"
+)
+
+// newTestServer runs the real router with freshly generated server keys
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return testutil.NewHarness(t).Server
+}
+
+func TestHandshakeAndExec(t *testing.T) {
+	server := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := c.Handshake(ctx); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if c.SessionID() == "" {
+		t.Fatal("Expected a session ID after the handshake")
+	}
+
+	output, err := c.Exec(ctx, "pwd")
+	if err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if strings.TrimSpace(output) == "" {
+		t.Error("Expected output from pwd")
+	}
+
+	_, err = c.Exec(ctx, "rm")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 403 {
+		t.Errorf("Expected 403 for a command outside the allowlist, got %v", err)
+	}
+}
+
+func TestPlanExec(t *testing.T) {
+	server := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx := context.Background()
+	plan, err := c.PlanExec(ctx, "pwd -P")
+	if err != nil {
+		t.Fatalf("PlanExec failed: %v", err)
+	}
+	if !plan.Allowed || len(plan.Argv) != 2 || plan.Argv[1] != "-P" {
+		t.Errorf("Unexpected plan for an allowed command: %+v", plan)
+	}
+
+	plan, err = c.PlanExec(ctx, "rm -rf /")
+	if err != nil {
+		t.Fatalf("PlanExec failed: %v", err)
+	}
+	if plan.Allowed || plan.Reason == "" {
+		t.Errorf("Expected a denied plan with a reason: %+v", plan)
+	}
+}
+
+func TestReHandshakeOnExpiredSession(t *testing.T) {
+	server := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// Pretend we hold a session the server no longer knows about
+	c.sessionID = "expired-session"
+
+	if _, err := c.Exec(context.Background(), "pwd"); err != nil {
+		t.Fatalf("Exec should have re-handshaked, got: %v", err)
+	}
+	if c.SessionID() == "expired-session" || c.SessionID() == "" {
+		t.Errorf("Expected a fresh session, got %q", c.SessionID())
+	}
+}
+
+func TestJobStreaming(t *testing.T) {
+	server := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx := context.Background()
+	var lines []JobLine
+	job, err := c.RunJob(ctx, "pwd", func(line JobLine) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunJob failed: %v", err)
+	}
+	if job.Status != JobSucceeded {
+		t.Errorf("Expected job to succeed, got %s (%s)", job.Status, job.Error)
+	}
+	if len(lines) == 0 {
+		t.Error("Expected streamed output lines")
+	}
+
+	listed, err := c.Jobs(ctx)
+	if err != nil {
+		t.Fatalf("Jobs failed: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != job.ID {
+		t.Errorf("Expected the job to be listed, got %+v", listed)
+	}
+
+	if _, err := c.Job(ctx, "unknown"); err == nil {
+		t.Error("Expected an error for an unknown job")
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type keyExchangeRequest struct {
+	TSAppPublicKey string `json:"tsAppPublicKey"`
+}
+
+type keyExchangeResponse struct {
+	GoCorePublicKey string `json:"goCorePublicKey"`
+}
+
+type verificationMessage struct {
+	EncryptedResponse string `json:"encryptedResponse"`
+	OwnChallenge      string `json:"ownChallenge,omitempty"`
+}
+
+type finalizationRequest struct {
+	Secret string `json:"secret"`
+}
+
+// Handshake forces a new handshake and replaces the current session
+func (c *Client) Handshake(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sessionID, err := c.handshake(ctx)
+	if err != nil {
+		return err
+	}
+	c.sessionID = sessionID
+	return nil
+}
+
+// handshake runs key exchange, message verification and finalization and
+// returns the validated session ID. The caller must hold c.mu.
+func (c *Client) handshake(ctx context.Context) (string, error) {
+	// Step 1: exchange public keys and receive the session ID
+	publicKeyPEM, err := encodePublicKey(&c.privateKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	var exchange keyExchangeResponse
+	sessionID, err := c.handshakeStep(ctx, "/api/key-exchange", "", keyExchangeRequest{TSAppPublicKey: publicKeyPEM}, &exchange)
+	if err != nil {
+		return "", fmt.Errorf("spi: key exchange failed: %w", err)
+	}
+	if sessionID == "" {
+		return "", errors.New("spi: key exchange did not return a session ID")
+	}
+	serverKey, err := parsePublicKey(exchange.GoCorePublicKey)
+	if err != nil {
+		return "", fmt.Errorf("spi: invalid server public key: %w", err)
+	}
+
+	// Step 2: prove the server can decrypt our message and receive its challenge
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	probe := []byte(base64.RawURLEncoding.EncodeToString(nonce))
+	encryptedProbe, err := rsa.EncryptPKCS1v15(rand.Reader, serverKey, probe)
+	if err != nil {
+		return "", err
+	}
+	var verification verificationMessage
+	request := verificationMessage{EncryptedResponse: base64.StdEncoding.EncodeToString(encryptedProbe)}
+	if _, err := c.handshakeStep(ctx, "/api/verify-message", sessionID, request, &verification); err != nil {
+		return "", fmt.Errorf("spi: message verification failed: %w", err)
+	}
+	echoed, err := c.decrypt(verification.EncryptedResponse)
+	if err != nil {
+		return "", fmt.Errorf("spi: failed to decrypt verification response: %w", err)
+	}
+	if !bytes.Equal(echoed, probe) {
+		return "", errors.New("spi: server failed to echo the verification message")
+	}
+	challenge, err := c.decrypt(verification.OwnChallenge)
+	if err != nil {
+		return "", fmt.Errorf("spi: failed to decrypt server challenge: %w", err)
+	}
+
+	// Step 3: return the challenge encrypted for the server to finalize the session
+	encryptedSecret, err := rsa.EncryptPKCS1v15(rand.Reader, serverKey, challenge)
+	if err != nil {
+		return "", err
+	}
+	final := finalizationRequest{Secret: base64.StdEncoding.EncodeToString(encryptedSecret)}
+	if _, err := c.handshakeStep(ctx, "/api/handshake-success", sessionID, final, nil); err != nil {
+		return "", fmt.Errorf("spi: handshake finalization failed: %w", err)
+	}
+	return sessionID, nil
+}
+
+// handshakeStep posts one handshake message and returns the session header of the response
+func (c *Client) handshakeStep(ctx context.Context, path, sessionID string, in, out any) (string, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPost, path, sessionID, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := decodeResponse(resp, out); err != nil {
+		return "", err
+	}
+	return resp.Header.Get(SessionHeader), nil
+}
+
+// decrypt base64-decodes and decrypts a message addressed to the client key
+func (c *Client) decrypt(encoded string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptPKCS1v15(rand.Reader, c.privateKey, ciphertext)
+}
+
+// encodePublicKey returns the PKIX PEM encoding the server expects
+func encodePublicKey(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// parsePublicKey parses a PKIX PEM encoded RSA public key
+func parsePublicKey(pemKey string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("invalid public key type, expected RSA")
+	}
+	return rsaKey, nil
+}
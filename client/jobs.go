@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// JobStatus describes the lifecycle state of a job
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// Job is the server-side state of a background command
+type Job struct {
+	ID         string     `json:"id"`
+	Command    string     `json:"command"`
+	Status     JobStatus  `json:"status"`
+	ExitCode   int        `json:"exitCode"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Lines      int        `json:"lines"`
+}
+
+// Finished reports whether the job is no longer running
+func (j *Job) Finished() bool {
+	return j.Status != JobRunning
+}
+
+// JobLine is one line of job output
+type JobLine struct {
+	Seq    int    `json:"seq"`
+	Stream string `json:"stream"`
+	Text   string `json:"text"`
+	Level  string `json:"level"` // error, warn, progress, info or debug
+}
+
+type jobStreamEvent struct {
+	Line *JobLine `json:"line,omitempty"`
+	Done bool     `json:"done,omitempty"`
+	Job  *Job     `json:"job,omitempty"`
+}
+
+// StartJob starts a whitelisted command in the background
+func (c *Client) StartJob(ctx context.Context, command string) (*Job, error) {
+	var job Job
+	if err := c.call(ctx, http.MethodPost, "/api/jobs", execRequest{Command: command}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Jobs lists all jobs known to the server
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var jobs []Job
+	if err := c.call(ctx, http.MethodGet, "/api/jobs", nil, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Job fetches the current state of a job
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.call(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelJob stops a running job and returns its final state
+func (c *Client) CancelJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.call(ctx, http.MethodPost, "/api/jobs/"+url.PathEscape(id)+"/cancel", nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// StreamJob calls fn for every output line of the job, from the beginning,
+// until the job finishes, and returns the final job state. Returning an error
+// from fn stops the stream and is passed through.
+func (c *Client) StreamJob(ctx context.Context, id string, fn func(JobLine) error) (*Job, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id)+"/stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event jobStreamEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("spi: invalid stream event: %w", err)
+		}
+		if event.Done {
+			return event.Job, nil
+		}
+		if event.Line != nil && fn != nil {
+			if err := fn(*event.Line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("spi: job stream ended before the job finished")
+}
+
+// RunJob starts a job, streams its output to fn and returns the final state
+func (c *Client) RunJob(ctx context.Context, command string, fn func(JobLine) error) (*Job, error) {
+	job, err := c.StartJob(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	return c.StreamJob(ctx, job.ID, fn)
+}
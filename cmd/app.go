@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"spi-go-core/embedded"
+	"spi-go-core/handlers"
+	"spi-go-core/internal/bundle"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/nodejs"
+	"spi-go-core/internal/supervisor"
+	"time"
+)
+
+// appConnection is handed to the app on a private descriptor ($SPI_HANDOFF_FD)
+type appConnection struct {
+	Port int  `json:"port"`
+	TLS  bool `json:"tls"`
+	// CAFingerprint is the SHA-256 of the root of the server's certificate
+	// chain, which is the certificate itself when it is self-signed
+	CAFingerprint string `json:"ca_fingerprint,omitempty"`
+	// CorePublicKey is the PEM key the app encrypts the handshake for
+	CorePublicKey string `json:"core_public_key,omitempty"`
+}
+
+// newAppSupervisor builds the supervisor for the TypeScript app described by
+// cfg. The command is filled in by runApp once the app has been extracted.
+func newAppSupervisor(ex executor.Executor, cfg config.BundleConfig) (*supervisor.Supervisor, error) {
+	policy, err := supervisor.ParsePolicy(cfg.Restart)
+	if err != nil {
+		return nil, err
+	}
+	s := supervisor.New("app", ex, executor.Spec{})
+	s.Policy = policy
+	s.Readiness = supervisor.Readiness{
+		Pipe:      cfg.ReadyPipe,
+		HealthURL: cfg.HealthURL,
+		Timeout:   time.Duration(cfg.ReadyTimeout) * time.Second,
+	}
+	return s, nil
+}
+
+// connectionDetails encodes what the app needs to reach the core
+func connectionDetails(port int, cert *tls.Certificate, publicKeyPath string) ([]byte, error) {
+	details := appConnection{Port: port, TLS: cert != nil}
+	if cert != nil && len(cert.Certificate) > 0 {
+		sum := sha256.Sum256(cert.Certificate[len(cert.Certificate)-1])
+		details.CAFingerprint = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	// Without the key the app can still fetch it through the key exchange
+	if publicKey, err := encryption.GetGoCorePublicKeyPEM(publicKeyPath); err == nil {
+		details.CorePublicKey = publicKey
+	} else {
+		appLog.Warn("Core public key not handed to the app", "error", err)
+	}
+	return json.Marshal(details)
+}
+
+// runApp extracts the embedded TypeScript app, provisions Node.js for it and
+// keeps it running under s until ctx is canceled. A build without a bundled
+// app, or a nil provisioner as provisioning is off, returns nil right away, leaving
+// the core serving the API only. Setup progress is published to bus.
+func runApp(ctx context.Context, s *supervisor.Supervisor, cfg config.BundleConfig, provisioner *nodejs.Provisioner, bus *events.Bus) error {
+	cacheDir := cfg.CacheDir
+	if cacheDir == "" {
+		cacheDir = "app-cache"
+	}
+	entry := cfg.Entry
+	if entry == "" {
+		entry = "dist/index.js"
+	}
+
+	setup := func(step string, status events.Status, message string, err error) {
+		e := events.Event{Source: events.SourceRuntime, Task: "setup", Title: "app setup", Step: step, Status: status, Message: message}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		bus.Publish(e)
+	}
+	fail := func(step string, err error) error {
+		setup(step, events.StatusFailed, "", err)
+		s.Fail(err)
+		return err
+	}
+
+	// Step 1: Extract the TypeScript app
+	setupLog.Info("Extracting TypeScript app")
+	setup("extract app", events.StatusRunning, "", nil)
+	app, err := bundle.Extract(embedded.TypeScriptApp, cacheDir)
+	if errors.Is(err, bundle.ErrEmpty) {
+		setupLog.Info("No TypeScript app bundled in this build, serving the API only")
+		setup("extract app", events.StatusSkipped, "no TypeScript app bundled in this build", nil)
+		s.Disable("no TypeScript app bundled in this build")
+		return nil
+	}
+	if err != nil {
+		return fail("extract app", fmt.Errorf("failed to extract TypeScript app: %v", err))
+	}
+	setupLog.Info("TypeScript app extracted", "version", app.Version, "dir", app.Dir)
+	setup("extract app", events.StatusSucceeded, app.Version, nil)
+
+	// Step 2: Provision Node.js using EnvironmentSetupHandler
+	if provisioner == nil {
+		setupLog.Info("No Node.js manifest, serving the API only")
+		setup("provision Node.js", events.StatusSkipped, "no Node.js manifest", nil)
+		s.Disable("no Node.js manifest to provision the runtime from")
+		return nil
+	}
+	setup("provision Node.js", events.StatusRunning, "", nil)
+	logFile, err := logging.OpenFile("install.log", logging.CurrentRotation())
+	if err != nil {
+		return fail("provision Node.js", fmt.Errorf("failed to create log file: %v", err))
+	}
+	defer logFile.Close()
+
+	setupLog.Info("Starting environment setup")
+	rt, err := handlers.EnvironmentSetupHandler(ctx, provisioner, logFile)
+	if err != nil {
+		return fail("provision Node.js", fmt.Errorf("environment setup failed: %v", err))
+	}
+	setup("provision Node.js", events.StatusSucceeded, rt.Node(), nil)
+
+	// Step 3: Run the app under the supervisor, its output goes to the core's log
+	appLog.Info("Running TypeScript app")
+	s.Spec = executor.Spec{
+		Args: []string{rt.Node(), filepath.Join(app.Dir, entry)},
+		Env:  rt.Env(),
+		Dir:  app.Dir,
+	}
+	return s.Run(ctx)
+}
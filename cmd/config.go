@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"spi-go-core/internal/config"
+	"strings"
+	"text/tabwriter"
+)
+
+const configUsage = `Usage:
+  spi-go-core config validate [FILE] [FLAGS]     check the merged configuration and list every problem
+  spi-go-core config show [--effective] [--json] [FLAGS]
+                                                 print the merged configuration; --effective adds
+                                                 where each value came from
+  spi-go-core config schema                      print the JSON Schema of the config file
+
+The configuration is merged from built-in defaults, /etc/spi-go-core/config.{json,yaml},
+the --config file (./config.json when not given), SPI_* environment variables and flags
+such as --server.port=9443, each overriding the ones before.`
+
+// configFlags defines --config and one flag per config key on fs. The
+// returned function builds the resolve options once fs has been parsed.
+func configFlags(fs *flag.FlagSet) func() config.Options {
+	file := fs.String("config", "", "config file (JSON, or YAML by extension), ./config.json when not set")
+	values := config.BindFlags(fs)
+	return func() config.Options {
+		return config.Options{File: *file, Flags: values}
+	}
+}
+
+// runConfigCommand implements "spi-go-core config ..." and returns the process exit code
+func runConfigCommand(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, configUsage) }
+	options := configFlags(fs)
+	effective := fs.Bool("effective", false, "show the source of every value")
+	asJSON := fs.Bool("json", false, "print JSON")
+
+	switch args[0] {
+	case "validate":
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, configUsage)
+			return 2
+		}
+		opts := options()
+		if fs.NArg() == 1 {
+			opts.File = fs.Arg(0)
+		}
+		resolved, err := config.Resolve(opts)
+		if err == nil {
+			err = resolved.Config.Validate()
+		}
+		if err != nil {
+			var validationErr *config.ValidationError
+			if !errors.As(err, &validationErr) {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+			fmt.Fprintf(os.Stderr, "The configuration has %d problem(s):\n", len(validationErr.Problems))
+			for _, problem := range validationErr.Problems {
+				fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+			}
+			return 1
+		}
+		fmt.Printf("The configuration from %s is valid\n", describeFiles(resolved.Files))
+		return 0
+	case "show":
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, configUsage)
+			return 2
+		}
+		resolved, err := config.Resolve(options())
+		if err != nil {
+			logProblems(err)
+			return 1
+		}
+		printSettings(os.Stdout, resolved, *effective, *asJSON)
+		return 0
+	case "schema":
+		os.Stdout.Write(config.Schema)
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+}
+
+// printSettings writes the merged configuration, secrets redacted, as
+// "key = value" lines or JSON, optionally with the source of each value
+func printSettings(w io.Writer, resolved *config.Resolved, withSources, asJSON bool) {
+	settings := resolved.Effective()
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if withSources {
+			encoder.Encode(settings)
+			return
+		}
+		// Without sources print the same shape as a config file
+		sections := map[string]map[string]any{}
+		for _, setting := range settings {
+			section, key, _ := strings.Cut(setting.Key, ".")
+			if sections[section] == nil {
+				sections[section] = map[string]any{}
+			}
+			sections[section][key] = setting.Value
+		}
+		encoder.Encode(sections)
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if withSources {
+		fmt.Fprintf(tw, "# files: %s\n", describeFiles(resolved.Files))
+	}
+	for _, setting := range settings {
+		value := formatValue(setting.Value)
+		if withSources {
+			fmt.Fprintf(tw, "%s\t= %s\t# %s\n", setting.Key, value, setting.Source)
+		} else {
+			fmt.Fprintf(tw, "%s\t= %s\n", setting.Key, value)
+		}
+	}
+	tw.Flush()
+}
+
+// formatValue renders a config value as it would appear in JSON
+func formatValue(value any) string {
+	var buf strings.Builder
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSpace(buf.String())
+}
+
+// describeFiles names the config files a configuration was read from
+func describeFiles(files []string) string {
+	if len(files) == 0 {
+		return "defaults (no config file)"
+	}
+	return strings.Join(files, ", ")
+}
+
+// logProblems logs each problem of a validation error on its own line
+func logProblems(err error) {
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		configLog.Error("Invalid configuration", "error", err)
+		return
+	}
+	for _, problem := range validationErr.Problems {
+		configLog.Error("Invalid configuration", "problem", problem)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/health"
+	"text/tabwriter"
+	"time"
+)
+
+const doctorUsage = `Usage:
+  spi-go-core doctor [--json] [FLAGS]   check the keys, the configuration, the server
+                                        certificate and the writable directories without
+                                        starting the server; exits 1 if a check fails
+
+The configuration is merged as for the server, see "spi-go-core config".`
+
+// runDoctorCommand implements "spi-go-core doctor" and returns the process exit code
+func runDoctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, doctorUsage) }
+	options := configFlags(fs)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, doctorUsage)
+		return 2
+	}
+
+	var checks []health.Check
+	resolved, err := config.Resolve(options())
+	if err != nil {
+		// Without a configuration there is nothing else to check
+		checks = []health.Check{{Name: "config", Status: health.StatusFail, Detail: err.Error()}}
+	} else {
+		checks = health.Offline(resolved.Config, time.Now())
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(checks)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, check := range checks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", check.Name, check.Status, check.Detail)
+		}
+		tw.Flush()
+	}
+	if !health.Passed(checks) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"spi-go-core/internal/facts"
+)
+
+// runFactsCommand implements "spi-go-core facts [--root DIR]" and returns the process exit code
+func runFactsCommand(args []string) int {
+	flags := flag.NewFlagSet("facts", flag.ContinueOnError)
+	root := flags.String("root", "/", "filesystem root facts are read from")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: spi-go-core facts [--root DIR]")
+		return 2
+	}
+
+	hostFacts, err := facts.NewCollector(*root).Collect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to collect facts: %v\n", err)
+		return 1
+	}
+	printJSON(hostFacts)
+	return 0
+}
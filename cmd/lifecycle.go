@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"spi-go-core/internal/audit"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/health"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/metrics"
+	"spi-go-core/internal/output"
+	"spi-go-core/internal/profiles"
+	"spi-go-core/internal/supervisor"
+	"spi-go-core/internal/tracing"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Process exit codes of the server
+const (
+	exitOK     = 0
+	exitFailed = 1 // startup failed or the server stopped on an error
+	exitConfig = 2 // the configuration could not be loaded
+	exitForced = 3 // work still running at the shutdown deadline was cut off
+)
+
+// defaultShutdownTimeout applies when shutdown.timeout_seconds is not set
+const defaultShutdownTimeout = 30 * time.Second
+
+// configWatchInterval is how often the config files are checked for changes
+const configWatchInterval = 2 * time.Second
+
+// fatalf logs and exits with code
+func fatalf(code int, format string, args ...any) {
+	serverLog.Error(fmt.Sprintf(format, args...))
+	logging.Close()
+	os.Exit(code)
+}
+
+// certStore hands out the server certificate through tls.Config.GetCertificate,
+// so a reload applies to new handshakes without dropping open connections
+type certStore struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// load replaces the certificate with the key pair in certFile and keyFile
+func (c *certStore) load(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// current returns the certificate in use
+func (c *certStore) current() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert
+}
+
+func (c *certStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current(), nil
+}
+
+// lifecycle owns everything that has to be reloaded or stopped on shutdown
+type lifecycle struct {
+	config  *config.Store
+	port    int
+	server  *http.Server
+	certs   *certStore // nil without TLS
+	jobs    *jobs.Manager
+	runner  *profiles.Runner
+	app     *supervisor.Supervisor
+	stopApp context.CancelFunc
+	appDone <-chan struct{}
+	audit   *audit.Log
+	events  *events.Bus
+	stopUI  func()       // nil without the UI
+	metrics *http.Server // nil without metrics.listen
+}
+
+// applyConfig puts what can change at runtime into effect before next is
+// swapped in: the command allowlist, the server certificate, the shutdown
+// settings, the verbosity and the span exporter. An error keeps the running configuration.
+func (l *lifecycle) applyConfig(old, next *config.AppConfig) error {
+	if l.certs != nil && next.Server.TLSEnabled {
+		if err := l.certs.load(next.Server.CertFile, next.Server.KeyFile); err != nil {
+			return err
+		}
+	}
+	if next.Server.Port != old.Server.Port || next.Server.TLSEnabled != old.Server.TLSEnabled {
+		configLog.Warn("Changes to server.port and server.tls_enabled take effect after a restart")
+	}
+	if next.Metrics != old.Metrics {
+		configLog.Warn("Changes to metrics.listen and metrics.token take effect after a restart")
+	}
+	// The app picks up a new fingerprint or core key the next time it starts
+	var cert *tls.Certificate
+	if l.certs != nil {
+		cert = l.certs.current()
+	}
+	if details, err := connectionDetails(l.port, cert, next.Encryption.PublicKey); err == nil {
+		l.app.SetHandoff(details)
+	}
+	if err := logging.Configure(next.Logging); err != nil {
+		return err
+	}
+	if next.Tracing != old.Tracing {
+		if err := tracing.Configure(next.Tracing, health.BuildVersion()); err != nil {
+			return err
+		}
+	}
+	output.SetVerbosity(next.Logging.Verbosity)
+	return nil
+}
+
+// reported logs and audits the outcome of a reload
+func (l *lifecycle) reported(trigger string, err error) {
+	if err != nil {
+		logProblems(err)
+		configLog.Error("Reload failed, keeping the running configuration", "trigger", trigger)
+		metrics.ConfigReloads.Inc("failed")
+		l.audit.Record(audit.Event{Action: "reload", Detail: trigger, Error: err.Error()})
+		l.events.Publish(events.Event{Source: events.SourceConfig, Task: "reload", Title: "configuration reload", Status: events.StatusFailed,
+			Message: trigger, Error: err.Error()})
+		return
+	}
+	status := l.config.Status()
+	configLog.Info("Configuration reloaded", "trigger", trigger, "generation", status.Generation)
+	metrics.ConfigReloads.Inc("succeeded")
+	l.events.Publish(events.Event{Source: events.SourceConfig, Task: "reload", Title: "configuration reload", Status: events.StatusSucceeded,
+		Message: fmt.Sprintf("%s, generation %d", trigger, status.Generation)})
+	l.audit.Record(audit.Event{Action: "reload", Detail: trigger + ": " + describeFiles(status.Files)})
+}
+
+// shutdown stops accepting new work, drains or cancels jobs and profile runs,
+// stops the app and the server, and flushes the audit log, all within the
+// configured deadline. sig is nil when the server itself failed. It returns
+// the process exit code.
+func (l *lifecycle) shutdown(sig os.Signal, code int) int {
+	cfg := l.config.Current()
+	timeout := time.Duration(cfg.Shutdown.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Give the terminal back first so the shutdown can be followed
+	if l.stopUI != nil {
+		l.stopUI()
+	}
+
+	reason := "server failed"
+	if sig != nil {
+		reason = sig.String()
+	}
+	serverLog.Info("Shutting down", "reason", reason, "deadline", timeout)
+	l.audit.Record(audit.Event{Action: "shutdown", Detail: reason})
+
+	// Step 1: Stop accepting connections; in-flight requests may finish
+	l.server.SetKeepAlivesEnabled(false)
+	serverDone := make(chan error, 1)
+	go func() { serverDone <- l.server.Shutdown(ctx) }()
+
+	// Step 2: Refuse new jobs and runs, then drain or cancel the running ones
+	drain := cfg.Shutdown.DrainJobs
+	if err := l.jobs.Shutdown(ctx, drain); err != nil {
+		serverLog.Warn("Jobs still running at the deadline were canceled")
+		code = max(code, exitForced)
+	}
+	if err := l.runner.Shutdown(ctx, drain); err != nil {
+		serverLog.Warn("A profile run still in progress at the deadline was canceled")
+		code = max(code, exitForced)
+	}
+
+	// Step 3: Stop the app, forwarding the signal we received
+	if sig == nil {
+		sig = syscall.SIGTERM
+	}
+	l.app.Stop(sig)
+	l.stopApp()
+	select {
+	case <-l.appDone:
+	case <-ctx.Done():
+		serverLog.Warn("App setup did not finish before the deadline")
+		code = max(code, exitForced)
+	}
+
+	// Step 4: Wait for the remaining requests, closing them at the deadline
+	if err := <-serverDone; err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			serverLog.Warn("Closing connections still open at the deadline")
+			code = max(code, exitForced)
+		}
+		l.server.Close()
+	}
+	if l.metrics != nil {
+		l.metrics.Close()
+	}
+
+	if err := tracing.Shutdown(ctx); err != nil {
+		serverLog.Warn("Failed to export the remaining spans", "error", err)
+	}
+
+	// Step 5: Flush the audit trail last so it includes everything above
+	l.audit.Record(audit.Event{Action: "shutdown", Detail: "complete", ExitCode: audit.Int(code)})
+	if err := l.audit.Close(); err != nil {
+		serverLog.Error("Failed to flush audit log", "error", err)
+	}
+	serverLog.Info("Shutdown complete", "exit_code", code)
+	logging.Close()
+	return code
+}
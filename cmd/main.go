@@ -2,169 +2,301 @@
 package main
 
 import (
-	"archive/tar"
-	"bytes"
-	"compress/gzip"
+	"context"
 	"crypto/tls"
-	_ "embed"
-	"io/ioutil"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"spi-go-core/handlers"
+	"os/signal"
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/audit"
 	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/health"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/output"
+	"spi-go-core/internal/profiles"
+	"spi-go-core/internal/tracing"
 	"spi-go-core/internal/ui"
 	"spi-go-core/routes"
+	"syscall"
 )
 
-// go:embed embedded/typescript-app.tar.gz
-var tsAppCompressed []byte
+// Component logs of the core
+var (
+	serverLog = logging.For(logging.Server)
+	configLog = logging.For(logging.Config)
+	setupLog  = logging.For(logging.Setup)
+	appLog    = logging.For(logging.App)
+	uiLog     = logging.For(logging.UI)
+)
 
-// Extracts the TypeScript project to a temporary directory
-func extractTSApp() (string, error) {
-	tempDir, err := os.MkdirTemp("", "typescript-app")
-	if err != nil {
-		return "", err
+func main() {
+	// Subcommands run without starting the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "profile":
+			os.Exit(runProfileCommand(os.Args[2:]))
+		case "facts":
+			os.Exit(runFactsCommand(os.Args[2:]))
+		case "node":
+			os.Exit(runNodeCommand(os.Args[2:]))
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctorCommand(os.Args[2:]))
+		}
 	}
 
-	gzipReader, err := gzip.NewReader(bytes.NewReader(tsAppCompressed))
+	// Defaults, config files, SPI_* environment variables and flags are merged
+	fs := flag.NewFlagSet("spi-go-core", flag.ExitOnError)
+	options := configFlags(fs)
+	fs.Parse(os.Args[1:])
+	configOptions := options()
+
+	resolved, err := config.Resolve(configOptions)
 	if err != nil {
-		return "", err
+		logProblems(err)
+		fatalf(exitConfig, "Failed to load configuration")
+	}
+	cfg := resolved.Config
+	// Report every problem before anything starts listening
+	if err := cfg.Validate(); err != nil {
+		logProblems(err)
+		fatalf(exitConfig, "Invalid configuration (check with \"spi-go-core config validate\")")
+	}
+	// Logging follows the configuration from here on, reloads configure it again
+	if err := logging.Configure(cfg.Logging); err != nil {
+		fatalf(exitConfig, "Failed to configure logging: %v", err)
 	}
-	defer gzipReader.Close()
+	if err := tracing.Configure(cfg.Tracing, health.BuildVersion()); err != nil {
+		fatalf(exitConfig, "Failed to configure tracing: %v", err)
+	}
+	configLog.Info("Loaded configuration", "files", describeFiles(resolved.Files))
+	// Subprocess output is shown in the log, on the terminal and in the UI as logging.verbosity allows
+	output.SetVerbosity(cfg.Logging.Verbosity)
+	// Reloads resolve the same layers again and swap the result in atomically
+	configStore := config.NewStore(resolved, func() (*config.Resolved, error) {
+		return config.Resolve(configOptions)
+	})
 
-	tarReader := tar.NewReader(gzipReader)
-	for {
-		header, err := tarReader.Next()
-		if err != nil {
-			break
-		}
+	// All subprocesses (commands, jobs, profile runs, the app) share one
+	// executor, which traces them under the request or job that started them
+	procExecutor := executor.Traced(executor.NewOS())
 
-		filePath := filepath.Join(tempDir, header.Name)
-		if header.Typeflag == tar.TypeDir {
-			os.MkdirAll(filePath, 0755)
-		} else if header.Typeflag == tar.TypeReg {
-			file, err := os.Create(filePath)
-			if err != nil {
-				return "", err
-			}
-			_, err = ioutil.ReadAll(tarReader)
-			file.Close()
-		}
+	// The TypeScript app runs on a pinned Node.js runtime. Without a manifest
+	// nothing is provisioned and the core serves the API only.
+	nodeProvisioner, err := newNodeProvisioner(cfg.Runtime)
+	if errors.Is(err, os.ErrNotExist) {
+		setupLog.Warn("Node.js runtime provisioning is off, the TypeScript app will not be started", "error", err)
+	} else if err != nil {
+		fatalf(exitConfig, "Failed to configure Node.js runtime: %v", err)
 	}
-	return tempDir, nil
-}
 
-// Runs the TypeScript project as a subprocess
-func runTSApp(tsAppDir string) error {
-	cmd := exec.Command("node", filepath.Join(tsAppDir, "dist/index.js"))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
+	// Jobs, profile runs, the app and the server itself report progress here
+	bus := events.New()
 
-func main() {
-	// Load the configuration file
-	// Get the absolute path of the root directory
-	rootDir, err := os.Getwd() // Get the current working directory
-	if err != nil {
-		log.Fatalf("Failed to get working directory: %v", err)
-	}
-	// Check if config file exists
-	configPath := filepath.Join(rootDir, "config.json") // Assuming it's in the root directory
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatalf("Config file does not exist: %v", err)
-	} else {
-		log.Println("Config file found")
+	// Work the approval policy names waits here for the operator on the UI
+	approvals := approval.NewGate()
+	approvals.Events = bus
+
+	// The handlers check commands against the running configuration
+	if !cfg.Commands.ExecEnabled() {
+		serverLog.Info("Command execution is disabled")
 	}
 
-	cfg, err := config.LoadAppConfig(configPath)
+	// Open the profile store
+	profilesDir := cfg.Profiles.Dir
+	if profilesDir == "" {
+		profilesDir = "profiles"
+	}
+	profileStore, err := profiles.NewStore(profilesDir)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
-	} else {
-		log.Printf("Loaded configuration from %s", configPath)
-		log.Printf("Private key: %s", config.GlobalConfig.Encryption.PrivateKey)
-		log.Printf("Public key: %s", config.GlobalConfig.Encryption.PublicKey)
+		fatalf(exitFailed, "Failed to open profile store: %v", err)
 	}
 
-	// Start the UI when setting up the environment
-	if cfg.UI.Enabled {
-		log.Println("Starting UI..")
-		ui.StartUI()
+	// Host facts are read below the configured root ("/" unless testing against a fixture)
+	factsCollector := facts.NewCollector(cfg.Facts.Root)
+
+	// The TypeScript app is supervised once the server is listening
+	appSupervisor, err := newAppSupervisor(procExecutor, cfg.App)
+	if err != nil {
+		fatalf(exitConfig, "Invalid app configuration: %v", err)
 	}
 
-	// Check if encryption is enabled or disabled
-	if cfg.Encryption.Enabled {
-		log.Println("Encryption is enabled.")
-		// Add your encryption logic here
-	} else {
-		log.Println("Encryption is disabled for testing purposes.")
-		// Skip encryption for testing purposes
+	// Commands, jobs, profile runs and lifecycle events go to the audit log
+	auditPath := cfg.Audit.File
+	if auditPath == "" {
+		auditPath = "audit.log"
+	}
+	auditLog, err := audit.Open(auditPath)
+	if err != nil {
+		fatalf(exitConfig, "Failed to open audit log: %v", err)
 	}
+	approvals.Audit = auditLog
 
-	// Set allowed commands in handlers
-	handlers.SetAllowedCommands(cfg.Commands.Allowed)
+	appSupervisor.Events = bus
+	jobManager := jobs.NewManager(procExecutor)
+	jobManager.Events = bus
+	profileRunner := profiles.NewRunner(&profiles.Host{Executor: procExecutor, Root: "/", Facts: factsCollector})
+	profileRunner.Events = bus
+	profileRunner.LogOutput = true
+	sessions := encryption.NewSessionStore(encryption.DefaultSessionTTL)
+	registerGauges(sessions, jobManager)
 
-	// Register the routes
-	router := routes.NewRouter()
+	// The UI shows the bus and the services next to the running server instead
+	// of blocking it; without a terminal progress is printed as lines or JSON
+	var dashboard ui.Renderer
+	if cfg.UI.Enabled {
+		dashboard, err = ui.NewRenderer(cfg.UI.Renderer, cfg.UI, ui.Dependencies{
+			Events:    bus,
+			Approvals: approvals,
+			Jobs:      jobManager,
+			Sessions:  sessions,
+			Facts:     factsCollector,
+			Config:    configStore,
+			Audit:     auditLog,
+		}, os.Stdout)
+		if err != nil {
+			fatalf(exitConfig, "Failed to start UI: %v", err)
+		}
+	}
+
+	// Register the routes on the services above
+	router := routes.NewRouter(routes.Dependencies{
+		Jobs:          jobManager,
+		Profiles:      profileStore,
+		ProfileRunner: profileRunner,
+		Facts:         factsCollector,
+		Supervisor:    appSupervisor,
+		Config:        configStore,
+		Sessions:      sessions,
+		Approvals:     approvals,
+		Executor:      procExecutor,
+		Audit:         auditLog,
+	})
 	router.RegisterRoutes()
 
 	// Server configuration based on TLS settings
+	port := cfg.Server.Port
+	if port == 0 {
+		port = 8443
+	}
 	server := &http.Server{
-		Addr:    ":8443",
-		Handler: nil, // Uses the default HTTP handler
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: router.Handler(),
 	}
-
+	var certs *certStore
+	var serverCert *tls.Certificate
 	if cfg.Server.TLSEnabled {
-		// Load server certificate and private key for TLS
-		cert, err := tls.LoadX509KeyPair(cfg.Server.CertFile, cfg.Server.KeyFile)
-		if err != nil {
-			log.Fatalf("Failed to load server certificates: %v", err)
+		// Load server certificate and private key for TLS, reloaded on SIGHUP
+		certs = &certStore{}
+		if err := certs.load(cfg.Server.CertFile, cfg.Server.KeyFile); err != nil {
+			fatalf(exitConfig, "Failed to load server certificates: %v", err)
 		}
-
-		// Start HTTPS server with TLS
-		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
-		log.Println("Starting secure server on https://localhost:", cfg.Server.Port)
-		err = server.ListenAndServeTLS("", "")
-	} else {
-		// Start HTTP server without TLS
-		log.Println("Starting server on http://localhost:", cfg.Server.Port)
-		err = server.ListenAndServe()
+		serverCert = certs.current()
+		server.TLSConfig = &tls.Config{GetCertificate: certs.getCertificate}
 	}
 
+	// The app learns how to reach the server on a private descriptor, not its argv
+	appSupervisor.Handoff, err = connectionDetails(port, serverCert, cfg.Encryption.PublicKey)
 	if err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		fatalf(exitFailed, "Failed to prepare app connection details: %v", err)
 	}
 
-	// Log file for environment setup
-	logFile, err := os.OpenFile("install.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// Listen before starting the app so it can connect as soon as it runs
+	listener, err := net.Listen("tcp", server.Addr)
 	if err != nil {
-		log.Fatalf("Failed to create log file: %v", err)
+		fatalf(exitFailed, "Failed to start server: %v", err)
 	}
-	defer logFile.Close()
-
-	// Step 1: Install Node.js using EnvironmentSetupHandler
-	log.Println("Starting environment setup...")
-	err = handlers.EnvironmentSetupHandler(logFile)
+	// Changes to metrics.listen and metrics.token take effect after a restart
+	metricsServer, err := serveMetrics(cfg.Metrics)
 	if err != nil {
-		log.Fatalf("Environment setup failed: %v", err)
+		fatalf(exitFailed, "Failed to serve metrics: %v", err)
 	}
 
-	// Step 2: Extract the TypeScript app
-	log.Println("Extracting TypeScript app...")
-	tsAppDir, err := extractTSApp()
-	if err != nil {
-		log.Fatalf("Failed to extract TypeScript app: %v", err)
+	// Reloads triggered by SIGHUP, a file change or POST /api/admin/reload go through lc
+	lc := &lifecycle{
+		config:  configStore,
+		port:    port,
+		server:  server,
+		certs:   certs,
+		jobs:    jobManager,
+		runner:  profileRunner,
+		app:     appSupervisor,
+		audit:   auditLog,
+		events:  bus,
+		metrics: metricsServer,
 	}
+	configStore.Apply = lc.applyConfig
+	configStore.Reported = lc.reported
 
-	// Step 3: Run the TypeScript app as a subprocess
-	log.Println("Running TypeScript app...")
-	err = runTSApp(tsAppDir)
-	if err != nil {
-		log.Fatalf("Failed to run TypeScript app: %v", err)
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.Server.TLSEnabled {
+			serverLog.Info("Starting secure server", "url", fmt.Sprintf("https://localhost:%d", port))
+			serveErr <- server.ServeTLS(listener, "", "")
+		} else {
+			serverLog.Info("Starting server", "url", fmt.Sprintf("http://localhost:%d", port))
+			serveErr <- server.Serve(listener)
+		}
+	}()
+	bus.Publish(events.Event{Source: events.SourceServer, Task: "server", Title: "server", Status: events.StatusSucceeded, Message: fmt.Sprintf("listening on port %d", port)})
+
+	if dashboard != nil {
+		uiCtx, stopUI := context.WithCancel(context.Background())
+		uiDone := make(chan struct{})
+		go func() {
+			defer close(uiDone)
+			if err := dashboard.Run(uiCtx); err != nil {
+				uiLog.Error("UI stopped", "error", err)
+			}
+		}()
+		lc.stopUI = func() {
+			stopUI()
+			<-uiDone
+		}
 	}
 
-	log.Println("Process completed successfully.")
+	// SIGINT and SIGTERM shut down gracefully, SIGHUP reloads the configuration
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	ctx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	appDone := make(chan struct{})
+	go func() {
+		defer close(appDone)
+		if err := runApp(ctx, appSupervisor, cfg.App, nodeProvisioner, bus); err != nil {
+			appLog.Error("TypeScript app is not running", "error", err)
+		}
+	}()
+
+	lc.stopApp, lc.appDone = stopApp, appDone
+
+	// Edits to any config file are picked up without a signal
+	go config.Watch(ctx, configOptions.Paths(), configWatchInterval, func() {
+		configStore.Reload("file change")
+	})
+
+	for {
+		select {
+		case err := <-serveErr:
+			serverLog.Error("Server failed", "error", err)
+			os.Exit(lc.shutdown(nil, exitFailed))
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				configStore.Reload("SIGHUP")
+				continue
+			}
+			os.Exit(lc.shutdown(sig, exitOK))
+		}
+	}
 }
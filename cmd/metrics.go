@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/metrics"
+)
+
+// registerGauges adds the metrics read from the state of the running services
+func registerGauges(sessions *encryption.SessionStore, jobManager *jobs.Manager) {
+	metrics.Default.NewGaugeFunc("spi_sessions_active", "Sessions that have not expired, validated or not.", func() float64 {
+		return float64(len(sessions.List()))
+	})
+	metrics.Default.NewGaugeFunc("spi_job_queue_depth", "Jobs awaiting approval or running.", func() float64 {
+		depth := 0
+		for _, job := range jobManager.List() {
+			if job.Status == jobs.StatusAwaitingApproval || job.Status == jobs.StatusRunning {
+				depth++
+			}
+		}
+		return float64(depth)
+	})
+}
+
+// serveMetrics serves /metrics on its own listener, so it can stay on loopback
+// or behind its own token while the API is reachable from elsewhere. It
+// returns nil when metrics.listen is empty.
+func serveMetrics(cfg config.MetricsConfig) (*http.Server, error) {
+	if cfg.Listen == "" {
+		return nil, nil
+	}
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Default.Handler(cfg.Token))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			serverLog.Error("Metrics server failed", "error", err)
+		}
+	}()
+	serverLog.Info("Serving metrics", "url", "http://"+listener.Addr().String()+"/metrics")
+	return server, nil
+}
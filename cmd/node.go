@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/nodejs"
+)
+
+const nodeUsage = `Usage:
+  spi-go-core node pin --version vX.Y.Z [--out node-manifest.json] SHASUMS256.txt
+  spi-go-core node install [--manifest FILE] [--prefix DIR] [--offline]`
+
+// newNodeProvisioner builds the Node.js provisioner described by cfg, filling in defaults
+func newNodeProvisioner(cfg config.RuntimeConfig) (*nodejs.Provisioner, error) {
+	manifestPath := cfg.Manifest
+	if manifestPath == "" {
+		manifestPath = "node-manifest.json"
+	}
+	manifest, err := nodejs.LoadManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w (create it with \"spi-go-core node pin\")", err)
+	}
+
+	p := &nodejs.Provisioner{
+		Manifest:   manifest,
+		Prefix:     cfg.Prefix,
+		BaseURL:    cfg.BaseURL,
+		OfflineDir: cfg.OfflineDir,
+		Offline:    cfg.Offline,
+	}
+	if p.Prefix == "" {
+		p.Prefix = "runtime"
+	}
+	// Tarballs shipped next to the binary are used without downloading
+	if p.OfflineDir == "" {
+		if executable, err := os.Executable(); err == nil {
+			p.OfflineDir = filepath.Dir(executable)
+		}
+	}
+	return p, nil
+}
+
+// runNodeCommand implements "spi-go-core node ..." and returns the process exit code
+func runNodeCommand(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, nodeUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "pin":
+		flags := flag.NewFlagSet("node pin", flag.ContinueOnError)
+		version := flags.String("version", "", "Node.js version the SHASUMS256.txt belongs to, e.g. v20.18.1")
+		out := flags.String("out", "node-manifest.json", "manifest file to write")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 || *version == "" {
+			fmt.Fprintln(os.Stderr, nodeUsage)
+			return 2
+		}
+
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open checksums: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		manifest, err := nodejs.PinFromSHASUMS(*version, file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to pin Node.js %s: %v\n", *version, err)
+			return 1
+		}
+		if err := manifest.Save(*out); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write manifest: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Pinned Node.js %s for %d architectures in %s\n", manifest.Version, len(manifest.Tarballs), *out)
+		return 0
+
+	case "install":
+		flags := flag.NewFlagSet("node install", flag.ContinueOnError)
+		cfg := config.RuntimeConfig{}
+		flags.StringVar(&cfg.Manifest, "manifest", "node-manifest.json", "pinned manifest")
+		flags.StringVar(&cfg.Prefix, "prefix", "runtime", "directory runtimes are unpacked to")
+		flags.StringVar(&cfg.OfflineDir, "offline-dir", "", "directory with bundled tarballs (default: next to the binary)")
+		flags.BoolVar(&cfg.Offline, "offline", false, "only use bundled tarballs")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, nodeUsage)
+			return 2
+		}
+
+		p, err := newNodeProvisioner(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		rt, err := p.Ensure(context.Background(), func(line string) { fmt.Println(line) })
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to provision Node.js: %v\n", err)
+			return 1
+		}
+		fmt.Println(rt.Node())
+		return 0
+
+	default:
+		fmt.Fprintln(os.Stderr, nodeUsage)
+		return 2
+	}
+}
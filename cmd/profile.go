@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/output"
+	"spi-go-core/internal/profiles"
+	"spi-go-core/internal/ui"
+)
+
+const profileUsage = `Usage: spi-go-core profile <validate|plan|apply> [--root DIR] [--json] [--tui] [--renderer auto|tui|plain|json] [--verbosity quiet|normal|verbose|debug] <profile.yaml|profile.json>`
+
+// runProfileCommand implements "spi-go-core profile ..." and returns the process exit code
+func runProfileCommand(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, profileUsage)
+		return 2
+	}
+	action := args[0]
+
+	flags := flag.NewFlagSet("profile "+action, flag.ContinueOnError)
+	root := flags.String("root", "/", "filesystem root that file steps are applied below")
+	asJSON := flags.Bool("json", false, "print the plan or run result as JSON")
+	inTUI := flags.Bool("tui", false, "show the plan in the terminal UI")
+	verbosity := flags.String("verbosity", "normal", "how much command output apply shows: quiet, normal, verbose or debug")
+	renderer := flags.String("renderer", "", "how apply shows progress: auto (default), tui, plain or json; none with --json")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, profileUsage)
+		return 2
+	}
+
+	if !slices.Contains(config.Verbosities, *verbosity) {
+		fmt.Fprintln(os.Stderr, profileUsage)
+		return 2
+	}
+	output.SetVerbosity(*verbosity)
+
+	profile, err := profiles.LoadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid profile %s:\n%v\n", flags.Arg(0), err)
+		return 1
+	}
+
+	runner := profiles.NewRunner(&profiles.Host{Executor: executor.NewOS(), Root: *root})
+	ctx := context.Background()
+
+	switch action {
+	case "validate":
+		fmt.Printf("Profile %s is valid (%d steps)\n", profile.Name, len(profile.Steps))
+		return 0
+
+	case "plan":
+		plan := runner.Plan(ctx, profile)
+		switch {
+		case *asJSON:
+			printJSON(plan)
+		case *inTUI:
+			if err := ui.ShowPlan(plan); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to run UI: %v\n", err)
+				return 1
+			}
+		default:
+			printPlan(plan)
+		}
+		if plan.Errors > 0 {
+			return 1
+		}
+		return 0
+
+	case "apply":
+		mode := *renderer
+		// Like the server, show the dashboard on a terminal and plain lines otherwise
+		if mode == "" && !*asJSON {
+			mode = ui.RendererAuto
+		}
+		stopProgress := func() {}
+		if mode != "" {
+			bus := events.New()
+			runner.Events = bus
+			progress, err := ui.NewRenderer(mode, config.UI{}, ui.Dependencies{Events: bus}, os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+			stopProgress = showProgress(progress)
+		}
+		run, err := runner.Apply(ctx, profile, nil)
+		stopProgress()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to apply profile: %v\n", err)
+			return 1
+		}
+		switch {
+		case *asJSON:
+			printJSON(run)
+		case mode != ui.RendererJSON:
+			printRun(run)
+		}
+		if run.Status != profiles.RunSucceeded {
+			return 1
+		}
+		return 0
+
+	default:
+		fmt.Fprintln(os.Stderr, profileUsage)
+		return 2
+	}
+}
+
+// showProgress runs progress until the returned function is called, which
+// waits for it to print what was published before
+func showProgress(progress ui.Renderer) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := progress.Run(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to show progress: %v\n", err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// printPlan writes a human-readable plan: "~" marks steps that would change,
+// "!" steps that could not be checked and "-" steps that do not apply to the host
+func printPlan(plan profiles.Plan) {
+	for _, step := range plan.Steps {
+		marker := " "
+		switch {
+		case step.Error != "":
+			marker = "!"
+		case step.Skipped != "":
+			marker = "-"
+		case step.Changes:
+			marker = "~"
+		}
+		fmt.Printf("%s %-8s %s\n", marker, step.Type, step.Name)
+		if step.Error != "" {
+			fmt.Printf("      check failed: %s\n", step.Error)
+			continue
+		}
+		if step.Skipped != "" {
+			fmt.Printf("      skipped: %s\n", step.Skipped)
+			continue
+		}
+		fmt.Printf("      current: %s\n", step.Current)
+		fmt.Printf("      desired: %s\n", step.Desired)
+		for _, command := range step.Commands {
+			fmt.Printf("      would run: %s\n", command)
+		}
+	}
+	fmt.Printf("\n%d of %d steps would change the host, %d could not be checked\n", plan.Changes, len(plan.Steps), plan.Errors)
+}
+
+// printRun writes the final status of every step
+func printRun(run profiles.Run) {
+	for _, step := range run.Steps {
+		fmt.Printf("%-8s %-8s %s", step.Status, step.Type, step.Name)
+		if step.Error != "" {
+			fmt.Printf(": %s", step.Error)
+		} else if step.Skipped != "" {
+			fmt.Printf(" (%s)", step.Skipped)
+		}
+		fmt.Println()
+	}
+}
+
+// printJSON writes v as indented JSON to stdout
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
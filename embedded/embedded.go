@@ -0,0 +1,10 @@
+// Package embedded holds the build artifacts compiled into the binary
+package embedded
+
+import _ "embed"
+
+// TypeScriptApp is the gzipped tarball of the TypeScript app, with
+// dist/index.js as its entry point. It is empty in development builds.
+//
+//go:embed typescript-app.tar.gz
+var TypeScriptApp []byte
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"spi-go-core/helpers"
+	"spi-go-core/internal/config"
+)
+
+// ConfigHandler reloads the running configuration on request
+type ConfigHandler struct {
+	Store *config.Store
+}
+
+// ReloadResponse reports the outcome of an admin reload
+type ReloadResponse struct {
+	Reloaded bool                `json:"reloaded"`
+	Status   config.ReloadStatus `json:"status"`
+}
+
+// HandleReload resolves, validates and applies the configuration again. On
+// failure the old configuration keeps running and the problems are returned.
+func (h *ConfigHandler) HandleReload(w http.ResponseWriter, r *http.Request) {
+	if h.Store == nil {
+		helpers.JSONError(w, "Reloading is not available", http.StatusNotFound)
+		return
+	}
+	err := h.Store.Reload("admin")
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(ReloadResponse{Reloaded: err == nil, Status: h.Store.Status()})
+}
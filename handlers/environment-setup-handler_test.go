@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spi-go-core/internal/nodejs"
+)
+
+// testProvisioner provisions from a bundled tarball containing only bin/node
+func testProvisioner(t *testing.T, corrupt bool) *nodejs.Provisioner {
+	t.Helper()
+	const version = "v20.18.1"
+	file := "node-" + version + "-linux-x64.tar.gz"
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	body := "#!/bin/sh\n"
+	tw.WriteHeader(&tar.Header{Name: "node-" + version + "-linux-x64/bin/node", Mode: 0755, Size: int64(len(body)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(body))
+	tw.Close()
+	gz.Close()
+
+	sum := sha256.Sum256(buf.Bytes())
+	bundleDir := t.TempDir()
+	if corrupt {
+		buf.WriteByte(0)
+	}
+	os.WriteFile(filepath.Join(bundleDir, file), buf.Bytes(), 0644)
+
+	return &nodejs.Provisioner{
+		Manifest:   &nodejs.Manifest{Version: version, Tarballs: map[string]nodejs.Tarball{"amd64": {File: file, SHA256: hex.EncodeToString(sum[:])}}},
+		Prefix:     t.TempDir(),
+		Arch:       "amd64",
+		OfflineDir: bundleDir,
+		Offline:    true,
+	}
+}
+
+func TestEnvironmentSetupProvisionsNode(t *testing.T) {
+	p := testProvisioner(t, false)
+
+	var logFile bytes.Buffer
+	rt, err := EnvironmentSetupHandler(context.Background(), p, &logFile)
+	if err != nil {
+		t.Fatalf("Environment setup failed: %v", err)
+	}
+	if rt.Node() != filepath.Join(p.Prefix, "node-v20.18.1-linux-x64", "bin", "node") {
+		t.Errorf("Unexpected node path %s", rt.Node())
+	}
+
+	for _, expected := range []string{"Using bundled", "Verifying", "Unpacking", "is available at"} {
+		if !strings.Contains(logFile.String(), expected) {
+			t.Errorf("Log is missing %q:\n%s", expected, logFile.String())
+		}
+	}
+}
+
+func TestEnvironmentSetupFailure(t *testing.T) {
+	var logFile bytes.Buffer
+	if _, err := EnvironmentSetupHandler(context.Background(), testProvisioner(t, true), &logFile); err == nil {
+		t.Fatal("Expected environment setup to fail")
+	}
+	if !strings.Contains(logFile.String(), "Node.js provisioning failed: checksum mismatch") {
+		t.Errorf("Log does not record the failure:\n%s", logFile.String())
+	}
+}
@@ -1,16 +1,32 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os/exec"
+	"spi-go-core/helpers"
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/audit"
 	"spi-go-core/internal/config"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/metrics"
+	"spi-go-core/internal/tracing"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ExecHandler runs allowlisted commands, checked against the running configuration
 type ExecHandler struct {
-	Config *config.AppConfig
+	Config    *config.Store
+	Approvals *approval.Gate // decides commands the approval policy names
+	Executor  executor.Executor
+	Audit     *audit.Log // nil discards
 }
 
 // CommandResponse represents the structure of the response
@@ -19,97 +35,187 @@ type CommandResponse struct {
 	Error  string `json:"error"`  // Error message, if any
 }
 
-// Global variable for allowed commands
-var allowedCommands = map[string]bool{}
+// execLog is the log of the exec component
+var execLog = logging.For(logging.Exec)
 
-// SetAllowedCommands updates the allowed commands based on config
-func SetAllowedCommands(commands []string) {
-	for _, cmd := range commands {
-		allowedCommands[cmd] = true
+// recordAudit adds the session of r to event and records it in log
+func recordAudit(log *audit.Log, r *http.Request, event audit.Event) {
+	event.Session = r.Header.Get("X-Request-ID")
+	log.Record(event)
+}
+
+// approvalRequest starts the request the operator sees for work asked for by r
+func approvalRequest(r *http.Request, kind string) approval.Request {
+	return approval.Request{Kind: kind, Session: r.Header.Get("X-Request-ID"), Client: clientIdentity(r)}
+}
+
+// clientIdentity names the client behind r by its TLS client certificate when
+// it presented one, otherwise by its address
+func clientIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return fmt.Sprintf("%s (%s)", r.TLS.PeerCertificates[0].Subject.CommonName, r.RemoteAddr)
 	}
+	return r.RemoteAddr
 }
 
 // RequestPayload represents the structure of the incoming request for exec
 type RequestPayload struct {
 	Command string `json:"command"`
+	Plan    bool   `json:"plan,omitempty"` // Report what would run without running it
+}
+
+// ExecPlan describes what /api/exec would do with a command in plan mode
+type ExecPlan struct {
+	Command string   `json:"command"`
+	Argv    []string `json:"argv"`
+	Allowed bool     `json:"allowed"`
+	Reason  string   `json:"reason"`
+	// Approval is set when an operator has to approve the command before it runs
+	Approval bool `json:"approval,omitempty"`
 }
 
 // HandleExecCommand handles the POST request to execute a command
-func HandleExecCommand(w http.ResponseWriter, r *http.Request) {
-	if config.GlobalConfig == nil {
-		http.Error(w, "Unable to read configuration for handler", http.StatusInternalServerError)
-		return
-	}
+func (h *ExecHandler) HandleExecCommand(w http.ResponseWriter, r *http.Request) {
+	// One configuration for the whole request, even if a reload swaps it meanwhile
+	cfg := h.Config.Current()
 
 	// Read the request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Unable to read request body", http.StatusBadRequest)
+		helpers.JSONError(w, "Unable to read request body", http.StatusBadRequest)
 		return
 	}
 
 	// Parse the JSON payload to extract the command
 	var payload RequestPayload
 	if err := json.Unmarshal(body, &payload); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		helpers.JSONError(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
-	// Check if encryption is enabled in the config
-	var commandStr string
-	if config.GlobalConfig.Encryption.Enabled {
-		// Handle encryption if enabled (not shown here for simplicity)
-	} else {
-		// If encryption is not enabled, use the command as is
-		commandStr = payload.Command
-	}
+	// Commands arrive in plain text; Validate refuses encryption.enabled until they can be decrypted
+	commandStr := payload.Command
 
 	// Extract and validate the command
-	cmd := extractCommand(commandStr)
-	if !isWhitelistedCommand(cmd) {
-		http.Error(w, fmt.Sprintf("Command '%s' is not allowed", cmd), http.StatusForbidden)
+	args := splitCommand(commandStr)
+	allowed, reason := evaluatePolicy(r.Context(), cfg, args)
+
+	// In plan mode report the policy decision instead of running anything
+	if payload.Plan {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ExecPlan{Command: commandStr, Argv: args, Allowed: allowed, Reason: reason,
+			Approval: allowed && cfg.Approval.ForCommand(args[0])})
+		return
+	}
+
+	if !allowed {
+		recordDenial("exec", cfg, args)
+		recordAudit(h.Audit, r, audit.Event{Action: "exec", Command: commandStr, Allowed: audit.Bool(false), Detail: reason})
+		helpers.JSONError(w, reason, http.StatusForbidden)
 		return
 	}
+	command := metrics.CommandLabel(args, true)
+
+	// Hold the request until the operator decides
+	if cfg.Approval.ForCommand(args[0]) {
+		request := approvalRequest(r, approval.KindExec)
+		request.Argv = args
+		if err := h.Approvals.Ask(r.Context(), request, cfg.Approval.Wait()); err != nil {
+			metrics.PolicyDenials.Inc("not_approved")
+			metrics.ExecRequests.Inc("exec", command, metrics.OutcomeNotApproved)
+			recordAudit(h.Audit, r, audit.Event{Action: "exec", Command: commandStr, Allowed: audit.Bool(false), Detail: err.Error()})
+			helpers.JSONError(w, fmt.Sprintf("Command '%s' was not approved: %v", args[0], err), http.StatusForbidden)
+			return
+		}
+	}
 
-	// Execute the system command
-	out, err := execCommand(cmd)
+	// Execute the system command without a shell, so arguments cannot chain further commands
+	started := time.Now()
+	out, err := execCommand(r.Context(), h.Executor, args)
+	metrics.CommandDuration.Observe(time.Since(started).Seconds(), command)
+	outcome := metrics.OutcomeSucceeded
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Command execution failed: %v", err), http.StatusInternalServerError)
+		outcome = metrics.OutcomeFailed
+	}
+	metrics.ExecRequests.Inc("exec", command, outcome)
+	event := audit.Event{Action: "exec", Command: commandStr, Allowed: audit.Bool(true), ExitCode: audit.Int(0)}
+	if err != nil {
+		var exitErr *executor.ExitError
+		if errors.As(err, &exitErr) {
+			event.ExitCode = audit.Int(exitErr.Code)
+		} else {
+			event.ExitCode = nil
+		}
+		event.Error = err.Error()
+	}
+	recordAudit(h.Audit, r, event)
+	if err != nil {
+		helpers.JSONError(w, fmt.Sprintf("Command execution failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Encode the response as JSON and send it
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
+}
 
-	// Send the output back
-	//w.Write([]byte(out))
+// splitCommand splits the full command into argv (e.g., "ls -la" -> ["ls", "-la"])
+func splitCommand(fullCommand string) []string {
+	return strings.Fields(fullCommand)
 }
 
-// extractCommand extracts the base command from the input (e.g., "ls -la" -> "ls")
-func extractCommand(fullCommand string) string {
-	var cmd string
-	_, err := fmt.Sscanf(fullCommand, "%s", &cmd)
-	if err != nil {
-		return ""
+// evaluatePolicy decides whether cfg allows args to be executed and explains
+// why, recording the decision in a span
+func evaluatePolicy(ctx context.Context, cfg *config.AppConfig, args []string) (allowed bool, reason string) {
+	_, span := tracing.Start(ctx, "policy.evaluate")
+	defer func() {
+		span.SetAttributes(attribute.String("process.executable.name", metrics.CommandLabel(args, allowed)),
+			attribute.Bool("spi.policy.allowed", allowed))
+		span.End()
+	}()
+	if !cfg.Commands.ExecEnabled() {
+		return false, "Command execution is disabled"
 	}
-	return cmd
+	if len(args) == 0 {
+		return false, "Command is empty"
+	}
+	cmd := args[0]
+	if !isWhitelistedCommand(cfg.Commands.Allowed, cmd) {
+		return false, fmt.Sprintf("Command '%s' is not allowed", cmd)
+	}
+	return true, fmt.Sprintf("Command '%s' is in the allowlist", cmd)
+}
+
+// recordDenial counts a command evaluatePolicy refused, by why it did
+func recordDenial(endpoint string, cfg *config.AppConfig, args []string) {
+	reason := "not_allowed"
+	switch {
+	case !cfg.Commands.ExecEnabled():
+		reason = "exec_disabled"
+	case len(args) == 0:
+		reason = "empty"
+	}
+	metrics.PolicyDenials.Inc(reason)
+	metrics.ExecRequests.Inc(endpoint, metrics.CommandLabel(args, false), metrics.OutcomeDenied)
 }
 
-// isWhitelistedCommand checks if the given command is allowed
-func isWhitelistedCommand(command string) bool {
-	_, exists := allowedCommands[command]
-	return exists
+// isWhitelistedCommand checks if the given command is in the allowlist
+func isWhitelistedCommand(allowed []string, command string) bool {
+	for _, candidate := range allowed {
+		if candidate == command {
+			return true
+		}
+	}
+	return false
 }
 
-// execCommand executes the system command and returns the output or error
-func execCommand(command string) (string, error) {
-	// Execute the command using os/exec
-	output, err := exec.Command("sh", "-c", command).Output()
+// execCommand executes the system command through ex and returns the output or error
+func execCommand(ctx context.Context, ex executor.Executor, args []string) (string, error) {
+	result, err := executor.Run(ctx, ex, executor.Spec{Args: args}, nil)
 
 	// Prepare the response
 	response := CommandResponse{
-		Output: string(output),
+		Output: result.Stdout,
 	}
 	if err != nil {
 		response.Error = err.Error()
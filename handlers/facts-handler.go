@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"spi-go-core/helpers"
+	"spi-go-core/internal/facts"
+)
+
+// FactsHandler serves the facts collected about the host
+type FactsHandler struct {
+	Collector *facts.Collector
+}
+
+// HandleGet collects and returns the current host facts
+func (h *FactsHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	hostFacts, err := h.Collector.Collect()
+	if err != nil {
+		helpers.JSONError(w, fmt.Sprintf("Failed to collect facts: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hostFacts)
+}
@@ -1,13 +1,15 @@
 package handlers
 
 import (
-	"bytes"
+	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"spi-go-core/helpers"
+	"spi-go-core/internal/config"
 	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/logging"
 	"time"
 )
 
@@ -32,9 +34,24 @@ type FinalizationRequest struct {
 	Secret string `json:"secret"`
 }
 
+// handshakeLog is the log of the handshake component
+var handshakeLog = logging.For(logging.Handshake)
+
+// HandshakeHandler runs the RSA handshake with the core key pair of the running configuration
+type HandshakeHandler struct {
+	Config   *config.Store
+	Sessions *encryption.SessionStore
+}
+
+// loadKeys loads the core key pair named in the running configuration
+func (h *HandshakeHandler) loadKeys() (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	cfg := h.Config.Current()
+	return encryption.LoadGoKeys(cfg.Encryption.PrivateKey, cfg.Encryption.PublicKey)
+}
+
 // HandleKeyExchange handles the initial public key exchange and returns a session ID
-func HandleKeyExchange(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for key exchange")
+func (h *HandshakeHandler) HandleKeyExchange(w http.ResponseWriter, r *http.Request) {
+	handshakeLog.InfoContext(r.Context(), "Received request for key exchange")
 	var req KeyExchangeRequest
 
 	// Parse the request body to get the TypeScript app's public key
@@ -52,20 +69,21 @@ func HandleKeyExchange(w http.ResponseWriter, r *http.Request) {
 		helpers.JSONError(w, "Failed to parse TypeScript app public key", http.StatusBadRequest)
 		return
 	}
-	log.Printf("Received and parsed TypeScript app public key.")
+	handshakeLog.DebugContext(r.Context(), "Received and parsed TypeScript app public key")
 
 	// Create the ConnectionData struct with the public key
 	connectionData := encryption.ConnectionData{
 		PublicKey: tsAppPublicKey,
 		Timestamp: time.Now(),
+		Client:    clientIdentity(r),
 	}
 
 	// Store the connection data using the existing StoreConnectionData function
-	encryption.StoreConnectionData(sessionID, connectionData)
-	log.Printf("Stored connection data for session %s", sessionID)
+	h.Sessions.Store(sessionID, connectionData)
+	handshakeLog.DebugContext(r.Context(), "Stored connection data", "session", sessionID)
 
 	// Get Go core's public key in PEM format
-	goCorePublicKeyPEM, err := encryption.GetGoCorePublicKeyPEM()
+	goCorePublicKeyPEM, err := encryption.GetGoCorePublicKeyPEM(h.Config.Current().Encryption.PublicKey)
 	if err != nil {
 		helpers.JSONError(w, "Failed to load Go public key", http.StatusInternalServerError)
 		return
@@ -80,15 +98,15 @@ func HandleKeyExchange(w http.ResponseWriter, r *http.Request) {
 	// Send the response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Println("Error sending response:", err)
+		handshakeLog.ErrorContext(r.Context(), "Error sending response", "error", err)
 		return
 	}
 
-	log.Printf("Successfully completed key exchange with session ID: %s", sessionID)
+	handshakeLog.InfoContext(r.Context(), "Completed key exchange", "session", sessionID)
 }
 
 // HandleMessageVerification handles the decrypted message from TS app and re-encrypts it
-func HandleMessageVerification(w http.ResponseWriter, r *http.Request) {
+func (h *HandshakeHandler) HandleMessageVerification(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session ID from header
 	sessionID := r.Header.Get("X-Request-ID")
 	if sessionID == "" {
@@ -97,14 +115,14 @@ func HandleMessageVerification(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve per-session data
-	connectionData, err := encryption.GetConnectionData(sessionID)
+	connectionData, err := h.Sessions.Get(sessionID)
 	if err != nil {
 		helpers.JSONError(w, "Invalid session ID", http.StatusBadRequest)
 		return
 	}
 
 	// Load Go core's private key
-	goPrivateKey, _, err := encryption.LoadGoKeys()
+	goPrivateKey, _, err := h.loadKeys()
 	if err != nil {
 		helpers.JSONError(w, "Failed to load Go private key", http.StatusInternalServerError)
 		return
@@ -140,7 +158,7 @@ func HandleMessageVerification(w http.ResponseWriter, r *http.Request) {
 	// Generate and store the challenge secret
 	challengeSecret := encryption.GenerateRandomString(64)
 	connectionData.ChallengeSecret = challengeSecret
-	encryption.StoreConnectionData(sessionID, connectionData)
+	h.Sessions.Store(sessionID, connectionData)
 
 	// Encrypt the challenge secret with the TypeScript app's public key
 	ownChallenge, err := encryption.EncryptWithPublicKey([]byte(challengeSecret), connectionData.PublicKey)
@@ -148,7 +166,7 @@ func HandleMessageVerification(w http.ResponseWriter, r *http.Request) {
 		helpers.JSONError(w, "Failed to encrypt own challenge message with TypeScript app's public key", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Requesting final challenge from client. Secret: %s", challengeSecret)
+	handshakeLog.InfoContext(r.Context(), "Requesting final challenge from client")
 
 	// Send the re-encrypted message and own challenge back to the TypeScript app
 	w.Header().Set("Content-Type", "application/json")
@@ -157,13 +175,13 @@ func HandleMessageVerification(w http.ResponseWriter, r *http.Request) {
 		OwnChallenge:      base64.StdEncoding.EncodeToString(ownChallenge),
 	}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Println("Error sending response:", err)
+		handshakeLog.ErrorContext(r.Context(), "Error sending response", "error", err)
 		return
 	}
 }
 
 // HandleSuccess handles the final confirmation from the TypeScript app that the handshake was successful
-func HandleSuccess(w http.ResponseWriter, r *http.Request) {
+func (h *HandshakeHandler) HandleSuccess(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session ID from header
 	sessionID := r.Header.Get("X-Request-ID")
 	if sessionID == "" {
@@ -172,14 +190,18 @@ func HandleSuccess(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve per-session data
-	connectionData, err := encryption.GetConnectionData(sessionID)
+	connectionData, err := h.Sessions.Get(sessionID)
 	if err != nil {
 		helpers.JSONError(w, "Invalid session ID", http.StatusBadRequest)
 		return
 	}
+	if connectionData.Validated {
+		helpers.JSONError(w, "Handshake already completed", http.StatusConflict)
+		return
+	}
 
 	// Load Go core's private key
-	goPrivateKey, _, err := encryption.LoadGoKeys()
+	goPrivateKey, _, err := h.loadKeys()
 	if err != nil {
 		helpers.JSONError(w, "Failed to load Go private key", http.StatusInternalServerError)
 		return
@@ -205,17 +227,21 @@ func HandleSuccess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the decrypted secret matches the stored challenge secret
-	if !bytes.Equal(decryptedSecret, []byte(connectionData.ChallengeSecret)) {
+	// Check the decrypted secret against the challenge, burning it, and mark the session as validated on a match
+	matched, err := h.Sessions.CompleteHandshake(sessionID, decryptedSecret)
+	switch {
+	case errors.Is(err, encryption.ErrHandshakeCompleted):
+		helpers.JSONError(w, "Handshake already completed", http.StatusConflict)
+		return
+	case err != nil:
+		helpers.JSONError(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	case !matched:
 		helpers.JSONError(w, "Failed to verify final secret", http.StatusUnauthorized)
 		return
 	}
 
-	// Mark the session as validated
-	connectionData.Validated = true
-	encryption.StoreConnectionData(sessionID, connectionData)
-
-	log.Println("Connection successfully validated with the TypeScript app.")
+	handshakeLog.InfoContext(r.Context(), "Connection validated with the TypeScript app")
 
 	// Respond to the TypeScript app
 	w.Header().Set("Content-Type", "application/json")
@@ -227,7 +253,7 @@ func HandleSuccess(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Println("Error sending response:", err)
+		handshakeLog.ErrorContext(r.Context(), "Error sending response", "error", err)
 		return
 	}
 }
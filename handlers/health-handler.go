@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/health"
+	"spi-go-core/internal/supervisor"
+	"time"
+)
+
+// Health statuses
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded" // serving, but the last config reload failed
+)
+
+// HealthResponse is the body of GET /api/health
+type HealthResponse struct {
+	Status string               `json:"status"`
+	Config *config.ReloadStatus `json:"config,omitempty"`
+}
+
+// ReadinessResponse is the body of GET /readyz
+type ReadinessResponse struct {
+	Ready  bool           `json:"ready"`
+	Checks []health.Check `json:"checks"`
+}
+
+// HealthHandler reports whether the server is healthy and ready
+type HealthHandler struct {
+	Config     *config.Store
+	Supervisor *supervisor.Supervisor // nil when no app is supervised
+}
+
+// reloadError returns the error of the last config reload, if any
+func (h *HealthHandler) reloadError() string {
+	return h.Config.Status().LastError
+}
+
+// HandleGet returns the health of the server and of its configuration
+func (h *HealthHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{Status: HealthOK}
+	if h.Config != nil {
+		status := h.Config.Status()
+		response.Config = &status
+		if status.LastError != "" {
+			response.Status = HealthDegraded
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleLive answers as long as the server can serve requests at all
+func (h *HealthHandler) HandleLive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthResponse{Status: HealthOK})
+}
+
+// HandleReady runs the readiness checks and answers 503 if one fails
+func (h *HealthHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	checks := health.Ready(h.Config.Current(), h.reloadError(), h.Supervisor)
+	response := ReadinessResponse{Ready: health.Passed(checks), Checks: checks}
+	w.Header().Set("Content-Type", "application/json")
+	if !response.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleDiagnostics describes the build, the uptime, the TLS and encryption
+// modes, the certificate and the key fingerprints, with the checks
+func (h *HealthHandler) HandleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health.Diagnose(h.Config.Current(), h.reloadError(), h.Supervisor, time.Now()))
+}
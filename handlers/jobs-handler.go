@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"spi-go-core/helpers"
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/audit"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/metrics"
+)
+
+// JobsHandler exposes background command execution over the API
+type JobsHandler struct {
+	Jobs      *jobs.Manager
+	Config    *config.Store
+	Approvals *approval.Gate // decides commands the approval policy names
+	Audit     *audit.Log     // nil discards
+}
+
+// JobStreamEvent is one line of the NDJSON stream returned by HandleStream.
+// Output events carry Line, the final event carries Job and has Done set.
+type JobStreamEvent struct {
+	Line *jobs.Line `json:"line,omitempty"`
+	Done bool       `json:"done,omitempty"`
+	Job  *jobs.Info `json:"job,omitempty"`
+}
+
+// HandleStart starts a whitelisted command as a background job
+func (h *JobsHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	var payload RequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		helpers.JSONError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	// Apply the same policy as the synchronous exec endpoint
+	cfg := h.Config.Current()
+	args := splitCommand(payload.Command)
+	if allowed, reason := evaluatePolicy(r.Context(), cfg, args); !allowed {
+		recordDenial("jobs", cfg, args)
+		recordAudit(h.Audit, r, audit.Event{Action: "job.start", Command: payload.Command, Allowed: audit.Bool(false), Detail: reason})
+		helpers.JSONError(w, reason, http.StatusForbidden)
+		return
+	}
+
+	// The job waits for the operator instead of the request
+	var approve func(ctx context.Context) error
+	if cfg.Approval.ForCommand(args[0]) {
+		request := approvalRequest(r, approval.KindJob)
+		request.Argv = args
+		timeout := cfg.Approval.Wait()
+		approve = func(ctx context.Context) error {
+			return h.Approvals.Ask(ctx, request, timeout)
+		}
+	}
+
+	job, err := h.Jobs.StartApproved(r.Context(), args, approve)
+	if errors.Is(err, jobs.ErrShuttingDown) {
+		helpers.JSONError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		metrics.ExecRequests.Inc("jobs", metrics.CommandLabel(args, true), metrics.OutcomeFailed)
+		helpers.JSONError(w, fmt.Sprintf("Failed to start job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	metrics.ExecRequests.Inc("jobs", metrics.CommandLabel(args, true), metrics.OutcomeStarted)
+	execLog.InfoContext(r.Context(), "Started job", "job", job.ID(), "command", payload.Command)
+	recordAudit(h.Audit, r, audit.Event{Action: "job.start", Command: payload.Command, Allowed: audit.Bool(true), Detail: job.ID()})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Info())
+}
+
+// HandleList returns all known jobs
+func (h *JobsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Jobs.List())
+}
+
+// HandleGet returns a single job
+func (h *JobsHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Info())
+}
+
+// HandleCancel cancels a running job
+func (h *JobsHandler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	job.Cancel()
+	<-job.Done()
+	recordAudit(h.Audit, r, audit.Event{Action: "job.cancel", Detail: job.ID()})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Info())
+}
+
+// HandleStream streams job output as newline-delimited JSON until the job finishes
+func (h *JobsHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	controller := http.NewResponseController(w)
+
+	next := 0
+	for {
+		lines, done, changed := job.Lines(next)
+		for i := range lines {
+			if err := encoder.Encode(JobStreamEvent{Line: &lines[i]}); err != nil {
+				return
+			}
+		}
+		if len(lines) > 0 {
+			next = lines[len(lines)-1].Seq + 1
+		}
+
+		if done {
+			info := job.Info()
+			encoder.Encode(JobStreamEvent{Done: true, Job: &info})
+			controller.Flush()
+			return
+		}
+		controller.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// lookup resolves the {id} path value to a job, writing a 404 when it is unknown
+func (h *JobsHandler) lookup(w http.ResponseWriter, r *http.Request) (*jobs.Job, bool) {
+	job, err := h.Jobs.Get(r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		helpers.JSONError(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
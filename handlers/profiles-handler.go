@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"spi-go-core/helpers"
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/audit"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/metrics"
+	"spi-go-core/internal/profiles"
+	"strings"
+)
+
+// maxProfileSize limits uploaded profile documents
+const maxProfileSize = 1 << 20
+
+// ProfilesHandler exposes upload, listing, planning and application of server profiles
+type ProfilesHandler struct {
+	Store     *profiles.Store
+	Runner    *profiles.Runner
+	Config    *config.Store
+	Approvals *approval.Gate // decides steps the approval policy names
+	Audit     *audit.Log     // nil discards
+}
+
+// ProfileSummary is the list representation of a profile
+type ProfileSummary struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Steps       int    `json:"steps"`
+}
+
+// HandleUpload validates and stores a profile sent as JSON or YAML
+func (h *ProfilesHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxProfileSize+1))
+	if err != nil {
+		helpers.JSONError(w, "Unable to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxProfileSize {
+		helpers.JSONError(w, "Profile is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	profile, err := profiles.Parse(body)
+	if err != nil {
+		helpers.JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := profile.Validate(); err != nil {
+		helpers.JSONError(w, fmt.Sprintf("Invalid profile: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !h.stepsAllowed(w, r, profile, "profile.upload") {
+		return
+	}
+	if err := h.Store.Save(profile); err != nil {
+		helpers.JSONError(w, fmt.Sprintf("Failed to store profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	setupLog.InfoContext(r.Context(), "Stored profile", "profile", profile.Name, "steps", len(profile.Steps))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(summarize(profile))
+}
+
+// HandleList returns a summary of every stored profile
+func (h *ProfilesHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	stored, err := h.Store.List()
+	if err != nil {
+		helpers.JSONError(w, fmt.Sprintf("Failed to list profiles: %v", err), http.StatusInternalServerError)
+		return
+	}
+	summaries := make([]ProfileSummary, 0, len(stored))
+	for _, profile := range stored {
+		summaries = append(summaries, summarize(profile))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// HandleGet returns a full profile
+func (h *ProfilesHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// HandlePlan reports which steps of a profile would change the host
+func (h *ProfilesHandler) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Runner.Plan(r.Context(), profile))
+}
+
+// HandleApply starts applying a profile in the background
+func (h *ProfilesHandler) HandleApply(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	// The policy may have changed since the upload
+	if !h.stepsAllowed(w, r, profile, "profile.apply") {
+		return
+	}
+	// Steps wait for the operator under the policy in force when they are reached
+	request := approvalRequest(r, approval.KindProfileStep)
+	approve := func(ctx context.Context, step profiles.Step, commands []string) error {
+		policy := h.Config.Current().Approval
+		if !policy.ForStep(string(step.Type)) {
+			return nil
+		}
+		request := request
+		request.Commands = commands
+		request.Detail = fmt.Sprintf("profile %s, step %s", profile.Name, step.Name)
+		return h.Approvals.Ask(ctx, request, policy.Wait())
+	}
+	run, err := h.Runner.StartApproved(r.Context(), profile, approve)
+	if errors.Is(err, profiles.ErrBusy) {
+		helpers.JSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, profiles.ErrShuttingDown) {
+		helpers.JSONError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	setupLog.InfoContext(r.Context(), "Started profile run", "run", run.ID, "profile", profile.Name)
+	recordAudit(h.Audit, r, audit.Event{Action: "profile.apply", Detail: profile.Name + " " + run.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// HandleListRuns returns every profile run with per-step status
+func (h *ProfilesHandler) HandleListRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Runner.List())
+}
+
+// HandleGetRun returns a single profile run with per-step status
+func (h *ProfilesHandler) HandleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, err := h.Runner.Get(r.PathValue("id"))
+	if err != nil {
+		helpers.JSONError(w, "Run not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// stepsAllowed checks every step against profiles.allowed_steps, the path of
+// every file step against profiles.allowed_paths and the command of every
+// command step against the policy of /api/exec and /api/jobs, so a profile
+// cannot change more of the host than the configuration lets it. A refusal is
+// answered with 403 and audited as action.
+func (h *ProfilesHandler) stepsAllowed(w http.ResponseWriter, r *http.Request, profile *profiles.Profile, action string) bool {
+	cfg := h.Config.Current()
+	for _, step := range profile.Steps {
+		var reason string
+		switch {
+		case !cfg.Profiles.AllowsStep(string(step.Type)):
+			reason = fmt.Sprintf("%s steps are not in profiles.allowed_steps", step.Type)
+		case step.Type == profiles.StepFile && !cfg.Profiles.AllowsPath(step.Path):
+			reason = fmt.Sprintf("%s is not below profiles.allowed_paths", step.Path)
+		case step.Type == profiles.StepCommand:
+			if allowed, why := evaluatePolicy(r.Context(), cfg, step.Command); !allowed {
+				recordDenial("profiles", cfg, step.Command)
+				reason = why
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		if step.Type != profiles.StepCommand {
+			metrics.PolicyDenials.Inc("step_not_allowed")
+		}
+		recordAudit(h.Audit, r, audit.Event{Action: action, Command: strings.Join(step.Command, " "), Allowed: audit.Bool(false),
+			Detail: fmt.Sprintf("profile %s, step %s: %s", profile.Name, step.Name, reason)})
+		helpers.JSONError(w, fmt.Sprintf("Step '%s': %s", step.Name, reason), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// lookup resolves the {name} path value to a stored profile
+func (h *ProfilesHandler) lookup(w http.ResponseWriter, r *http.Request) (*profiles.Profile, bool) {
+	profile, err := h.Store.Get(r.PathValue("name"))
+	if errors.Is(err, profiles.ErrProfileNotFound) {
+		helpers.JSONError(w, "Profile not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		helpers.JSONError(w, fmt.Sprintf("Failed to load profile: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return profile, true
+}
+
+func summarize(profile *profiles.Profile) ProfileSummary {
+	return ProfileSummary{Name: profile.Name, Description: profile.Description, Steps: len(profile.Steps)}
+}
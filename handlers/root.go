@@ -4,7 +4,12 @@ import (
 	"net/http"
 )
 
-// HandleRoot handles the basic GET request at the root
+// HandleRoot handles the basic GET request at the root, naming the protocol
+// the request actually came in on
 func HandleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil {
+		w.Write([]byte("ServerProfileInstaller (SPI) API is running over plain HTTP.\n"))
+		return
+	}
 	w.Write([]byte("ServerProfileInstaller (SPI) API is running securely via HTTPS.\n"))
 }
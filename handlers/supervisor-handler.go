@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"spi-go-core/helpers"
+	"spi-go-core/internal/supervisor"
+)
+
+// SupervisorHandler reports on the supervised TypeScript app
+type SupervisorHandler struct {
+	Supervisor *supervisor.Supervisor
+}
+
+// HandleGet returns the current state of the supervised app
+func (h *SupervisorHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if h.Supervisor == nil {
+		helpers.JSONError(w, "No app is supervised", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Supervisor.Status())
+}
@@ -0,0 +1,214 @@
+// Package approval lets an operator on the console approve or deny privileged
+// work before it runs. Callers block in Gate.Ask until the operator decides,
+// the request times out or the caller gives up; every outcome is audited.
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spi-go-core/internal/audit"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/events"
+)
+
+// Kinds of work that can wait for approval
+const (
+	KindExec        = "exec"
+	KindJob         = "job"
+	KindProfileStep = "profile step"
+)
+
+// DefaultTimeout is how long a request waits when Ask is given no timeout
+const DefaultTimeout = 2 * time.Minute
+
+var (
+	// ErrDenied is returned when the operator denies a request
+	ErrDenied = errors.New("denied by the operator")
+	// ErrTimeout is returned when nobody decides in time
+	ErrTimeout = errors.New("no decision before the approval timeout")
+	// ErrNoOperator is returned when no console is attached to decide
+	ErrNoOperator = errors.New("approval required but no operator console is attached")
+	// ErrNotFound is returned by Decide for unknown or settled requests
+	ErrNotFound = errors.New("approval request not found")
+)
+
+// Request describes the work waiting for a decision
+type Request struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	Session     string    `json:"session,omitempty"`
+	Client      string    `json:"client,omitempty"`
+	Argv        []string  `json:"argv,omitempty"`     // exec and jobs
+	Commands    []string  `json:"commands,omitempty"` // command lines a profile step would run
+	Detail      string    `json:"detail,omitempty"`   // e.g. the profile and step name
+	RequestedAt time.Time `json:"requestedAt"`
+	Deadline    time.Time `json:"deadline"`
+}
+
+// Summary returns the request on one line
+func (r Request) Summary() string {
+	what := strings.Join(r.Argv, " ")
+	if what == "" {
+		what = strings.Join(r.Commands, "; ")
+	}
+	if r.Detail != "" {
+		what = r.Detail + ": " + what
+	}
+	return fmt.Sprintf("%s %s", r.Kind, what)
+}
+
+type pending struct {
+	request  Request
+	decision chan error // nil approves
+}
+
+// Gate holds the requests waiting for the operator. Create gates with
+// NewGate; the nil *Gate has no operator and refuses every request.
+type Gate struct {
+	// Audit records every decision; nil discards
+	Audit *audit.Log
+	// Events announces requests and their outcome to the console
+	Events *events.Bus
+
+	mu        sync.Mutex
+	pending   map[string]*pending
+	operators int
+}
+
+// NewGate returns a gate without operators
+func NewGate() *Gate {
+	return &Gate{pending: make(map[string]*pending)}
+}
+
+// Attach registers an operator console. Requests are only held while one is
+// attached; the returned function detaches it and, for the last console,
+// denies whatever is still waiting.
+func (g *Gate) Attach() func() {
+	g.mu.Lock()
+	g.operators++
+	g.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.operators--
+			if g.operators > 0 {
+				return
+			}
+			for id, p := range g.pending {
+				delete(g.pending, id)
+				p.decision <- ErrNoOperator
+			}
+		})
+	}
+}
+
+// Ask holds req until the operator decides, timeout passes or ctx is done and
+// returns nil only when the operator approved it
+func (g *Gate) Ask(ctx context.Context, req Request, timeout time.Duration) error {
+	if g == nil {
+		return ErrNoOperator
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	req.ID = encryption.GenerateReqId()
+	req.RequestedAt = time.Now()
+	req.Deadline = req.RequestedAt.Add(timeout)
+
+	g.mu.Lock()
+	if g.operators == 0 {
+		g.mu.Unlock()
+		g.settle(req, ErrNoOperator)
+		return ErrNoOperator
+	}
+	p := &pending{request: req, decision: make(chan error, 1)}
+	g.pending[req.ID] = p
+	g.mu.Unlock()
+
+	g.Events.Publish(events.Event{Source: events.SourceApproval, Task: req.ID, Title: "approve " + req.Summary(),
+		Status: events.StatusPending, Message: fmt.Sprintf("session %s from %s", req.Session, req.Client)})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case err = <-p.decision:
+	case <-timer.C:
+		err = ErrTimeout
+	case <-ctx.Done():
+		err = fmt.Errorf("request withdrawn: %w", ctx.Err())
+	}
+
+	g.mu.Lock()
+	delete(g.pending, req.ID)
+	g.mu.Unlock()
+	g.settle(req, err)
+	return err
+}
+
+// Decide approves or denies the pending request id
+func (g *Gate) Decide(id string, approve bool) error {
+	if g == nil {
+		return ErrNotFound
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, exists := g.pending[id]
+	if !exists {
+		return ErrNotFound
+	}
+	delete(g.pending, id)
+	if approve {
+		p.decision <- nil
+	} else {
+		p.decision <- ErrDenied
+	}
+	return nil
+}
+
+// Pending returns the waiting requests, oldest first
+func (g *Gate) Pending() []Request {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	requests := make([]Request, 0, len(g.pending))
+	for _, p := range g.pending {
+		requests = append(requests, p.request)
+	}
+	g.mu.Unlock()
+
+	sort.Slice(requests, func(i, k int) bool {
+		return requests[i].RequestedAt.Before(requests[k].RequestedAt)
+	})
+	return requests
+}
+
+// settle audits and announces the outcome of req
+func (g *Gate) settle(req Request, err error) {
+	event := audit.Event{Action: "approval", Session: req.Session, Command: strings.Join(req.Argv, " "),
+		Allowed: audit.Bool(err == nil), Detail: req.Kind + " from " + req.Client}
+	if len(req.Commands) > 0 {
+		event.Command = strings.Join(req.Commands, "; ")
+	}
+	if req.Detail != "" {
+		event.Detail += ", " + req.Detail
+	}
+	status, message := events.StatusSucceeded, "approved"
+	if err != nil {
+		event.Error = err.Error()
+		status, message = events.StatusFailed, "not approved"
+	}
+	g.Audit.Record(event)
+	g.Events.Publish(events.Event{Source: events.SourceApproval, Task: req.ID, Title: "approve " + req.Summary(),
+		Status: status, Message: message, Error: event.Error})
+}
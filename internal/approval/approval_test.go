@@ -0,0 +1,80 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"spi-go-core/internal/audit"
+)
+
+// decideWhenAsked settles the first request to arrive at g
+func decideWhenAsked(t *testing.T, g *Gate, approve bool) <-chan Request {
+	t.Helper()
+	decided := make(chan Request, 1)
+	go func() {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if pending := g.Pending(); len(pending) > 0 {
+				g.Decide(pending[0].ID, approve)
+				decided <- pending[0]
+				return
+			}
+		}
+		close(decided)
+	}()
+	return decided
+}
+
+func TestAskWaitsForTheOperator(t *testing.T) {
+	var out bytes.Buffer
+	g := NewGate()
+	g.Audit = audit.New(&out)
+	request := Request{Kind: KindExec, Session: "s1", Client: "127.0.0.1:5000", Argv: []string{"systemctl", "restart", "nginx"}}
+
+	if err := g.Ask(context.Background(), request, time.Second); !errors.Is(err, ErrNoOperator) {
+		t.Errorf("Expected ErrNoOperator without a console, got %v", err)
+	}
+
+	detach := g.Attach()
+	decided := decideWhenAsked(t, g, true)
+	if err := g.Ask(context.Background(), request, time.Second); err != nil {
+		t.Errorf("Expected approval, got %v", err)
+	}
+	if seen := <-decided; seen.Session != "s1" || seen.Client != "127.0.0.1:5000" || len(seen.Argv) != 3 {
+		t.Errorf("The operator should see who asked for what, got %+v", seen)
+	}
+
+	decideWhenAsked(t, g, false)
+	if err := g.Ask(context.Background(), request, time.Second); !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected ErrDenied, got %v", err)
+	}
+	if err := g.Ask(context.Background(), request, 10*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, got %v", err)
+	}
+
+	// Closing the console settles what is still waiting
+	result := make(chan error, 1)
+	go func() { result <- g.Ask(context.Background(), request, time.Minute) }()
+	for len(g.Pending()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	detach()
+	if err := <-result; !errors.Is(err, ErrNoOperator) {
+		t.Errorf("Expected ErrNoOperator once the console closed, got %v", err)
+	}
+
+	g.Audit.Close()
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 audited decisions, got %d:\n%s", len(lines), out.String())
+	}
+	var approved audit.Event
+	json.Unmarshal([]byte(lines[1]), &approved)
+	if approved.Action != "approval" || approved.Session != "s1" || approved.Command != "systemctl restart nginx" || !*approved.Allowed {
+		t.Errorf("Unexpected audit record %s", lines[1])
+	}
+}
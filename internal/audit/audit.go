@@ -0,0 +1,139 @@
+// Package audit records security-relevant actions (commands, jobs, profile
+// runs, lifecycle events) as JSON lines. Writes are buffered and flushed
+// periodically and on shutdown.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is one audit record
+type Event struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"` // e.g. exec, job.start, job.cancel, profile.apply, shutdown, reload
+	Session  string    `json:"session,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Allowed  *bool     `json:"allowed,omitempty"`
+	ExitCode *int      `json:"exitCode,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Log appends events to a writer. A nil *Log discards everything.
+type Log struct {
+	mu     sync.Mutex
+	out    *bufio.Writer
+	closer io.Closer
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// FlushInterval is how often buffered events are written out
+var FlushInterval = time.Second
+
+// Open appends to the audit file at path, creating it with mode 0600
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return New(file), nil
+}
+
+// New writes events to w, closing it on Close when it is an io.Closer
+func New(w io.Writer) *Log {
+	l := &Log{out: bufio.NewWriter(w), stop: make(chan struct{}), done: make(chan struct{})}
+	if closer, ok := w.(io.Closer); ok {
+		l.closer = closer
+	}
+	go l.flushLoop()
+	return l
+}
+
+// Record appends an event, stamping it with the current time if it has none
+func (l *Log) Record(event Event) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.out != nil {
+		l.out.Write(append(data, '\n'))
+	}
+}
+
+// Flush writes buffered events out
+func (l *Log) Flush() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.out == nil {
+		return nil
+	}
+	return l.out.Flush()
+}
+
+// Close flushes the log and closes the underlying writer. Later events are dropped.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.out == nil {
+		l.mu.Unlock()
+		return nil
+	}
+	close(l.stop)
+	l.mu.Unlock()
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.out.Flush()
+	l.out = nil
+	if l.closer != nil {
+		if closeErr := l.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (l *Log) flushLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.Flush()
+		}
+	}
+}
+
+// Bool returns a pointer for Event.Allowed
+func Bool(b bool) *bool {
+	return &b
+}
+
+// Int returns a pointer for Event.ExitCode
+func Int(i int) *int {
+	return &i
+}
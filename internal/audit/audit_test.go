@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordIsBufferedUntilFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Record(Event{Action: "exec", Command: "ls -la", Allowed: Bool(true), ExitCode: Int(0)})
+	l.Record(Event{Action: "shutdown", Detail: "terminated"})
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("Expected events to be buffered, found %q", data)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Events after Close are dropped instead of panicking
+	l.Record(Event{Action: "late"})
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 || events[0].Command != "ls -la" || !*events[0].Allowed || events[0].Time.IsZero() || events[1].Action != "shutdown" {
+		t.Errorf("Unexpected events %+v", events)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Audit log should be private, has mode %v", info.Mode())
+	}
+}
+
+func TestNilLogDiscards(t *testing.T) {
+	var l *Log
+	l.Record(Event{Action: "exec"})
+	if err := l.Flush(); err != nil {
+		t.Error(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,227 @@
+// Package bundle unpacks archives shipped inside the binary into a versioned
+// cache directory, refusing entries that would escape it.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEmpty is returned when the embedded archive has no content, e.g. in development builds
+var ErrEmpty = errors.New("bundled archive is empty")
+
+// completeMarker is written last, so a cache directory without it is ignored
+const completeMarker = ".complete"
+
+// App is an extracted bundle
+type App struct {
+	Version string // first 16 hex digits of the archive's SHA-256
+	Dir     string
+}
+
+// Extract unpacks a gzipped tarball into cacheRoot/<version> and returns it.
+// An existing complete extraction of the same archive is reused, and older
+// versions are removed once the new one is in place.
+func Extract(archive []byte, cacheRoot string) (*App, error) {
+	if len(archive) == 0 {
+		return nil, ErrEmpty
+	}
+	sum := sha256.Sum256(archive)
+	app := &App{Version: hex.EncodeToString(sum[:])[:16]}
+	app.Dir = filepath.Join(cacheRoot, app.Version)
+
+	if _, err := os.Stat(filepath.Join(app.Dir, completeMarker)); err == nil {
+		return app, nil
+	}
+	if err := os.MkdirAll(cacheRoot, 0755); err != nil {
+		return nil, err
+	}
+
+	// Extract next to the final directory and swap it in
+	staging, err := os.MkdirTemp(cacheRoot, ".extract-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := ExtractTarGz(bytes.NewReader(archive), staging, 0); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(staging, completeMarker), nil, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(app.Dir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(staging, app.Dir); err != nil {
+		return nil, err
+	}
+
+	prune(cacheRoot, app.Version)
+	return app, nil
+}
+
+// prune removes every cached version except keep
+func prune(cacheRoot, keep string) {
+	entries, err := os.ReadDir(cacheRoot)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != keep && !strings.HasPrefix(entry.Name(), ".") {
+			os.RemoveAll(filepath.Join(cacheRoot, entry.Name()))
+		}
+	}
+}
+
+// ExtractTarGz unpacks a gzipped tarball into dest, dropping the first strip
+// path components of every entry. File modes are kept; absolute paths, ".."
+// traversal, links pointing outside dest, entries below or over a symlink the
+// archive created and device files are rejected.
+func ExtractTarGz(r io.Reader, dest string, strip int) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := stripComponents(header.Name, strip)
+		if name == "" {
+			continue
+		}
+		if filepath.IsAbs(header.Name) {
+			return fmt.Errorf("entry %s has an absolute path", header.Name)
+		}
+		target, err := within(dest, name)
+		if err != nil {
+			return err
+		}
+		// Links are checked by their text only, so nothing is written through one
+		if err := noSymlinks(dest, target); err != nil {
+			return fmt.Errorf("entry %s %v", header.Name, err)
+		}
+		mode := os.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			if err := os.Chmod(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, reader)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			// OpenFile applies the umask
+			if err := os.Chmod(target, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) {
+				return fmt.Errorf("symlink %s points outside the archive", header.Name)
+			}
+			if _, err := within(dest, filepath.Join(filepath.Dir(name), header.Linkname)); err != nil {
+				return fmt.Errorf("symlink %s points outside the archive", header.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := within(dest, stripComponents(header.Linkname, strip))
+			if err == nil {
+				err = noSymlinks(dest, source)
+			}
+			if err != nil {
+				return fmt.Errorf("hard link %s points outside the archive", header.Name)
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			// pax metadata, nothing to write
+		default:
+			return fmt.Errorf("unsupported entry %s (type %c)", header.Name, header.Typeflag)
+		}
+	}
+}
+
+// stripComponents drops the first n elements of a slash-separated archive path
+func stripComponents(name string, n int) string {
+	name = strings.TrimPrefix(name, "./")
+	for i := 0; i < n; i++ {
+		_, rest, ok := strings.Cut(name, "/")
+		if !ok {
+			return ""
+		}
+		name = rest
+	}
+	return name
+}
+
+// within joins name to dest and rejects results outside dest
+func within(dest, name string) (string, error) {
+	target := filepath.Join(dest, name)
+	if target != dest && !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %s escapes the archive", name)
+	}
+	return target, nil
+}
+
+// noSymlinks rejects target when it, or a directory between dest and it, is
+// a symlink, as writing there could leave dest however the link text reads
+func noSymlinks(dest, target string) error {
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == "." {
+		return err
+	}
+	path := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("goes through the symlink %s", strings.TrimPrefix(path, dest+string(filepath.Separator)))
+		}
+	}
+	return nil
+}
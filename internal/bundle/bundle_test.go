@@ -0,0 +1,151 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name, body, link string
+	mode             int64
+	typeflag         byte
+}
+
+func buildArchive(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.body)), Linkname: e.link, Typeflag: e.typeflag}
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		}
+		if header.Typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func appArchive(t *testing.T, index string) []byte {
+	return buildArchive(t,
+		entry{name: "dist/", mode: 0755, typeflag: tar.TypeDir},
+		entry{name: "dist/index.js", body: index, mode: 0644},
+		entry{name: "bin/start", body: "#!/bin/sh\n", mode: 0750},
+		entry{name: "bin/app", link: "../dist/index.js", typeflag: tar.TypeSymlink},
+	)
+}
+
+func TestExtractKeepsContentAndModes(t *testing.T) {
+	cache := t.TempDir()
+	app, err := Extract(appArchive(t, "console.log('ready')\n"), cache)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(app.Dir, "dist/index.js"))
+	if err != nil || string(content) != "console.log('ready')\n" {
+		t.Errorf("index.js has wrong content %q (%v)", content, err)
+	}
+	info, err := os.Stat(filepath.Join(app.Dir, "bin/start"))
+	if err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("bin/start should keep mode 0750: %v (%v)", info.Mode(), err)
+	}
+	if target, _ := os.Readlink(filepath.Join(app.Dir, "bin/app")); target != "../dist/index.js" {
+		t.Errorf("Unexpected symlink target %q", target)
+	}
+}
+
+func TestExtractIsVersioned(t *testing.T) {
+	cache := t.TempDir()
+	first, err := Extract(appArchive(t, "v1"), cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same archive reuses the cached extraction
+	os.WriteFile(filepath.Join(first.Dir, "marker"), nil, 0644)
+	again, err := Extract(appArchive(t, "v1"), cache)
+	if err != nil || again.Dir != first.Dir {
+		t.Fatalf("Expected the cached copy to be reused: %v (%v)", again, err)
+	}
+	if _, err := os.Stat(filepath.Join(first.Dir, "marker")); err != nil {
+		t.Error("Cached copy was extracted again")
+	}
+
+	// A new archive gets its own directory and the old one is pruned
+	second, err := Extract(appArchive(t, "v2"), cache)
+	if err != nil || second.Version == first.Version {
+		t.Fatalf("Expected a new version: %v (%v)", second, err)
+	}
+	if _, err := os.Stat(first.Dir); !os.IsNotExist(err) {
+		t.Errorf("Old version %s was not pruned", first.Version)
+	}
+}
+
+func TestExtractRejectsEscapingEntries(t *testing.T) {
+	for _, e := range []entry{
+		{name: "../evil", body: "x", mode: 0644},
+		{name: "/etc/evil", body: "x", mode: 0644},
+		{name: "dist/../../evil", body: "x", mode: 0644},
+		{name: "link", link: "../../etc/passwd", typeflag: tar.TypeSymlink},
+		{name: "abs", link: "/etc/passwd", typeflag: tar.TypeSymlink},
+		{name: "hard", link: "../outside", typeflag: tar.TypeLink},
+		{name: "dev", typeflag: tar.TypeChar},
+	} {
+		cache := t.TempDir()
+		if _, err := Extract(buildArchive(t, e), cache); err == nil {
+			t.Errorf("Expected %s to be rejected", e.name)
+		}
+		if entries, _ := os.ReadDir(cache); len(entries) != 0 {
+			t.Errorf("%s: nothing should be left in the cache: %v", e.name, entries)
+		}
+	}
+}
+
+func TestExtractRejectsWritingThroughSymlinks(t *testing.T) {
+	for name, entries := range map[string][]entry{
+		// Every link reads as inside, but together they lead to the parent of dest
+		"chained links": {
+			{name: "d/a", link: "..", typeflag: tar.TypeSymlink},
+			{name: "d/a/b", link: "..", typeflag: tar.TypeSymlink},
+			{name: "d/a/b/evil", body: "x", mode: 0644},
+		},
+		"file over a link": {
+			{name: "link", link: "dist/index.js", typeflag: tar.TypeSymlink},
+			{name: "link", body: "x", mode: 0644},
+		},
+		"hard link through a link": {
+			{name: "d/a", link: "..", typeflag: tar.TypeSymlink},
+			{name: "hard", link: "d/a/file", typeflag: tar.TypeLink},
+		},
+	} {
+		parent := t.TempDir()
+		dest := filepath.Join(parent, "dest")
+		os.Mkdir(dest, 0755)
+		if err := ExtractTarGz(bytes.NewReader(buildArchive(t, entries...)), dest, 0); err == nil {
+			t.Errorf("%s: expected the archive to be rejected", name)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "evil")); !os.IsNotExist(err) {
+			t.Errorf("%s: a file was written outside dest", name)
+		}
+	}
+}
+
+func TestExtractEmptyArchive(t *testing.T) {
+	if _, err := Extract(nil, t.TempDir()); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
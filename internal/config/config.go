@@ -1,8 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 )
 
 // ServerConfig represents the server-related configurations
@@ -10,55 +18,219 @@ type ServerConfig struct {
 	Port       int    `json:"port"`
 	TLSEnabled bool   `json:"tls_enabled"`
 	CertFile   string `json:"tls_cert_file"`
-	KeyFile    string `json:"tls_key_file"`
+	KeyFile    string `json:"tls_key_file" secret:"true"`
 }
 
 // CommandConfig represents the configuration for allowed commands
 type CommandConfig struct {
+	Enabled *bool    `json:"enabled,omitempty"` // exec and jobs, on unless set to false
 	Allowed []string `json:"allowed"`
 }
 
+// ExecEnabled reports whether commands may be executed at all
+func (c CommandConfig) ExecEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
 type UI struct {
-	Enabled bool `json:"enabled"`
+	Enabled    bool   `json:"enabled"`
+	LogFile    string `json:"log_file"`   // provisioning output shown in the UI is also written here
+	Scrollback int    `json:"scrollback"` // log lines the UI keeps, older ones are dropped
+	Renderer   string `json:"renderer"`   // auto (default), tui, plain or json
 }
 
 type Logging struct {
-	Verbosity string `json:"normal"`
+	Verbosity  string   `json:"verbosity"`    // quiet, normal (default), verbose or debug
+	Format     string   `json:"format"`       // text (default) or json
+	File       string   `json:"file"`         // also log here, rotated; empty logs to stderr only
+	Levels     []string `json:"levels"`       // per component, e.g. "handshake=debug"
+	MaxSizeMB  int      `json:"max_size_mb"`  // rotate files beyond this size, 0 for no limit
+	MaxAgeDays int      `json:"max_age_days"` // rotate files written to this long and delete older ones, 0 for no limit
+	MaxBackups int      `json:"max_backups"`  // rotated files kept, 0 for all
 }
 
 type EncryptionConfig struct {
 	Enabled    bool   `json:"enabled"`
 	PublicKey  string `json:"public_key"`
-	PrivateKey string `json:"private_key"`
+	PrivateKey string `json:"private_key" secret:"true"`
+}
+
+// ProfilesConfig represents where server profiles are stored and what profiles
+// uploaded over the API may do
+type ProfilesConfig struct {
+	Dir          string   `json:"dir"`
+	AllowedSteps []string `json:"allowed_steps"` // step types API profiles may use, "*" for all; command steps also need commands.allowed
+	AllowedPaths []string `json:"allowed_paths"` // absolute directories file steps may write below
+}
+
+// AllowsStep reports whether API profiles may use steps of the given type
+func (c ProfilesConfig) AllowsStep(stepType string) bool {
+	return contains(c.AllowedSteps, "*") || contains(c.AllowedSteps, stepType)
+}
+
+// AllowsPath reports whether file steps may manage path, which lies below one
+// of the allowed directories
+func (c ProfilesConfig) AllowsPath(path string) bool {
+	path = filepath.Clean(path)
+	for _, dir := range c.AllowedPaths {
+		dir = filepath.Clean(dir)
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FactsConfig represents where host facts are read from
+type FactsConfig struct {
+	Root string `json:"root"`
+}
+
+// RuntimeConfig represents how the Node.js runtime for the embedded app is provisioned
+type RuntimeConfig struct {
+	Manifest   string `json:"manifest"`    // pinned versions and SHA-256 digests
+	Prefix     string `json:"prefix"`      // where runtimes are unpacked
+	BaseURL    string `json:"base_url"`    // mirror of https://nodejs.org/dist
+	OfflineDir string `json:"offline_dir"` // searched for bundled tarballs, defaults to the binary's directory
+	Offline    bool   `json:"offline"`     // never download
+}
+
+// BundleConfig represents where the embedded TypeScript app is extracted and how it is run
+type BundleConfig struct {
+	CacheDir     string `json:"cache_dir"`             // one subdirectory per bundled version
+	Entry        string `json:"entry"`                 // script node runs, relative to the extracted app
+	Restart      string `json:"restart"`               // on-failure (default), always or never
+	ReadyPipe    bool   `json:"ready_pipe"`            // the app writes "ready" to $SPI_READY_FD
+	HealthURL    string `json:"health_url"`            // or answers 2xx here once ready
+	ReadyTimeout int    `json:"ready_timeout_seconds"` // restart the app if it is not ready in time
+}
+
+// ShutdownConfig represents how running work is treated when the server stops
+type ShutdownConfig struct {
+	Timeout   int  `json:"timeout_seconds"` // deadline for the whole shutdown
+	DrainJobs bool `json:"drain_jobs"`      // let jobs and profile runs finish until the deadline instead of canceling them
+}
+
+// AuditConfig represents where the audit log is written
+type AuditConfig struct {
+	File string `json:"file"`
+}
+
+// ApprovalConfig represents which work waits for an operator on the console
+type ApprovalConfig struct {
+	Commands []string `json:"commands"`        // programs whose exec and jobs need approval, "*" for all
+	Steps    []string `json:"steps"`           // profile step types that need approval before changing the host, "*" for all
+	Timeout  int      `json:"timeout_seconds"` // how long a request waits before it is denied
+}
+
+// ForCommand reports whether running program needs approval
+func (c ApprovalConfig) ForCommand(program string) bool {
+	return contains(c.Commands, "*") || contains(c.Commands, program)
+}
+
+// ForStep reports whether a profile step of the given type needs approval
+func (c ApprovalConfig) ForStep(stepType string) bool {
+	return contains(c.Steps, "*") || contains(c.Steps, stepType)
+}
+
+// Wait returns how long a request waits for a decision
+func (c ApprovalConfig) Wait() time.Duration {
+	return time.Duration(c.Timeout) * time.Second
+}
+
+// MetricsConfig represents where the Prometheus metrics are served
+type MetricsConfig struct {
+	Listen string `json:"listen"`              // address of the metrics listener, empty turns it off
+	Token  string `json:"token" secret:"true"` // bearer token /metrics requires, needed unless listen is a loopback address
+}
+
+// TracingConfig represents where OpenTelemetry spans are exported
+type TracingConfig struct {
+	Exporter    string  `json:"exporter"`     // none (default), otlp, stdout or file
+	Endpoint    string  `json:"endpoint"`     // OTLP/HTTP collector, e.g. http://localhost:4318
+	File        string  `json:"file"`         // where the file exporter writes spans, one JSON document each
+	SampleRatio float64 `json:"sample_ratio"` // share of new traces recorded; requests with a traceparent follow the client's decision
 }
 
 // AppConfig holds the full application configuration
 type AppConfig struct {
-	Server     ServerConfig  `json:"server"`
-	Commands   CommandConfig `json:"commands"`
-	UI         UI            `json:"UI"`
-	Logging    Logging
+	Server     ServerConfig     `json:"server"`
+	Commands   CommandConfig    `json:"commands"`
+	UI         UI               `json:"UI"`
+	Logging    Logging          `json:"logging"`
 	Encryption EncryptionConfig `json:"encryption"`
+	Profiles   ProfilesConfig   `json:"profiles"`
+	Facts      FactsConfig      `json:"facts"`
+	Runtime    RuntimeConfig    `json:"runtime"`
+	App        BundleConfig     `json:"app"`
+	Shutdown   ShutdownConfig   `json:"shutdown"`
+	Audit      AuditConfig      `json:"audit"`
+	Approval   ApprovalConfig   `json:"approval"`
+	Metrics    MetricsConfig    `json:"metrics"`
+	Tracing    TracingConfig    `json:"tracing"`
 }
 
-var GlobalConfig *AppConfig
-
-// LoadAppConfig loads the JSON configuration from a file
+// LoadAppConfig loads the JSON configuration from a file. Unknown keys and
+// values of the wrong type are rejected; call Validate for semantic checks.
 func LoadAppConfig(path string) (*AppConfig, error) {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
 	config := &AppConfig{}
-	err = decoder.Decode(config)
-	if err != nil {
-		return nil, err
+	if err := decodeStrict(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
 
-	GlobalConfig = config
-
 	return config, nil
 }
+
+// decodeStrict decodes a single JSON document, rejecting unknown keys and
+// describing type errors by their key path
+func decodeStrict(data []byte, v any) error {
+	// Report every unknown key with its full path, not just the first
+	var doc map[string]any
+	if json.Unmarshal(data, &doc) == nil {
+		if unknown := unknownKeys(doc, reflect.TypeOf(v).Elem(), ""); len(unknown) > 0 {
+			return fmt.Errorf("unknown key(s) %s", strings.Join(unknown, ", "))
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			return errors.New("unexpected data after the configuration object")
+		}
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%s must be %s, got %s", typeErr.Field, describeType(typeErr.Type.Kind().String()), typeErr.Value)
+	case errors.As(err, &syntaxErr):
+		line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+		return fmt.Errorf("line %d: %v", line, err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("unknown key %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return err
+}
+
+func describeType(kind string) string {
+	switch kind {
+	case "int", "int64", "float64":
+		return "a number"
+	case "bool", "ptr":
+		return "true or false"
+	case "slice":
+		return "a list"
+	case "struct", "map":
+		return "an object"
+	}
+	return "a " + kind
+}
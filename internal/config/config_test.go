@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRepositoryConfigDecodesStrictly(t *testing.T) {
+	cfg, err := LoadAppConfig("../../config.json")
+	if err != nil {
+		t.Fatalf("config.json does not load: %v", err)
+	}
+	if cfg.Logging.Verbosity != "normal" {
+		t.Errorf("logging.verbosity was not decoded: %q", cfg.Logging.Verbosity)
+	}
+}
+
+func TestStrictDecodingErrors(t *testing.T) {
+	for _, tc := range []struct{ content, expected string }{
+		{`{"server": {"prot": 1}, "extra": true}`, "unknown key(s) extra, server.prot"},
+		{`{"server": {"port": "8443"}}`, "server.port must be a number"},
+		{`{"commands": {"allowed": "ls"}}`, "commands.allowed must be a list"},
+		{"{\n\"server\": {,}\n}", "line 2"},
+		{`{} {}`, "unexpected data"},
+	} {
+		_, err := LoadAppConfig(writeConfig(t, tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.content, tc.expected, err)
+		}
+	}
+}
+
+func TestValidateCollectsAllProblems(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key.pem")
+	os.WriteFile(key, nil, 0600)
+	disabled := false
+
+	cfg := &AppConfig{
+		Server:     ServerConfig{Port: 70000, TLSEnabled: true, CertFile: filepath.Join(dir, "missing.crt")},
+		Logging:    Logging{Verbosity: "loud"},
+		Encryption: EncryptionConfig{Enabled: true, PublicKey: key, PrivateKey: key},
+		Runtime:    RuntimeConfig{Manifest: dir, BaseURL: "ftp://mirror"},
+		App:        BundleConfig{Restart: "sometimes", ReadyTimeout: -1},
+	}
+	var validationErr *ValidationError
+	if err := cfg.Validate(); !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	var keys []string
+	for _, problem := range validationErr.Problems {
+		keys = append(keys, problem.Key)
+	}
+	expected := []string{"server.port", "server.tls_cert_file", "server.tls_key_file", "commands.allowed",
+		"logging.verbosity", "encryption.enabled", "runtime.manifest", "runtime.base_url", "app.restart", "app.ready_timeout_seconds"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Unexpected problems:\n got %v\nwant %v", keys, expected)
+	}
+
+	// With exec turned off an empty allowlist is fine
+	cfg = &AppConfig{
+		Commands:   CommandConfig{Enabled: &disabled},
+		Encryption: EncryptionConfig{PublicKey: key, PrivateKey: key},
+		Runtime:    RuntimeConfig{Manifest: key},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+
+	// Spans on stdout would be drawn over the UI
+	cfg.Tracing = TracingConfig{Exporter: "stdout", SampleRatio: 1}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected stdout spans without the UI to be valid, got %v", err)
+	}
+	cfg.UI.Enabled = true
+	if err := cfg.Validate(); !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 ||
+		validationErr.Problems[0].Key != "tracing.exporter" {
+		t.Errorf("Expected stdout spans with the UI to be refused, got %v", err)
+	}
+}
+
+func TestRepositoryConfigIsValid(t *testing.T) {
+	// Paths in config.json are relative to the repository root, where the server is started
+	wd, _ := os.Getwd()
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	resolved, err := Resolve(Options{SystemDir: t.TempDir(), File: "config.json", Env: []string{}})
+	if err != nil {
+		t.Fatalf("config.json does not resolve: %v", err)
+	}
+	if err := resolved.Config.Validate(); err != nil {
+		t.Errorf("config.json as shipped is invalid: %v", err)
+	}
+}
+
+// schemaKeys returns the dotted property paths of a JSON Schema object
+func schemaKeys(schema map[string]any, prefix string) []string {
+	var keys []string
+	properties, _ := schema["properties"].(map[string]any)
+	for name, property := range properties {
+		keys = append(keys, prefix+name)
+		if nested, ok := property.(map[string]any); ok && nested["type"] == "object" {
+			keys = append(keys, schemaKeys(nested, prefix+name+".")...)
+		}
+	}
+	return keys
+}
+
+// structKeys returns the dotted JSON key paths of a config struct
+func structKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys = append(keys, prefix+name)
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			keys = append(keys, structKeys(t.Field(i).Type, prefix+name+".")...)
+		}
+	}
+	return keys
+}
+
+func TestSchemaMatchesAppConfig(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+	inSchema := map[string]bool{}
+	for _, key := range schemaKeys(schema, "") {
+		inSchema[key] = true
+	}
+	for _, key := range structKeys(reflect.TypeOf(AppConfig{}), "") {
+		if !inSchema[key] {
+			t.Errorf("%s is missing from config.schema.json", key)
+		}
+		delete(inSchema, key)
+	}
+	for key := range inSchema {
+		t.Errorf("config.schema.json describes %s, which AppConfig does not have", key)
+	}
+}
+
+func TestProfilesAllowPathsBelowTheirDirectories(t *testing.T) {
+	c := ProfilesConfig{AllowedPaths: []string{"/srv/app", "/etc/nginx/"}}
+	for path, expected := range map[string]bool{
+		"/srv/app":                  true,
+		"/srv/app/config.json":      true,
+		"/etc/nginx/conf.d/x.conf":  true,
+		"/srv/application":          false,
+		"/etc/cron.d/x":             false,
+		"/srv/app/../../etc/passwd": false,
+	} {
+		if c.AllowsPath(path) != expected {
+			t.Errorf("AllowsPath(%s) should be %v", path, expected)
+		}
+	}
+}
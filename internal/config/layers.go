@@ -0,0 +1,392 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SystemDir is searched for config.json and config.yaml
+const SystemDir = "/etc/spi-go-core"
+
+// EnvPrefix starts every environment variable that sets a config key,
+// e.g. SPI_SERVER_PORT for server.port
+const EnvPrefix = "SPI_"
+
+// SourceDefault is the source of values nobody overrode
+const SourceDefault = "default"
+
+// Redacted replaces secret values in Effective
+const Redacted = "<redacted>"
+
+// Defaults returns the configuration used where no layer sets a value
+func Defaults() *AppConfig {
+	execEnabled := true
+	return &AppConfig{
+		Server: ServerConfig{
+			Port:     8443,
+			CertFile: "certs/server.crt",
+			KeyFile:  "certs/server.key",
+		},
+		Commands: CommandConfig{Enabled: &execEnabled, Allowed: []string{}},
+		UI:       UI{LogFile: "logs/subprocess.log", Scrollback: 5000, Renderer: "auto"},
+		Logging:  Logging{Verbosity: "normal", Format: "text", File: "logs/spi-go-core.log", MaxSizeMB: 10, MaxAgeDays: 7, MaxBackups: 5},
+		Encryption: EncryptionConfig{
+			PublicKey:  "certs/go_public_key.pem",
+			PrivateKey: "certs/go_private_key.pem",
+		},
+		Profiles: ProfilesConfig{Dir: "profiles", AllowedSteps: []string{"command"}, AllowedPaths: []string{}},
+		Facts:    FactsConfig{Root: "/"},
+		Runtime:  RuntimeConfig{Manifest: "node-manifest.json", Prefix: "runtime"},
+		App: BundleConfig{
+			CacheDir:     "app-cache",
+			Entry:        "dist/index.js",
+			Restart:      "on-failure",
+			ReadyTimeout: 30,
+		},
+		Shutdown: ShutdownConfig{Timeout: 30, DrainJobs: true},
+		Audit:    AuditConfig{File: "audit.log"},
+		Approval: ApprovalConfig{Commands: []string{}, Steps: []string{}, Timeout: 120},
+		Metrics:  MetricsConfig{Listen: "127.0.0.1:9464"},
+		Tracing:  TracingConfig{Exporter: "none", Endpoint: "http://localhost:4318", File: "logs/traces.jsonl", SampleRatio: 1},
+	}
+}
+
+// Options select the layers Resolve merges. The zero value reads the system
+// directory, ./config.json if present and the process environment.
+type Options struct {
+	SystemDir string            // defaults to SystemDir
+	File      string            // the --config path, ./config.json when empty
+	Env       []string          // defaults to os.Environ()
+	Flags     map[string]string // raw values by dotted key, see BindFlags
+}
+
+// Paths returns every config file Resolve would read with these options,
+// whether or not it exists yet
+func (o Options) Paths() []string {
+	dir := o.SystemDir
+	if dir == "" {
+		dir = SystemDir
+	}
+	file := o.File
+	if file == "" {
+		file = "config.json"
+	}
+	return []string{filepath.Join(dir, "config.json"), filepath.Join(dir, "config.yaml"), file}
+}
+
+// Resolved is a merged configuration together with where each value came from
+type Resolved struct {
+	Config  *AppConfig
+	Sources map[string]string // dotted key -> "default", a file path, "env SPI_..." or "flag --..."
+	Files   []string          // config files that were read, in order
+}
+
+// Setting is one key of the effective configuration
+type Setting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// leaf is a configurable value of AppConfig, addressed by its dotted JSON key
+type leaf struct {
+	key    string
+	index  []int
+	typ    reflect.Type
+	secret bool
+}
+
+// env returns the environment variable that sets the leaf
+func (l leaf) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(l.key, ".", "_"))
+}
+
+// leaves lists every configurable value of AppConfig in declaration order
+func leaves() []leaf {
+	var result []leaf
+	root := reflect.TypeOf(AppConfig{})
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		sectionName := jsonName(section)
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			result = append(result, leaf{
+				key:    sectionName + "." + jsonName(field),
+				index:  []int{i, j},
+				typ:    field.Type,
+				secret: field.Tag.Get("secret") == "true",
+			})
+		}
+	}
+	return result
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// Resolve merges built-in defaults, SystemDir/config.json and config.yaml,
+// the --config file, SPI_* environment variables and command-line flags, each
+// layer overriding the ones before. Every problem in every layer is reported
+// together with the layer it came from. Semantic checks are left to Validate.
+func Resolve(opts Options) (*Resolved, error) {
+	if opts.Env == nil {
+		opts.Env = os.Environ()
+	}
+
+	all := leaves()
+	cfg := Defaults()
+	resolved := &Resolved{Config: cfg, Sources: map[string]string{}}
+	for _, l := range all {
+		resolved.Sources[l.key] = SourceDefault
+	}
+	var problems []Problem
+	set := func(l leaf, value reflect.Value, source string) {
+		reflect.ValueOf(cfg).Elem().FieldByIndex(l.index).Set(value)
+		resolved.Sources[l.key] = source
+	}
+
+	// Files: the system directory, then --config (or ./config.json)
+	files := opts.Paths()
+	for i, path := range files {
+		explicit := i == len(files)-1 && opts.File != ""
+		doc, err := readDocument(path)
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved.Files = append(resolved.Files, path)
+		for _, key := range unknownKeys(doc, reflect.TypeOf(AppConfig{}), "") {
+			problems = append(problems, Problem{Key: key, Message: "unknown key in " + path})
+		}
+		for _, l := range all {
+			raw, ok := lookup(doc, l.key)
+			if !ok {
+				continue
+			}
+			value, err := convertDocument(raw, l.typ)
+			if err != nil {
+				problems = append(problems, Problem{Key: l.key, Message: fmt.Sprintf("must be %s in %s", describeType(l.typ.Kind().String()), path)})
+				continue
+			}
+			set(l, value, path)
+		}
+	}
+
+	// Environment variables
+	env := map[string]string{}
+	for _, entry := range opts.Env {
+		if name, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(name, EnvPrefix) {
+			env[name] = value
+		}
+	}
+	for _, l := range all {
+		raw, ok := env[l.env()]
+		if !ok {
+			continue
+		}
+		value, err := convertString(raw, l.typ)
+		if err != nil {
+			problems = append(problems, Problem{Key: l.key, Message: fmt.Sprintf("%s must be %s, got %q", l.env(), describeType(l.typ.Kind().String()), raw)})
+			continue
+		}
+		set(l, value, "env "+l.env())
+	}
+
+	// Command-line flags
+	for _, l := range all {
+		raw, ok := opts.Flags[l.key]
+		if !ok {
+			continue
+		}
+		value, err := convertString(raw, l.typ)
+		if err != nil {
+			problems = append(problems, Problem{Key: l.key, Message: fmt.Sprintf("--%s must be %s, got %q", l.key, describeType(l.typ.Kind().String()), raw)})
+			continue
+		}
+		set(l, value, "flag --"+l.key)
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return resolved, nil
+}
+
+// Effective lists every key with its value and source. Secrets and
+// credentials embedded in URLs are redacted.
+func (r *Resolved) Effective() []Setting {
+	var settings []Setting
+	root := reflect.ValueOf(r.Config).Elem()
+	for _, l := range leaves() {
+		value := root.FieldByIndex(l.index)
+		var shown any
+		switch {
+		case l.typ.Kind() == reflect.Ptr && value.IsNil():
+			shown = nil
+		case l.typ.Kind() == reflect.Ptr:
+			shown = value.Elem().Interface()
+		default:
+			shown = value.Interface()
+		}
+		if s, ok := shown.(string); ok {
+			switch {
+			case l.secret && s != "":
+				shown = Redacted
+			case strings.Contains(s, "://"):
+				shown = redactURL(s)
+			}
+		}
+		settings = append(settings, Setting{Key: l.key, Value: shown, Source: r.Sources[l.key]})
+	}
+	return settings
+}
+
+// BindFlags defines a flag on fs for every config key, named by its dotted key
+// (e.g. --server.port). The returned map holds the raw value of each flag that
+// was set once fs has been parsed; pass it as Options.Flags.
+func BindFlags(fs *flag.FlagSet) map[string]string {
+	values := map[string]string{}
+	for _, l := range leaves() {
+		isBool := l.typ.Kind() == reflect.Bool || l.typ == reflect.TypeOf((*bool)(nil))
+		fs.Var(&flagValue{key: l.key, values: values, isBool: isBool}, l.key, "overrides "+l.key+" (env "+l.env()+")")
+	}
+	return values
+}
+
+// flagValue records the raw value of a config flag; Resolve converts it
+type flagValue struct {
+	key    string
+	values map[string]string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return f.values[f.key]
+}
+
+func (f *flagValue) Set(value string) error {
+	f.values[f.key] = value
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+// readDocument decodes a JSON or YAML (by extension) config file into a generic document
+func readDocument(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		// The strict decoder reports syntax errors by line and rejects unknown keys
+		if err := decodeStrict(data, &AppConfig{}); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		json.Unmarshal(data, &doc)
+	}
+	return doc, nil
+}
+
+// lookup finds a dotted key in doc, matching each part case-insensitively as
+// encoding/json does
+func lookup(doc map[string]any, key string) (any, bool) {
+	var current any = doc
+	for _, part := range strings.Split(key, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		value, found := object[part]
+		if !found {
+			for name, candidate := range object {
+				if strings.EqualFold(name, part) {
+					value, found = candidate, true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, false
+		}
+		current = value
+	}
+	return current, true
+}
+
+// convertDocument converts a decoded JSON or YAML value to typ
+func convertDocument(raw any, typ reflect.Type) (reflect.Value, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	value := reflect.New(typ)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return value.Elem(), nil
+}
+
+// convertString converts an environment or flag value to typ. Lists are
+// comma-separated.
+func convertString(raw string, typ reflect.Type) (reflect.Value, error) {
+	switch typ.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(raw), nil
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		return reflect.ValueOf(n), err
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		return reflect.ValueOf(f), err
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		return reflect.ValueOf(b), err
+	case reflect.Ptr:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		return reflect.ValueOf(&b), err
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return reflect.ValueOf(items), nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported type %s", typ)
+}
+
+// redactURL hides the password of a URL with user info
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReloadStatus describes the running configuration and the last reload attempt
+type ReloadStatus struct {
+	Generation  int        `json:"generation"` // 1 at startup, incremented by every successful reload
+	Files       []string   `json:"files"`
+	LoadedAt    time.Time  `json:"loaded_at"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastTrigger string     `json:"last_trigger,omitempty"` // e.g. SIGHUP, file change or admin
+	LastError   string     `json:"last_error,omitempty"`   // empty unless the last reload failed
+	Problems    []Problem  `json:"problems,omitempty"`
+}
+
+// Store holds the running configuration. A reload resolves and validates a
+// new configuration and swaps it in atomically, so readers see either the old
+// or the new one, never a mix. A failed reload keeps the old configuration.
+type Store struct {
+	// Apply puts next into effect before it is swapped in; an error aborts the reload
+	Apply func(old, next *AppConfig) error
+	// Reported is called after every reload attempt with its outcome
+	Reported func(trigger string, err error)
+
+	load     func() (*Resolved, error)
+	current  atomic.Pointer[AppConfig]
+	resolved atomic.Pointer[Resolved]
+	reload   sync.Mutex // one reload at a time
+	mu       sync.Mutex // guards status
+	status   ReloadStatus
+}
+
+// NewStore starts with the resolved startup configuration; load resolves it
+// again on every reload
+func NewStore(resolved *Resolved, load func() (*Resolved, error)) *Store {
+	s := &Store{load: load}
+	s.swap(resolved)
+	return s
+}
+
+// Static returns a store that always holds cfg and cannot be reloaded
+func Static(cfg *AppConfig) *Store {
+	return NewStore(&Resolved{Config: cfg}, nil)
+}
+
+// Current returns the running configuration, which must not be modified
+func (s *Store) Current() *AppConfig {
+	return s.current.Load()
+}
+
+// Status returns a copy of the reload status
+func (s *Store) Status() ReloadStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Files = append([]string(nil), status.Files...)
+	status.Problems = append([]Problem(nil), status.Problems...)
+	return status
+}
+
+// Reload resolves, validates and applies a new configuration. trigger names
+// what asked for it and is kept in the status.
+func (s *Store) Reload(trigger string) error {
+	s.reload.Lock()
+	defer s.reload.Unlock()
+
+	if s.load == nil {
+		return errors.New("this configuration cannot be reloaded")
+	}
+	resolved, err := s.load()
+	if err == nil {
+		err = resolved.Config.Validate()
+	}
+	if err == nil && s.Apply != nil {
+		err = s.Apply(s.Current(), resolved.Config)
+	}
+
+	attempted := time.Now()
+	s.mu.Lock()
+	s.status.LastAttempt = &attempted
+	s.status.LastTrigger = trigger
+	s.status.LastError = ""
+	s.status.Problems = nil
+	if err != nil {
+		s.status.LastError = err.Error()
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			s.status.Problems = validationErr.Problems
+		}
+	}
+	s.mu.Unlock()
+	if err == nil {
+		s.swap(resolved)
+	}
+
+	if s.Reported != nil {
+		s.Reported(trigger, err)
+	}
+	return err
+}
+
+// Effective lists the running configuration key by key with its source,
+// secrets redacted
+func (s *Store) Effective() []Setting {
+	return s.resolved.Load().Effective()
+}
+
+func (s *Store) swap(resolved *Resolved) {
+	s.resolved.Store(resolved)
+	s.current.Store(resolved.Config)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Generation++
+	s.status.Files = resolved.Files
+	s.status.LoadedAt = time.Now()
+}
+
+// fileState is what Watch compares between polls
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// Watch polls paths every interval and calls changed once per poll in which
+// any of them was created, removed or modified, until ctx is done. Polling
+// also notices files that editors replace instead of rewriting.
+func Watch(ctx context.Context, paths []string, interval time.Duration, changed func()) {
+	states := make([]fileState, len(paths))
+	for i, path := range paths {
+		states[i] = statFile(path)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modified := false
+		for i, path := range paths {
+			if state := statFile(path); state != states[i] {
+				states[i] = state
+				modified = true
+			}
+		}
+		if modified {
+			changed()
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreKeepsTheRunningConfigWhenApplyFails(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key.pem")
+	os.WriteFile(key, nil, 0600)
+	next := &AppConfig{
+		Commands:   CommandConfig{Allowed: []string{"ls"}},
+		Encryption: EncryptionConfig{PublicKey: key, PrivateKey: key},
+		Runtime:    RuntimeConfig{Manifest: key},
+	}
+	initial := &AppConfig{}
+	store := NewStore(&Resolved{Config: initial}, func() (*Resolved, error) {
+		return &Resolved{Config: next, Files: []string{"next.json"}}, nil
+	})
+	var reported []error
+	store.Reported = func(trigger string, err error) { reported = append(reported, err) }
+
+	store.Apply = func(old, next *AppConfig) error { return errors.New("certificate does not load") }
+	if err := store.Reload("test"); err == nil || store.Current() != initial || store.Status().LastError != "certificate does not load" {
+		t.Errorf("Expected the reload to fail and keep the config, got %v, %+v", err, store.Status())
+	}
+
+	store.Apply = nil
+	if err := store.Reload("test"); err != nil || store.Current() != next {
+		t.Fatalf("Expected the new config to be swapped in, got %v", err)
+	}
+	if status := store.Status(); status.Generation != 2 || status.LastError != "" || status.Files[0] != "next.json" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if len(reported) != 2 || reported[0] == nil || reported[1] != nil {
+		t.Errorf("Expected both attempts to be reported, got %v", reported)
+	}
+}
+
+func TestWatchNoticesCreatedAndModifiedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	changes := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, []string{path}, 10*time.Millisecond, func() { changes <- struct{}{} })
+
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("No change reported after the file was %s", what)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(path, []byte("server:\n  port: 1\n"), 0644)
+	expectChange("created")
+	os.WriteFile(path, []byte("server:\n  port: 12\n"), 0644)
+	expectChange("modified")
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Problem is one thing wrong with a configuration
+type Problem struct {
+	Key     string `json:"key"` // dotted path, e.g. server.tls_cert_file
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return p.Key + ": " + p.Message
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.String()
+	}
+	return fmt.Sprintf("%d configuration problem(s): %s", len(e.Problems), strings.Join(messages, "; "))
+}
+
+// Verbosities are the accepted logging.verbosity values
+var Verbosities = []string{"quiet", "normal", "verbose", "debug"}
+
+// RestartPolicies are the accepted app.restart values
+var RestartPolicies = []string{"on-failure", "always", "never"}
+
+// LogFormats are the accepted logging.format values
+var LogFormats = []string{"text", "json"}
+
+// TracingExporters are the accepted tracing.exporter values
+var TracingExporters = []string{"none", "otlp", "stdout", "file"}
+
+// LogComponents are the components logging.levels may name
+var LogComponents = []string{"server", "config", "handshake", "exec", "setup", "app", "ui"}
+
+// LogLevels are the levels logging.levels may set
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Renderers are the accepted UI.renderer values
+var Renderers = []string{"auto", "tui", "plain", "json"}
+
+// StepTypes are the profile step types approval.steps and profiles.allowed_steps may name
+var StepTypes = []string{"package", "file", "user", "service", "command"}
+
+// Validate checks the configuration as a whole and reports every problem it
+// finds rather than stopping at the first. Relative paths are resolved
+// against the working directory, as they are at runtime.
+func (c *AppConfig) Validate() error {
+	var problems []Problem
+	add := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+	requireFile := func(key, path string) {
+		if path == "" {
+			add(key, "is required")
+		} else if info, err := os.Stat(path); err != nil {
+			add(key, "%s does not exist", path)
+		} else if info.IsDir() {
+			add(key, "%s is a directory", path)
+		}
+	}
+
+	// Port 0 selects the default 8443
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		add("server.port", "%d is not between 1 and 65535", c.Server.Port)
+	}
+	if c.Server.TLSEnabled {
+		requireFile("server.tls_cert_file", c.Server.CertFile)
+		requireFile("server.tls_key_file", c.Server.KeyFile)
+	}
+
+	if c.Commands.ExecEnabled() && len(c.Commands.Allowed) == 0 {
+		add("commands.allowed", "is empty while exec is enabled (set commands.enabled to false to turn exec off)")
+	}
+	for i, command := range c.Commands.Allowed {
+		if strings.TrimSpace(command) == "" || strings.ContainsAny(command, " \t\n") {
+			add(fmt.Sprintf("commands.allowed[%d]", i), "%q must be a single program name", command)
+		}
+	}
+
+	if c.UI.Scrollback < 0 {
+		add("UI.scrollback", "must not be negative")
+	}
+	if c.UI.Renderer != "" && !contains(Renderers, c.UI.Renderer) {
+		add("UI.renderer", "%q is not one of %s", c.UI.Renderer, strings.Join(Renderers, ", "))
+	}
+
+	if c.Logging.Verbosity != "" && !contains(Verbosities, c.Logging.Verbosity) {
+		add("logging.verbosity", "%q is not one of %s", c.Logging.Verbosity, strings.Join(Verbosities, ", "))
+	}
+	if c.Logging.Format != "" && !contains(LogFormats, c.Logging.Format) {
+		add("logging.format", "%q is not one of %s", c.Logging.Format, strings.Join(LogFormats, ", "))
+	}
+	for i, entry := range c.Logging.Levels {
+		component, level, _ := strings.Cut(entry, "=")
+		switch {
+		case !contains(LogComponents, component):
+			add(fmt.Sprintf("logging.levels[%d]", i), "%q does not name one of %s", entry, strings.Join(LogComponents, ", "))
+		case !contains(LogLevels, level):
+			add(fmt.Sprintf("logging.levels[%d]", i), "%q does not set one of %s", entry, strings.Join(LogLevels, ", "))
+		}
+	}
+	if c.Logging.MaxSizeMB < 0 || c.Logging.MaxAgeDays < 0 || c.Logging.MaxBackups < 0 {
+		add("logging", "max_size_mb, max_age_days and max_backups must not be negative")
+	}
+
+	// The handshake always needs the core key pair
+	if c.Encryption.Enabled {
+		add("encryption.enabled", "is not supported yet: /api/exec cannot decrypt commands")
+	}
+	requireFile("encryption.public_key", c.Encryption.PublicKey)
+	requireFile("encryption.private_key", c.Encryption.PrivateKey)
+
+	for i, step := range c.Profiles.AllowedSteps {
+		if step != "*" && !contains(StepTypes, step) {
+			add(fmt.Sprintf("profiles.allowed_steps[%d]", i), "%q is not one of %s or *", step, strings.Join(StepTypes, ", "))
+		}
+	}
+	for i, dir := range c.Profiles.AllowedPaths {
+		if !filepath.IsAbs(dir) {
+			add(fmt.Sprintf("profiles.allowed_paths[%d]", i), "%q must be absolute", dir)
+		}
+	}
+
+	if c.Facts.Root != "" {
+		if info, err := os.Stat(c.Facts.Root); err != nil || !info.IsDir() {
+			add("facts.root", "%s is not a directory", c.Facts.Root)
+		}
+	}
+
+	// Without a manifest Node.js is not provisioned and the core serves the API only
+	manifest := c.Runtime.Manifest
+	if manifest == "" {
+		manifest = "node-manifest.json"
+	}
+	if info, err := os.Stat(manifest); err == nil && info.IsDir() {
+		add("runtime.manifest", "%s is a directory", manifest)
+	}
+	if c.Runtime.BaseURL != "" && !isHTTPURL(c.Runtime.BaseURL) {
+		add("runtime.base_url", "%q is not an http(s) URL", c.Runtime.BaseURL)
+	}
+
+	if c.App.Restart != "" && !contains(RestartPolicies, c.App.Restart) {
+		add("app.restart", "%q is not one of %s", c.App.Restart, strings.Join(RestartPolicies, ", "))
+	}
+	if c.App.HealthURL != "" && !isHTTPURL(c.App.HealthURL) {
+		add("app.health_url", "%q is not an http(s) URL", c.App.HealthURL)
+	}
+	if c.App.ReadyTimeout < 0 {
+		add("app.ready_timeout_seconds", "must not be negative")
+	}
+	if c.Shutdown.Timeout < 0 {
+		add("shutdown.timeout_seconds", "must not be negative")
+	}
+	if c.Audit.File != "" {
+		if info, err := os.Stat(filepath.Dir(c.Audit.File)); err != nil || !info.IsDir() {
+			add("audit.file", "directory of %s does not exist", c.Audit.File)
+		}
+	}
+
+	for i, command := range c.Approval.Commands {
+		if strings.TrimSpace(command) == "" || strings.ContainsAny(command, " \t\n") {
+			add(fmt.Sprintf("approval.commands[%d]", i), "%q must be a single program name or *", command)
+		}
+	}
+	for i, step := range c.Approval.Steps {
+		if step != "*" && !contains(StepTypes, step) {
+			add(fmt.Sprintf("approval.steps[%d]", i), "%q is not one of %s or *", step, strings.Join(StepTypes, ", "))
+		}
+	}
+	if c.Approval.Timeout < 0 {
+		add("approval.timeout_seconds", "must not be negative")
+	}
+
+	if c.Metrics.Listen != "" {
+		if host, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			add("metrics.listen", "%q is not a host:port address", c.Metrics.Listen)
+		} else if c.Metrics.Token == "" && !isLoopback(host) {
+			add("metrics.token", "is required when metrics.listen is not a loopback address")
+		}
+	}
+
+	if c.Tracing.Exporter != "" && !contains(TracingExporters, c.Tracing.Exporter) {
+		add("tracing.exporter", "%q is not one of %s", c.Tracing.Exporter, strings.Join(TracingExporters, ", "))
+	}
+	if c.Tracing.Exporter == "stdout" && c.UI.Enabled {
+		add("tracing.exporter", "stdout is taken by the UI while UI.enabled is true, use file or otlp")
+	}
+	if c.Tracing.Exporter == "otlp" && !isHTTPURL(c.Tracing.Endpoint) {
+		add("tracing.endpoint", "%q is not an http(s) URL", c.Tracing.Endpoint)
+	}
+	if c.Tracing.Exporter == "file" && c.Tracing.File == "" {
+		add("tracing.file", "is required when tracing.exporter is file")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// unknownKeys returns the dotted paths of every key in doc that has no field in t
+func unknownKeys(doc map[string]any, t reflect.Type, prefix string) []string {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+
+	var unknown []string
+	for key, value := range doc {
+		// encoding/json matches keys case-insensitively
+		fieldType, ok := fields[key]
+		if !ok {
+			for name, candidate := range fields {
+				if strings.EqualFold(name, key) {
+					fieldType, ok = candidate, true
+					break
+				}
+			}
+		}
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+		if nested, isObject := value.(map[string]any); isObject && fieldType.Kind() == reflect.Struct {
+			unknown = append(unknown, unknownKeys(nested, fieldType, prefix+key+".")...)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// isLoopback reports whether host only accepts connections from this machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
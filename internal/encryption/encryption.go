@@ -3,81 +3,91 @@ package encryption
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
-	"log"
-	mathRand "math/rand"
 	"os"
 	"spi-go-core/helpers"
-	"spi-go-core/internal/config"
-	"sync"
-	"time"
+	"spi-go-core/internal/logging"
 )
 
-type ConnectionData struct {
-	PublicKey       *rsa.PublicKey
-	Timestamp       time.Time
-	ChallengeSecret string
-	Validated       bool
-}
-
-var (
-	TsAppPublicKey      *rsa.PublicKey
-	ConnectionValidated = false
-	connectionLock      sync.Mutex
-	connectionDataMap   = make(map[string]ConnectionData)
-	connectionDataMux   = sync.RWMutex{}
-)
+// keyLog is the log of the handshake component; key paths and key material stay out of it
+var keyLog = logging.For(logging.Handshake)
 
 const charset = "abcdefghijklmnopqrstuvwxyz" +
 	"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
 	"0123456789"
 
-// GenerateRandomString returns a random string of length n
+// GenerateRandomString returns a random string of length n from a
+// cryptographically secure source, fit for secrets such as challenges
 func GenerateRandomString(n int) string {
-	seededRand := mathRand.New(mathRand.NewSource(time.Now().UnixNano())) // Use mathRand alias
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+	// Bytes from the top of the range that charset does not divide evenly are
+	// skipped, so every character is equally likely
+	limit := byte(256 - 256%len(charset))
+	b := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(b) < n {
+		if _, err := rand.Read(buf); err != nil {
+			panic("Failed to generate random string")
+		}
+		for _, r := range buf {
+			if r < limit && len(b) < n {
+				b = append(b, charset[int(r)%len(charset)])
+			}
+		}
 	}
 	return string(b)
 }
 
-// LoadGoKeys loads Go core private and public keys
-func LoadGoKeys() (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	log.Printf("Trying to read private key in %s...", config.GlobalConfig.Encryption.PrivateKey)
-	pathPrivateKey, _ := helpers.ResolvePath(config.GlobalConfig.Encryption.PrivateKey)
-	log.Printf("Resolving path %s...", pathPrivateKey)
+// LoadGoKeys loads Go core private and public keys from the PEM files at the given paths
+func LoadGoKeys(privateKeyPath, publicKeyPath string) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	keyLog.Debug("Reading private key")
+	pathPrivateKey, _ := helpers.ResolvePath(privateKeyPath)
 	privateKeyFile, err := os.ReadFile(pathPrivateKey)
 	if err != nil {
 		return nil, nil, err
 	}
 	block, _ := pem.Decode(privateKeyFile)
 	if block == nil {
-		log.Println("Failed to decode private key PEM block")
 		return nil, nil, errors.New("failed to decode private key PEM block")
 	}
 	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, nil, err
 	}
-	log.Printf("Successfully read private key.")
+	keyLog.Debug("Read private key")
 
-	log.Println("Trying to read public key...")
-	publicKeyFile, err := os.ReadFile(config.GlobalConfig.Encryption.PublicKey)
+	publicKey, err := loadPublicKey(publicKeyPath)
 	if err != nil {
 		return nil, nil, err
 	}
+	return privateKey.(*rsa.PrivateKey), publicKey, nil
+}
+
+// loadPublicKey reads Go core's PKIX public key from a PEM file
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	keyLog.Debug("Reading public key")
+	publicKeyFile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 	blockPub, _ := pem.Decode(publicKeyFile)
+	if blockPub == nil {
+		return nil, errors.New("failed to decode public key PEM block")
+	}
 	publicKey, err := x509.ParsePKIXPublicKey(blockPub.Bytes)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	log.Printf("Successfully read public key.")
-
-	return privateKey.(*rsa.PrivateKey), publicKey.(*rsa.PublicKey), nil
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("invalid public key type, expected RSA")
+	}
+	keyLog.Debug("Read public key")
+	return rsaKey, nil
 }
 
 // ParsePublicKey parses a PEM-encoded public key string and returns an *rsa.PublicKey
@@ -132,50 +142,9 @@ func GenerateReqId() string {
 	return requestID
 }
 
-// IsConnectionValidated checks if a connection is validated for a given request ID
-func IsConnectionValidated(requestID string) bool {
-	connectionLock.Lock()
-	defer connectionLock.Unlock()
-
-	connData, exists := connectionDataMap[requestID]
-	if !exists {
-		return false
-	}
-
-	// Add expiration logic if needed (e.g., 5 minutes)
-	if time.Since(connData.Timestamp) > 5*time.Minute {
-		delete(connectionDataMap, requestID)
-		return false
-	}
-
-	return true
-}
-
-// StoreConnectionData stores connection data for a session
-func StoreConnectionData(sessionID string, data ConnectionData) {
-	log.Printf("Storing connection data for Session ID %s...", sessionID)
-	connectionDataMux.Lock()
-	defer connectionDataMux.Unlock()
-	connectionDataMap[sessionID] = data
-}
-
-// StoreTsAppPublicKey stores the TypeScript app's public key
-func StoreTsAppPublicKey(pemKey string) error {
-	block, _ := pem.Decode([]byte(pemKey))
-	if block == nil {
-		return errors.New("failed to decode PEM block containing public key")
-	}
-	tsAppPublicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return err
-	}
-	TsAppPublicKey = tsAppPublicKey.(*rsa.PublicKey)
-	return nil
-}
-
-// GetGoCorePublicKeyPEM returns Go core's public key in PEM format
-func GetGoCorePublicKeyPEM() (string, error) {
-	_, goPublicKey, err := LoadGoKeys()
+// GetGoCorePublicKeyPEM returns Go core's public key, read from publicKeyPath, in PEM format
+func GetGoCorePublicKeyPEM(publicKeyPath string) (string, error) {
+	goPublicKey, err := loadPublicKey(publicKeyPath)
 	if err != nil {
 		return "", err
 	}
@@ -190,12 +159,13 @@ func GetGoCorePublicKeyPEM() (string, error) {
 	return string(goCorePublicKeyPEM), nil
 }
 
-func GetConnectionData(sessionID string) (ConnectionData, error) {
-	connectionDataMux.RLock()
-	defer connectionDataMux.RUnlock()
-	data, exists := connectionDataMap[sessionID]
-	if !exists {
-		return ConnectionData{}, errors.New("session not found")
-	}
-	return data, nil
+// Fingerprint returns the SHA-256 of the PKIX encoding of key in hex, or ""
+// if it cannot be encoded
+func Fingerprint(key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
 }
@@ -2,28 +2,30 @@ package encryption
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"path/filepath"
 	"spi-go-core/internal/config"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestEncryptionDecryption(t *testing.T) {
 	// Load the configuration as before
-	configPath, err := filepath.Abs("../../config.json")
-	if err != nil {
-		t.Fatalf("Failed to get absolute path of config.json: %v", err)
-	}
-	_, err = config.LoadAppConfig(configPath)
+	cfg, err := config.LoadAppConfig("../../config.json")
 	if err != nil {
 		t.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Adjust the paths in the configuration to be correct relative to the test directory
-	config.GlobalConfig.Encryption.PrivateKey = filepath.Join("../../", config.GlobalConfig.Encryption.PrivateKey)
-	config.GlobalConfig.Encryption.PublicKey = filepath.Join("../../", config.GlobalConfig.Encryption.PublicKey)
+	// The paths in the configuration are relative to the repository root
+	privateKeyPath := filepath.Join("../../", cfg.Encryption.PrivateKey)
+	publicKeyPath := filepath.Join("../../", cfg.Encryption.PublicKey)
 
 	// Load the Go core private and public keys as before
-	privateKey, publicKey, err := LoadGoKeys()
+	privateKey, publicKey, err := LoadGoKeys(privateKeyPath, publicKeyPath)
 	if err != nil {
 		t.Fatalf("Failed to load Go keys: %v", err)
 	}
@@ -53,3 +55,90 @@ func TestEncryptionDecryption(t *testing.T) {
 		t.Logf("Encryption and decryption successful. Message: %s", decryptedMessage)
 	}
 }
+
+func TestSessionsAndRevoke(t *testing.T) {
+	store := NewSessionStore(DefaultSessionTTL)
+	store.Store("old", ConnectionData{Timestamp: time.Now().Add(-time.Minute), Client: "10.0.0.1:5000", Validated: true})
+	store.Store("new", ConnectionData{Timestamp: time.Now(), Client: "10.0.0.2:5000"})
+	store.Store("expired", ConnectionData{Timestamp: time.Now().Add(-2 * DefaultSessionTTL)})
+
+	sessions := store.List()
+	if len(sessions) != 2 || sessions[0].ID != "old" || sessions[1].ID != "new" || !sessions[0].Validated || sessions[1].Client != "10.0.0.2:5000" {
+		t.Fatalf("Expected the two live sessions oldest first, got %+v", sessions)
+	}
+	if !store.Revoke("old") || store.Revoke("old") {
+		t.Error("Expected the first revoke to find the session and the second not to")
+	}
+	if _, err := store.Get("old"); err == nil {
+		t.Error("A revoked session should be gone")
+	}
+}
+
+func TestStoreDropsExpiredSessions(t *testing.T) {
+	store := NewSessionStore(DefaultSessionTTL)
+	for i := range 100 {
+		store.Store(fmt.Sprint("abandoned-", i), ConnectionData{Timestamp: time.Now().Add(-2 * DefaultSessionTTL)})
+	}
+	store.Store("live", ConnectionData{Timestamp: time.Now()})
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if _, live := store.sessions["live"]; len(store.sessions) != 1 || !live {
+		t.Errorf("Expected only the live session to be kept, got %d sessions", len(store.sessions))
+	}
+}
+
+func TestGenerateRandomStringUsesTheCharset(t *testing.T) {
+	a, b := GenerateRandomString(64), GenerateRandomString(64)
+	if len(a) != 64 || a == b {
+		t.Fatalf("Expected two different strings of 64 characters, got %q and %q", a, b)
+	}
+	for _, c := range a + b {
+		if !strings.ContainsRune(charset, c) {
+			t.Errorf("Unexpected character %q", c)
+		}
+	}
+}
+
+func TestCompleteHandshakeBurnsTheChallenge(t *testing.T) {
+	store := NewSessionStore(DefaultSessionTTL)
+	store.Store("burn", ConnectionData{Timestamp: time.Now(), ChallengeSecret: "secret"})
+
+	if matched, err := store.CompleteHandshake("burn", []byte("guess")); matched || err != nil {
+		t.Fatalf("Expected a wrong secret to fail, got %v, %v", matched, err)
+	}
+	// The wrong guess burned the challenge, so the right secret is too late
+	if matched, err := store.CompleteHandshake("burn", []byte("secret")); matched || err != nil || store.IsValidated("burn") {
+		t.Errorf("Expected the burned challenge to fail, got %v, %v", matched, err)
+	}
+
+	store.Store("burn", ConnectionData{Timestamp: time.Now(), ChallengeSecret: "secret"})
+	if matched, err := store.CompleteHandshake("burn", []byte("secret")); !matched || err != nil || !store.IsValidated("burn") {
+		t.Errorf("Expected the secret to validate the session, got %v, %v", matched, err)
+	}
+	if _, err := store.CompleteHandshake("burn", []byte("secret")); !errors.Is(err, ErrHandshakeCompleted) {
+		t.Errorf("Expected a second completion to be refused, got %v", err)
+	}
+}
+
+func TestConcurrentReplaysCompleteTheHandshakeOnce(t *testing.T) {
+	store := NewSessionStore(DefaultSessionTTL)
+	store.Store("replayed", ConnectionData{Timestamp: time.Now(), ChallengeSecret: "secret"})
+
+	const attempts = 32
+	var succeeded atomic.Int32
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if matched, _ := store.CompleteHandshake("replayed", []byte("secret")); matched {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded.Load() != 1 {
+		t.Errorf("Expected exactly one of %d replays to complete the handshake, %d did", attempts, succeeded.Load())
+	}
+}
@@ -0,0 +1,171 @@
+package encryption
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ConnectionData struct {
+	PublicKey       *rsa.PublicKey
+	Timestamp       time.Time
+	ChallengeSecret string
+	Validated       bool
+	Client          string // address of the client that started the key exchange
+}
+
+// Session describes an active session without its secrets
+type Session struct {
+	ID        string    `json:"id"`
+	Client    string    `json:"client"`
+	Started   time.Time `json:"started"`
+	Expires   time.Time `json:"expires"`
+	Validated bool      `json:"validated"`
+	// KeyFingerprint is the SHA-256 of the client's public key
+	KeyFingerprint string `json:"keyFingerprint"`
+}
+
+// DefaultSessionTTL is how long a session stays usable after the key exchange
+const DefaultSessionTTL = 5 * time.Minute
+
+// ErrHandshakeCompleted is returned when a session that is already validated
+// is finalized again
+var ErrHandshakeCompleted = errors.New("handshake already completed")
+
+// SessionStore holds the sessions of the handshake. Create it with
+// NewSessionStore; it is safe for concurrent use.
+type SessionStore struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	sessions map[string]ConnectionData
+}
+
+// NewSessionStore returns an empty store whose sessions expire ttl after the key exchange
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{ttl: ttl, sessions: make(map[string]ConnectionData)}
+}
+
+// TTL returns how long sessions stay usable after the key exchange
+func (s *SessionStore) TTL() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ttl
+}
+
+// SetTTL changes how long sessions stay usable, for sessions already stored as well
+func (s *SessionStore) SetTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ttl = ttl
+}
+
+// IsValidated checks if a session has completed the handshake
+func (s *SessionStore) IsValidated(sessionID string) bool {
+	data, active := s.active(sessionID)
+	return active && data.Validated
+}
+
+// IsActive checks if a session exists and has not expired, whether or not the handshake is complete
+func (s *SessionStore) IsActive(sessionID string) bool {
+	_, active := s.active(sessionID)
+	return active
+}
+
+// active returns the connection data for a session, dropping it once it has expired
+func (s *SessionStore) active(sessionID string) (ConnectionData, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.sessions[sessionID]
+	if !exists {
+		return ConnectionData{}, false
+	}
+	if time.Since(data.Timestamp) > s.ttl {
+		delete(s.sessions, sessionID)
+		return ConnectionData{}, false
+	}
+	return data, true
+}
+
+// Store stores the connection data of a session. Expired sessions are
+// dropped first, so key exchanges that are never finished do not pile up.
+func (s *SessionStore) Store(sessionID string, data ConnectionData) {
+	keyLog.Debug("Storing connection data", "session", sessionID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, other := range s.sessions {
+		if time.Since(other.Timestamp) > s.ttl {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[sessionID] = data
+}
+
+// Get returns the connection data of a session, expired or not
+func (s *SessionStore) Get(sessionID string) (ConnectionData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, exists := s.sessions[sessionID]
+	if !exists {
+		return ConnectionData{}, errors.New("session not found")
+	}
+	return data, nil
+}
+
+// List lists the sessions that have not expired, oldest first
+func (s *SessionStore) List() []Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]Session, 0, len(s.sessions))
+	for id, data := range s.sessions {
+		if time.Since(data.Timestamp) > s.ttl {
+			continue
+		}
+		session := Session{ID: id, Client: data.Client, Started: data.Timestamp, Expires: data.Timestamp.Add(s.ttl), Validated: data.Validated}
+		if data.PublicKey != nil {
+			session.KeyFingerprint = Fingerprint(data.PublicKey)
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, k int) bool {
+		return sessions[i].Started.Before(sessions[k].Started)
+	})
+	return sessions
+}
+
+// Revoke ends a session at once, reporting whether it existed
+func (s *SessionStore) Revoke(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.sessions[sessionID]
+	delete(s.sessions, sessionID)
+	return exists
+}
+
+// CompleteHandshake burns the challenge of a session and validates the session
+// if secret matched it. Both happen under one lock, so of concurrent attempts
+// with the same secret at most one succeeds.
+func (s *SessionStore) CompleteHandshake(sessionID string, secret []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.sessions[sessionID]
+	if !exists {
+		return false, errors.New("session not found")
+	}
+	if data.Validated {
+		return false, ErrHandshakeCompleted
+	}
+	challenge := data.ChallengeSecret
+	matched := challenge != "" && subtle.ConstantTimeCompare(secret, []byte(challenge)) == 1
+
+	// The challenge is single-use: burn it whether or not it matched so it can be neither replayed nor guessed
+	data.ChallengeSecret = ""
+	data.Validated = matched
+	s.sessions[sessionID] = data
+	return matched, nil
+}
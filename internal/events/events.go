@@ -0,0 +1,195 @@
+// Package events is an in-process bus. The server, jobs, profile runs, the
+// approval gate and the supervised app publish progress to it, and the terminal UI subscribes to it.
+// Publishing never blocks: a subscriber that falls behind loses events rather
+// than slowing down the work that produces them. A Feed only loses info
+// events, for renderers that must report every status.
+package events
+
+import (
+	"spi-go-core/internal/output"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Source identifies what published an event
+type Source string
+
+const (
+	SourceServer   Source = "server"
+	SourceConfig   Source = "config"
+	SourceJob      Source = "job"
+	SourceProfile  Source = "profile"
+	SourceApp      Source = "app"
+	SourceRuntime  Source = "runtime"
+	SourceApproval Source = "approval"
+)
+
+// Status is the state of a task or step an event reports
+type Status string
+
+const (
+	StatusInfo      Status = "info" // progress or a message, the state is unchanged
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"
+)
+
+// Done reports whether the status is final
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusSkipped
+}
+
+// Event reports a change of a task, or of one step of a task when Step is set.
+// Source and Task together identify the task, e.g. a job or a profile run.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Source  Source    `json:"source"`
+	Task    string    `json:"task"`
+	Title   string    `json:"title,omitempty"` // human readable name of the task
+	Step    string    `json:"step,omitempty"`
+	Status  Status    `json:"status"`
+	Message string    `json:"message,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	// Stream is set on info events carrying a line of output in Message,
+	// Level to how important the line is
+	Stream string       `json:"stream,omitempty"`
+	Level  output.Level `json:"level,omitempty"`
+}
+
+// DefaultBuffer is the number of events a subscriber may fall behind by
+const DefaultBuffer = 256
+
+// Bus fans events out to subscribers. The nil *Bus discards events, so
+// publishers need no checks.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+	feeds       map[*Feed]struct{}
+	dropped     atomic.Int64
+}
+
+// New returns a bus without subscribers
+func New() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{}), feeds: make(map[*Feed]struct{})}
+}
+
+// Publish sends e to every subscriber that has room for it. Time is set if empty.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+	for feed := range b.feeds {
+		if !feed.push(e) {
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// buffered for buffer events, and a function that ends the subscription and
+// closes the channel
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Feed queues the events published to a bus for one reader. Info events
+// beyond the buffer are dropped, every other event is kept until taken.
+type Feed struct {
+	buffer int
+	ready  chan struct{}
+
+	mu    sync.Mutex
+	queue []Event
+	info  int // info events in queue
+}
+
+// Feed returns a feed of every event published from now on, keeping up to
+// buffer info events, and a function that ends it
+func (b *Bus) Feed(buffer int) (*Feed, func()) {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	feed := &Feed{buffer: buffer, ready: make(chan struct{}, 1)}
+	b.mu.Lock()
+	b.feeds[feed] = struct{}{}
+	b.mu.Unlock()
+
+	return feed, func() {
+		b.mu.Lock()
+		delete(b.feeds, feed)
+		b.mu.Unlock()
+	}
+}
+
+// Ready returns a channel that receives once events are waiting to be taken
+func (f *Feed) Ready() <-chan struct{} {
+	return f.ready
+}
+
+// Take returns the waiting events, oldest first, and empties the queue
+func (f *Feed) Take() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queue := f.queue
+	f.queue, f.info = nil, 0
+	return queue
+}
+
+// push queues e unless it is an info event the buffer has no room for
+func (f *Feed) push(e Event) bool {
+	f.mu.Lock()
+	if e.Status == StatusInfo {
+		if f.info >= f.buffer {
+			f.mu.Unlock()
+			return false
+		}
+		f.info++
+	}
+	f.queue = append(f.queue, e)
+	f.mu.Unlock()
+
+	select {
+	case f.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Dropped returns how many events were not delivered to slow subscribers
+func (b *Bus) Dropped() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.dropped.Load()
+}
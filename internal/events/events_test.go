@@ -0,0 +1,74 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishFansOutWithoutBlocking(t *testing.T) {
+	bus := New()
+	fast, unsubscribeFast := bus.Subscribe(10)
+	defer unsubscribeFast()
+	slow, unsubscribeSlow := bus.Subscribe(1)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			bus.Publish(Event{Source: SourceJob, Task: "a", Status: StatusRunning})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	if len(fast) != 3 || len(slow) != 1 || bus.Dropped() != 2 {
+		t.Errorf("Expected 3 and 1 delivered and 2 dropped, got %d, %d and %d", len(fast), len(slow), bus.Dropped())
+	}
+	if e := <-fast; e.Time.IsZero() {
+		t.Error("Publish should set the event time")
+	}
+
+	unsubscribeSlow()
+	unsubscribeSlow()
+	bus.Publish(Event{Source: SourceJob, Task: "b"})
+	if len(fast) != 3 {
+		t.Errorf("Expected the remaining subscriber to get the event, has %d", len(fast))
+	}
+
+	var none *Bus
+	none.Publish(Event{})
+}
+
+func TestFeedOnlyDropsInfoEvents(t *testing.T) {
+	bus := New()
+	feed, unsubscribe := bus.Feed(1)
+	for i := 0; i < 3; i++ {
+		bus.Publish(Event{Source: SourceJob, Task: "a", Status: StatusInfo, Message: "line"})
+	}
+	bus.Publish(Event{Source: SourceJob, Task: "a", Status: StatusRunning})
+	bus.Publish(Event{Source: SourceJob, Task: "a", Status: StatusSucceeded})
+
+	select {
+	case <-feed.Ready():
+	default:
+		t.Fatal("Expected the feed to be ready")
+	}
+	taken := feed.Take()
+	if len(taken) != 3 || taken[0].Status != StatusInfo || taken[2].Status != StatusSucceeded || bus.Dropped() != 2 {
+		t.Errorf("Expected 1 info and 2 status events with 2 dropped, got %+v and %d", taken, bus.Dropped())
+	}
+	if len(feed.Take()) != 0 {
+		t.Error("Take should empty the feed")
+	}
+
+	// The buffer counts the info events waiting, not those ever published
+	bus.Publish(Event{Source: SourceJob, Task: "b", Status: StatusInfo})
+	unsubscribe()
+	bus.Publish(Event{Source: SourceJob, Task: "c", Status: StatusRunning})
+	if taken := feed.Take(); len(taken) != 1 || taken[0].Task != "b" {
+		t.Errorf("Expected only the event before unsubscribing, got %+v", taken)
+	}
+}
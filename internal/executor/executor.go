@@ -0,0 +1,212 @@
+// Package executor puts every process the core spawns behind one interface so
+// handlers, environment setup and the UI can be exercised with a scripted fake.
+package executor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Spec describes a process to start. Args holds the full argv, Args[0] is the program.
+type Spec struct {
+	Args  []string
+	Env   []string
+	Dir   string
+	Stdin io.Reader
+	// ExtraFiles are inherited by the process as file descriptors 3, 4, ...
+	ExtraFiles []*os.File
+}
+
+// String renders the argv for logs
+func (s Spec) String() string {
+	return strings.Join(s.Args, " ")
+}
+
+// Process is a started process. Stdout and Stderr must be read to EOF before
+// calling Wait, as with os/exec pipes.
+type Process interface {
+	Stdout() io.Reader
+	Stderr() io.Reader
+	// Wait blocks until the process exits and returns its exit code. A non-zero
+	// exit is reported both in the code and as an error.
+	Wait() (int, error)
+	// Kill terminates the process and everything it spawned
+	Kill() error
+	// Signal sends sig to the process and everything it spawned
+	Signal(sig os.Signal) error
+	Pid() int
+}
+
+// Executor starts processes
+type Executor interface {
+	Start(ctx context.Context, spec Spec) (Process, error)
+}
+
+// LineFunc receives one line of output together with the stream it came from ("stdout" or "stderr")
+type LineFunc func(stream, line string)
+
+// Stream reads both output streams of p line by line until they are closed,
+// calling fn for every line. fn is never called concurrently.
+func Stream(p Process, fn LineFunc) error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		readErr error
+	)
+	read := func(stream string, r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			mu.Lock()
+			fn(stream, scanner.Text())
+			mu.Unlock()
+		}
+		if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			errOnce.Do(func() { readErr = fmt.Errorf("failed to read %s: %v", stream, err) })
+		}
+	}
+
+	wg.Add(2)
+	go read("stdout", p.Stdout())
+	go read("stderr", p.Stderr())
+	wg.Wait()
+	return readErr
+}
+
+// Result is the outcome of Run
+type Result struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// Run starts spec, streams its output to fn (which may be nil), waits for it
+// and returns the collected output
+func Run(ctx context.Context, ex Executor, spec Spec, fn LineFunc) (Result, error) {
+	proc, err := ex.Start(ctx, spec)
+	if err != nil {
+		return Result{ExitCode: -1}, err
+	}
+
+	var stdout, stderr strings.Builder
+	streamErr := Stream(proc, func(stream, line string) {
+		if stream == "stderr" {
+			stderr.WriteString(line + "\n")
+		} else {
+			stdout.WriteString(line + "\n")
+		}
+		if fn != nil {
+			fn(stream, line)
+		}
+	})
+
+	code, err := proc.Wait()
+	result := Result{ExitCode: code, Stdout: stdout.String(), Stderr: stderr.String()}
+	if err == nil {
+		err = streamErr
+	}
+	return result, err
+}
+
+// ExitError is returned by Wait when a process exits with a non-zero status
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	if e.Code < 0 {
+		return "process killed"
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// OS runs real processes through os/exec
+type OS struct{}
+
+// NewOS returns an executor that spawns real processes
+func NewOS() *OS {
+	return &OS{}
+}
+
+// waitDelay bounds how long Wait waits for the output pipes after the process
+// exited or was killed
+const waitDelay = 5 * time.Second
+
+// Start implements Executor
+func (OS) Start(ctx context.Context, spec Spec) (Process, error) {
+	if len(spec.Args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	cmd := exec.CommandContext(ctx, spec.Args[0], spec.Args[1:]...)
+	cmd.Env = spec.Env
+	cmd.Dir = spec.Dir
+	cmd.Stdin = spec.Stdin
+	cmd.ExtraFiles = spec.ExtraFiles
+	// Run in its own process group so Kill also reaches children (e.g. of sh -c)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Wait gives up on output still held open by children that outlived the process
+	cmd.WaitDelay = waitDelay
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command: %v", err)
+	}
+	return &osProcess{cmd: cmd, stdout: stdout, stderr: stderr}, nil
+}
+
+type osProcess struct {
+	cmd    *exec.Cmd
+	stdout io.Reader
+	stderr io.Reader
+}
+
+func (p *osProcess) Stdout() io.Reader { return p.stdout }
+func (p *osProcess) Stderr() io.Reader { return p.stderr }
+func (p *osProcess) Pid() int          { return p.cmd.Process.Pid }
+
+func (p *osProcess) Wait() (int, error) {
+	err := p.cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		return code, &ExitError{Code: code}
+	}
+	return -1, err
+}
+
+func (p *osProcess) Kill() error {
+	return syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func (p *osProcess) Signal(sig os.Signal) error {
+	signal, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.cmd.Process.Signal(sig)
+	}
+	return syscall.Kill(-p.cmd.Process.Pid, signal)
+}
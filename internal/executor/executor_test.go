@@ -0,0 +1,82 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeReplaysScript(t *testing.T) {
+	fake := NewFake(Script{
+		Match:    []string{"apt-get", "install"},
+		Stdout:   []string{"Reading package lists...", "Setting up nodejs"},
+		Stderr:   []string{"W: something odd"},
+		ExitCode: 100,
+	})
+
+	lines := map[string][]string{}
+	result, err := Run(context.Background(), fake, Spec{Args: []string{"apt-get", "install", "-y", "nodejs"}}, func(stream, line string) {
+		lines[stream] = append(lines[stream], line)
+	})
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 100 || result.ExitCode != 100 {
+		t.Fatalf("Expected exit code 100, got %d (%v)", result.ExitCode, err)
+	}
+	expected := map[string][]string{
+		"stdout": {"Reading package lists...", "Setting up nodejs"},
+		"stderr": {"W: something odd"},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected lines:\n%v\nexpected:\n%v", lines, expected)
+	}
+	if commands := fake.Commands(); len(commands) != 1 || commands[0] != "apt-get install -y nodejs" {
+		t.Errorf("Unexpected recorded calls: %v", commands)
+	}
+}
+
+func TestFakeUnscriptedCommandFails(t *testing.T) {
+	fake := NewFake()
+	if _, err := fake.Start(context.Background(), Spec{Args: []string{"rm", "-rf", "/"}}); err == nil {
+		t.Fatal("Expected an unscripted command to fail to start")
+	}
+}
+
+func TestFakeKill(t *testing.T) {
+	fake := NewFake(Script{Match: []string{"sleep"}, Stdout: []string{"a", "b", "c"}, Delay: time.Hour})
+
+	proc, err := fake.Start(context.Background(), Spec{Args: []string{"sleep", "3600"}})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	proc.Kill()
+	Stream(proc, func(string, string) {})
+	if code, err := proc.Wait(); code != -1 || err == nil {
+		t.Errorf("Expected a killed process, got exit %d (%v)", code, err)
+	}
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	recorder := NewRecorder(NewOS())
+	spec := Spec{Args: []string{"sh", "-c", "echo out; echo err >&2; exit 3"}}
+	if _, err := Run(context.Background(), recorder, spec, nil); err == nil {
+		t.Fatal("Expected a non-zero exit")
+	}
+
+	path := filepath.Join(t.TempDir(), "recording.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	fake, err := LoadFake(path)
+	if err != nil {
+		t.Fatalf("LoadFake failed: %v", err)
+	}
+
+	result, _ := Run(context.Background(), fake, spec, nil)
+	if result.ExitCode != 3 || result.Stdout != "out\n" || result.Stderr != "err\n" {
+		t.Errorf("Replay differs from recording: %+v", result)
+	}
+}
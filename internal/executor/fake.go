@@ -0,0 +1,311 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Script is a recorded process run: when a started argv begins with Match,
+// the fake replays Stdout and Stderr and exits with ExitCode
+type Script struct {
+	Match    []string      `json:"match"`
+	Stdout   []string      `json:"stdout,omitempty"`
+	Stderr   []string      `json:"stderr,omitempty"`
+	ExitCode int           `json:"exitCode"`
+	Delay    time.Duration `json:"delay,omitempty"` // pause before each line
+	StartErr string        `json:"startError,omitempty"`
+	// Once removes the script after its first use so later calls fall through to the next match
+	Once bool `json:"once,omitempty"`
+}
+
+func (s Script) matches(args []string) bool {
+	if len(s.Match) > len(args) {
+		return false
+	}
+	for i, arg := range s.Match {
+		if arg != args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Fake is a scripted Executor that never spawns real processes. Calls that
+// match no script fail to start unless Fallback is set.
+type Fake struct {
+	mu       sync.Mutex
+	scripts  []Script
+	calls    []Spec
+	Fallback *Script
+}
+
+// NewFake returns a fake executor replaying the given scripts, first match wins
+func NewFake(scripts ...Script) *Fake {
+	return &Fake{scripts: scripts}
+}
+
+// LoadFake reads a JSON array of scripts, as written by Recorder.Save
+func LoadFake(path string) (*Fake, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scripts []Script
+	if err := json.Unmarshal(data, &scripts); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %v", path, err)
+	}
+	return NewFake(scripts...), nil
+}
+
+// Add appends a script
+func (f *Fake) Add(script Script) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = append(f.scripts, script)
+}
+
+// Calls returns every spec that was started, in order
+func (f *Fake) Calls() []Spec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Spec(nil), f.calls...)
+}
+
+// Commands returns the argv of every call joined by spaces, convenient for assertions
+func (f *Fake) Commands() []string {
+	calls := f.Calls()
+	commands := make([]string, len(calls))
+	for i, call := range calls {
+		commands[i] = call.String()
+	}
+	return commands
+}
+
+// Start implements Executor
+func (f *Fake) Start(ctx context.Context, spec Spec) (Process, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, spec)
+	script, found := f.lookupLocked(spec.Args)
+	f.mu.Unlock()
+
+	if !found {
+		return nil, fmt.Errorf("fake executor: no script for %q", spec.String())
+	}
+	if script.StartErr != "" {
+		return nil, fmt.Errorf("%s", script.StartErr)
+	}
+	return startFakeProcess(ctx, script), nil
+}
+
+func (f *Fake) lookupLocked(args []string) (Script, bool) {
+	for i, script := range f.scripts {
+		if script.matches(args) {
+			if script.Once {
+				f.scripts = append(f.scripts[:i:i], f.scripts[i+1:]...)
+			}
+			return script, true
+		}
+	}
+	if f.Fallback != nil {
+		return *f.Fallback, true
+	}
+	return Script{}, false
+}
+
+type fakeProcess struct {
+	stdout, stderr *io.PipeReader
+	killed         chan struct{}
+	killOnce       sync.Once
+	done           chan struct{}
+	exitCode       int
+	pid            int
+}
+
+var fakePid = struct {
+	sync.Mutex
+	next int
+}{next: 10000}
+
+func nextFakePid() int {
+	fakePid.Lock()
+	defer fakePid.Unlock()
+	fakePid.next++
+	return fakePid.next
+}
+
+func startFakeProcess(ctx context.Context, script Script) *fakeProcess {
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	p := &fakeProcess{
+		stdout: stdoutR,
+		stderr: stderrR,
+		killed: make(chan struct{}),
+		done:   make(chan struct{}),
+		pid:    nextFakePid(),
+	}
+
+	replay := func(w *io.PipeWriter, lines []string) bool {
+		for _, line := range lines {
+			if script.Delay > 0 {
+				select {
+				case <-time.After(script.Delay):
+				case <-p.killed:
+					return false
+				case <-ctx.Done():
+					return false
+				}
+			}
+			select {
+			case <-p.killed:
+				return false
+			case <-ctx.Done():
+				return false
+			default:
+			}
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	go func() {
+		// Replay stdout before stderr; the order within each stream is preserved
+		completed := replay(stdoutW, script.Stdout) && replay(stderrW, script.Stderr)
+		stdoutW.Close()
+		stderrW.Close()
+		if completed {
+			p.exitCode = script.ExitCode
+		} else {
+			p.exitCode = -1
+		}
+		close(p.done)
+	}()
+	return p
+}
+
+func (p *fakeProcess) Stdout() io.Reader { return p.stdout }
+func (p *fakeProcess) Stderr() io.Reader { return p.stderr }
+
+func (p *fakeProcess) Pid() int { return p.pid }
+
+func (p *fakeProcess) Wait() (int, error) {
+	<-p.done
+	if p.exitCode != 0 {
+		return p.exitCode, &ExitError{Code: p.exitCode}
+	}
+	return 0, nil
+}
+
+func (p *fakeProcess) Kill() error {
+	p.killOnce.Do(func() {
+		close(p.killed)
+		// Unblock a writer waiting on a reader that stopped reading
+		p.stdout.Close()
+		p.stderr.Close()
+	})
+	return nil
+}
+
+// Signal ends a fake process the way a default signal handler would
+func (p *fakeProcess) Signal(sig os.Signal) error {
+	return p.Kill()
+}
+
+// Recorder wraps another Executor and records every run as a Script so it
+// can be replayed later with LoadFake
+type Recorder struct {
+	Executor Executor
+
+	mu      sync.Mutex
+	scripts []Script
+}
+
+// NewRecorder records the runs of ex
+func NewRecorder(ex Executor) *Recorder {
+	return &Recorder{Executor: ex}
+}
+
+// Start implements Executor
+func (r *Recorder) Start(ctx context.Context, spec Spec) (Process, error) {
+	proc, err := r.Executor.Start(ctx, spec)
+	if err != nil {
+		r.record(Script{Match: spec.Args, StartErr: err.Error(), Once: true})
+		return nil, err
+	}
+
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	recorded := &recordedProcess{Process: proc, stdout: stdoutR, stderr: stderrR}
+	recorded.streamed = make(chan struct{})
+	go func() {
+		defer close(recorded.streamed)
+		Stream(proc, func(stream, line string) {
+			if stream == "stderr" {
+				recorded.script.Stderr = append(recorded.script.Stderr, line)
+				io.WriteString(stderrW, line+"\n")
+			} else {
+				recorded.script.Stdout = append(recorded.script.Stdout, line)
+				io.WriteString(stdoutW, line+"\n")
+			}
+		})
+		stdoutW.Close()
+		stderrW.Close()
+	}()
+	recorded.script.Match = spec.Args
+	recorded.script.Once = true
+	recorded.recorder = r
+	return recorded, nil
+}
+
+// Scripts returns everything recorded so far
+func (r *Recorder) Scripts() []Script {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Script(nil), r.scripts...)
+}
+
+// Save writes the recording as JSON to path
+func (r *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Scripts(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (r *Recorder) record(script Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scripts = append(r.scripts, script)
+}
+
+type recordedProcess struct {
+	Process
+	stdout, stderr *io.PipeReader
+	streamed       chan struct{}
+	script         Script
+	recorder       *Recorder
+}
+
+func (p *recordedProcess) Stdout() io.Reader { return p.stdout }
+func (p *recordedProcess) Stderr() io.Reader { return p.stderr }
+
+func (p *recordedProcess) Kill() error {
+	p.stdout.Close()
+	p.stderr.Close()
+	return p.Process.Kill()
+}
+
+func (p *recordedProcess) Wait() (int, error) {
+	<-p.streamed
+	code, err := p.Process.Wait()
+	p.script.ExitCode = code
+	p.recorder.record(p.script)
+	return code, err
+}
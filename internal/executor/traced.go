@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"context"
+	"path/filepath"
+	"spi-go-core/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traced starts processes through an Executor in spans
+type traced struct {
+	Executor
+}
+
+// Traced wraps ex so each process gets a process.spawn span for starting it
+// and a process.wait span from its start until it exits, both children of
+// the span in the context Start is called with. Only the program name is
+// recorded, as arguments may carry secrets.
+func Traced(ex Executor) Executor {
+	return traced{ex}
+}
+
+// Start implements Executor
+func (t traced) Start(ctx context.Context, spec Spec) (Process, error) {
+	var program string
+	if len(spec.Args) > 0 {
+		program = filepath.Base(spec.Args[0])
+	}
+	attrs := []attribute.KeyValue{attribute.String("process.executable.name", program)}
+	_, spawn := tracing.Start(ctx, "process.spawn", attrs...)
+	proc, err := t.Executor.Start(ctx, spec)
+	if err != nil {
+		tracing.End(spawn, err)
+		return nil, err
+	}
+	pid := attribute.Int("process.pid", proc.Pid())
+	spawn.SetAttributes(pid)
+	spawn.End()
+	_, wait := tracing.Start(ctx, "process.wait", append(attrs, pid)...)
+	return &tracedProcess{Process: proc, span: wait}, nil
+}
+
+type tracedProcess struct {
+	Process
+	span trace.Span
+}
+
+func (p *tracedProcess) Wait() (int, error) {
+	code, err := p.Process.Wait()
+	p.span.SetAttributes(attribute.Int("process.exit.code", code))
+	tracing.End(p.span, err)
+	return code, err
+}
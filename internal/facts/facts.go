@@ -0,0 +1,307 @@
+// Package facts collects what profiles and setup need to know about the host:
+// distribution, kernel, architecture, init system, container or VM, hardware
+// totals and package managers. Everything is read below a configurable root so
+// the collector can be pointed at fixture directories.
+package facts
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"spi-go-core/internal/pkg"
+)
+
+// OS describes the distribution as reported by os-release
+type OS struct {
+	ID        string   `json:"id"`
+	IDLike    []string `json:"idLike,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	VersionID string   `json:"versionId,omitempty"`
+	Codename  string   `json:"codename,omitempty"`
+}
+
+// Families returns the ID followed by every ID_LIKE entry, e.g. [ubuntu debian]
+func (o OS) Families() []string {
+	return append([]string{o.ID}, o.IDLike...)
+}
+
+// Disk holds the size of the filesystem the root lives on
+type Disk struct {
+	Path       string `json:"path"`
+	TotalBytes uint64 `json:"totalBytes"`
+	FreeBytes  uint64 `json:"freeBytes"`
+}
+
+// Facts is a snapshot of the host
+type Facts struct {
+	OS      OS     `json:"os"`
+	Kernel  string `json:"kernel"`
+	Arch    string `json:"arch"`    // Go-style name: amd64, arm64, arm, 386, ...
+	Machine string `json:"machine"` // as reported by the kernel: x86_64, aarch64, ...
+	Init    string `json:"init"`    // systemd, openrc, sysvinit or unknown
+	// Container and Virtualization are empty on bare metal
+	Container       string   `json:"container,omitempty"`
+	Virtualization  string   `json:"virtualization,omitempty"`
+	CPUs            int      `json:"cpus"`
+	MemoryBytes     uint64   `json:"memoryBytes"`
+	Disk            Disk     `json:"disk"`
+	PackageManagers []string `json:"packageManagers"`
+}
+
+// Collector reads facts from the filesystem below Root ("/" on a real host)
+type Collector struct {
+	Root string
+}
+
+// NewCollector returns a collector for the host rooted at root
+func NewCollector(root string) *Collector {
+	if root == "" {
+		root = "/"
+	}
+	return &Collector{Root: root}
+}
+
+// Collect gathers all facts. Missing sources leave the related facts empty
+// instead of failing, so containers and minimal systems still report what they can.
+func (c *Collector) Collect() (*Facts, error) {
+	f := &Facts{
+		OS:     c.osRelease(),
+		Kernel: c.readLine("proc/sys/kernel/osrelease"),
+	}
+
+	f.Machine = c.readLine("proc/sys/kernel/arch")
+	if f.Machine == "" && c.isHost() {
+		f.Machine = unameMachine()
+	}
+	f.Arch = goArch(f.Machine)
+
+	f.Init = c.initSystem()
+	f.Container = c.container()
+	f.Virtualization = c.virtualization()
+	f.CPUs = c.cpus()
+	f.MemoryBytes = c.memory()
+
+	f.Disk = Disk{Path: c.Root}
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(c.Root, &stat); err != nil {
+		return nil, err
+	}
+	f.Disk.TotalBytes = stat.Blocks * uint64(stat.Bsize)
+	f.Disk.FreeBytes = stat.Bavail * uint64(stat.Bsize)
+
+	for _, name := range pkg.Names() {
+		if c.hasBinary(name) {
+			f.PackageManagers = append(f.PackageManagers, name)
+		}
+	}
+	return f, nil
+}
+
+// isHost reports whether the collector looks at the machine it runs on
+func (c *Collector) isHost() bool {
+	return filepath.Clean(c.Root) == "/"
+}
+
+func (c *Collector) path(p string) string {
+	return filepath.Join(c.Root, p)
+}
+
+func (c *Collector) exists(p string) bool {
+	_, err := os.Stat(c.path(p))
+	return err == nil
+}
+
+func (c *Collector) read(p string) string {
+	data, err := os.ReadFile(c.path(p))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (c *Collector) readLine(p string) string {
+	return strings.TrimSpace(c.read(p))
+}
+
+// osRelease parses /etc/os-release, falling back to /usr/lib/os-release
+func (c *Collector) osRelease() OS {
+	content := c.read("etc/os-release")
+	if content == "" {
+		content = c.read("usr/lib/os-release")
+	}
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		values[key] = value
+	}
+
+	release := OS{
+		ID:        strings.ToLower(values["ID"]),
+		Name:      values["PRETTY_NAME"],
+		VersionID: values["VERSION_ID"],
+		Codename:  values["VERSION_CODENAME"],
+		IDLike:    strings.Fields(strings.ToLower(values["ID_LIKE"])),
+	}
+	if release.ID == "" {
+		release.ID = "linux"
+	}
+	if release.Codename == "" {
+		release.Codename = values["UBUNTU_CODENAME"]
+	}
+	return release
+}
+
+func (c *Collector) initSystem() string {
+	switch {
+	case c.exists("run/systemd/system"):
+		return "systemd"
+	case c.exists("run/openrc"), c.exists("sbin/openrc-run"):
+		return "openrc"
+	}
+	switch c.readLine("proc/1/comm") {
+	case "systemd":
+		return "systemd"
+	case "openrc-init":
+		return "openrc"
+	case "init":
+		return "sysvinit"
+	}
+	return "unknown"
+}
+
+func (c *Collector) container() string {
+	switch {
+	case c.exists(".dockerenv"):
+		return "docker"
+	case c.exists("run/.containerenv"):
+		return "podman"
+	}
+	// systemd and most runtimes set container= in the environment of PID 1
+	for _, variable := range strings.Split(c.read("proc/1/environ"), "\x00") {
+		if value, ok := strings.CutPrefix(variable, "container="); ok && value != "" {
+			return value
+		}
+	}
+	cgroup := c.read("proc/1/cgroup")
+	for _, marker := range []string{"kubepods", "docker", "lxc", "containerd"} {
+		if strings.Contains(cgroup, marker) {
+			if marker == "kubepods" {
+				return "kubernetes"
+			}
+			return marker
+		}
+	}
+	return ""
+}
+
+func (c *Collector) virtualization() string {
+	vendor := strings.ToLower(c.readLine("sys/class/dmi/id/sys_vendor") + " " + c.readLine("sys/class/dmi/id/product_name"))
+	for _, known := range []struct{ marker, name string }{
+		{"qemu", "kvm"},
+		{"kvm", "kvm"},
+		{"vmware", "vmware"},
+		{"virtualbox", "virtualbox"},
+		{"microsoft corporation virtual machine", "hyperv"},
+		{"amazon ec2", "amazon"},
+		{"google compute engine", "google"},
+		{"xen", "xen"},
+	} {
+		if strings.Contains(vendor, known.marker) {
+			return known.name
+		}
+	}
+	if hypervisor := c.readLine("sys/hypervisor/type"); hypervisor != "" {
+		return hypervisor
+	}
+	// The CPU still advertises a hypervisor when the vendor is unknown
+	if strings.Contains(c.read("proc/cpuinfo"), " hypervisor") {
+		return "unknown"
+	}
+	return ""
+}
+
+func (c *Collector) cpus() int {
+	count := 0
+	for _, line := range strings.Split(c.read("proc/cpuinfo"), "\n") {
+		if strings.HasPrefix(line, "processor") {
+			count++
+		}
+	}
+	if count == 0 && c.isHost() {
+		return runtime.NumCPU()
+	}
+	return count
+}
+
+// memory reads MemTotal from /proc/meminfo, which is given in kB
+func (c *Collector) memory() uint64 {
+	for _, line := range strings.Split(c.read("proc/meminfo"), "\n") {
+		if value, ok := strings.CutPrefix(line, "MemTotal:"); ok {
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				kb, _ := strconv.ParseUint(fields[0], 10, 64)
+				return kb * 1024
+			}
+		}
+	}
+	return 0
+}
+
+func (c *Collector) hasBinary(name string) bool {
+	for _, dir := range []string{"usr/bin", "bin", "usr/sbin", "sbin", "usr/local/bin"} {
+		if info, err := os.Stat(c.path(filepath.Join(dir, name))); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// goArch maps a kernel machine name to the GOARCH naming used in release artifacts
+func goArch(machine string) string {
+	switch machine {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64", "armv8l":
+		return "arm64"
+	case "i386", "i486", "i586", "i686", "x86":
+		return "386"
+	case "ppc64le", "s390x", "riscv64":
+		return machine
+	case "":
+		return ""
+	}
+	if strings.HasPrefix(machine, "armv") {
+		return "arm"
+	}
+	return machine
+}
+
+func unameMachine() string {
+	var uname syscall.Utsname
+	if err := syscall.Uname(&uname); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range uname.Machine {
+		if c == 0 {
+			break
+		}
+		b.WriteByte(byte(c))
+	}
+	return b.String()
+}
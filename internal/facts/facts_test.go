@@ -0,0 +1,89 @@
+package facts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func collect(t *testing.T, fixture string) *Facts {
+	t.Helper()
+	f, err := NewCollector("testdata/" + fixture).Collect()
+	if err != nil {
+		t.Fatalf("Collect(%s) failed: %v", fixture, err)
+	}
+	return f
+}
+
+func TestCollectUbuntuArm64(t *testing.T) {
+	f := collect(t, "ubuntu-arm64")
+
+	expectedOS := OS{ID: "ubuntu", IDLike: []string{"debian"}, Name: "Ubuntu 22.04.4 LTS", VersionID: "22.04", Codename: "jammy"}
+	if !reflect.DeepEqual(f.OS, expectedOS) {
+		t.Errorf("Unexpected OS facts: %+v", f.OS)
+	}
+	if f.Arch != "arm64" || f.Machine != "aarch64" || f.Kernel != "6.5.0-1014-raspi" {
+		t.Errorf("Unexpected kernel facts: arch=%s machine=%s kernel=%s", f.Arch, f.Machine, f.Kernel)
+	}
+	if f.Init != "systemd" || f.Container != "" || f.Virtualization != "kvm" {
+		t.Errorf("Unexpected runtime facts: init=%s container=%q virtualization=%q", f.Init, f.Container, f.Virtualization)
+	}
+	if f.CPUs != 2 || f.MemoryBytes != 3884196*1024 {
+		t.Errorf("Unexpected hardware facts: cpus=%d memory=%d", f.CPUs, f.MemoryBytes)
+	}
+	if !reflect.DeepEqual(f.PackageManagers, []string{"apt-get"}) {
+		t.Errorf("Unexpected package managers: %v", f.PackageManagers)
+	}
+}
+
+func TestCollectAlpineContainer(t *testing.T) {
+	f := collect(t, "alpine-docker")
+
+	if f.OS.ID != "alpine" || f.OS.VersionID != "3.19.1" || len(f.OS.IDLike) != 0 {
+		t.Errorf("Unexpected OS facts: %+v", f.OS)
+	}
+	if f.Arch != "amd64" || f.Init != "unknown" || f.Container != "docker" || f.Virtualization != "unknown" {
+		t.Errorf("Unexpected facts: %+v", f)
+	}
+	if !reflect.DeepEqual(f.PackageManagers, []string{"apk"}) {
+		t.Errorf("Unexpected package managers: %v", f.PackageManagers)
+	}
+}
+
+func TestCollectEmptyRoot(t *testing.T) {
+	f, err := NewCollector(t.TempDir()).Collect()
+	if err != nil {
+		t.Fatalf("Collect failed on an empty root: %v", err)
+	}
+	if f.OS.ID != "linux" || f.Init != "unknown" || len(f.PackageManagers) != 0 {
+		t.Errorf("Unexpected facts for an empty root: %+v", f)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	f := collect(t, "ubuntu-arm64")
+	for _, c := range []struct {
+		when    map[string]string
+		matches bool
+	}{
+		{map[string]string{"os.family": "debian"}, true},
+		{map[string]string{"os.family": "rhel,fedora"}, false},
+		{map[string]string{"os.version": "22.*", "arch": "arm64"}, true},
+		{map[string]string{"arch": "!arm64"}, false},
+		{map[string]string{"container": "!docker,podman"}, true},
+		{map[string]string{"package_manager": "apt-get"}, true},
+		{map[string]string{"arch": "amd64"}, false},
+	} {
+		matches, reason := f.Match(c.when)
+		if matches != c.matches {
+			t.Errorf("Match(%v) = %v (%s), expected %v", c.when, matches, reason, c.matches)
+		}
+		if !matches && reason == "" {
+			t.Errorf("Match(%v) gave no reason", c.when)
+		}
+	}
+
+	if _, reason := f.Match(map[string]string{"arch": "amd64"}); !strings.Contains(reason, `arch is "arm64"`) {
+		t.Errorf("Unexpected reason: %s", reason)
+	}
+}
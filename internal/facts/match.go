@@ -0,0 +1,77 @@
+package facts
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// selectors maps the keys usable in profile "when" conditions to the fact values they test
+var selectors = map[string]func(f *Facts) []string{
+	"os.id":           func(f *Facts) []string { return []string{f.OS.ID} },
+	"os.family":       func(f *Facts) []string { return f.OS.Families() },
+	"os.version":      func(f *Facts) []string { return []string{f.OS.VersionID} },
+	"os.codename":     func(f *Facts) []string { return []string{f.OS.Codename} },
+	"kernel":          func(f *Facts) []string { return []string{f.Kernel} },
+	"arch":            func(f *Facts) []string { return []string{f.Arch} },
+	"init":            func(f *Facts) []string { return []string{f.Init} },
+	"container":       func(f *Facts) []string { return []string{f.Container} },
+	"virtualization":  func(f *Facts) []string { return []string{f.Virtualization} },
+	"package_manager": func(f *Facts) []string { return f.PackageManagers },
+}
+
+// SelectorKeys returns the keys Match understands, sorted
+func SelectorKeys() []string {
+	keys := make([]string, 0, len(selectors))
+	for key := range selectors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidSelector reports whether key can be used in a condition
+func ValidSelector(key string) bool {
+	_, ok := selectors[key]
+	return ok
+}
+
+// Match reports whether the facts satisfy every condition in when. Each value
+// is a comma-separated list of alternatives that may use shell globs
+// ("22.*"); a leading "!" negates the whole list. When a condition fails the
+// returned reason explains which one.
+func (f *Facts) Match(when map[string]string) (bool, string) {
+	keys := make([]string, 0, len(when))
+	for key := range when {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		lookup, ok := selectors[key]
+		if !ok {
+			return false, fmt.Sprintf("unknown fact %q", key)
+		}
+		expected := strings.TrimSpace(when[key])
+		negate := strings.HasPrefix(expected, "!")
+		expected = strings.TrimPrefix(expected, "!")
+
+		actual := lookup(f)
+		if matchAny(actual, strings.Split(expected, ",")) == negate {
+			return false, fmt.Sprintf("%s is %q, wanted %s", key, strings.Join(actual, ","), when[key])
+		}
+	}
+	return true, ""
+}
+
+func matchAny(actual, patterns []string) bool {
+	for _, value := range actual {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.TrimSpace(pattern), value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+// Package health checks whether the core can do its work: its keys load, its
+// configuration is valid, the supervised app is ready and its directories are
+// writable. The readiness probe, the diagnostics endpoint and the doctor
+// command share these checks.
+package health
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/supervisor"
+	"time"
+)
+
+// Version is the version of the build, set with
+// -ldflags "-X spi-go-core/internal/health.Version=v1.2.3"
+var Version = ""
+
+// started is when the process started, near enough
+var started = time.Now()
+
+// BuildVersion returns Version, else the VCS revision the binary was built
+// from, else "dev"
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "dev"
+}
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarn    Status = "warn" // works, but needs attention soon
+	StatusFail    Status = "fail"
+	StatusSkipped Status = "skipped"
+)
+
+// CertificateWarning is how long before its expiry the server certificate is reported
+const CertificateWarning = 14 * 24 * time.Hour
+
+// Check is the outcome of one check
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func result(name string, err error, detail string) Check {
+	if err != nil {
+		return Check{Name: name, Status: StatusFail, Detail: err.Error()}
+	}
+	return Check{Name: name, Status: StatusOK, Detail: detail}
+}
+
+// Passed reports whether no check failed
+func Passed(checks []Check) bool {
+	for _, check := range checks {
+		if check.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckKeys loads the core key pair
+func CheckKeys(cfg *config.AppConfig) Check {
+	_, public, err := encryption.LoadGoKeys(cfg.Encryption.PrivateKey, cfg.Encryption.PublicKey)
+	if err != nil {
+		return result("keys", fmt.Errorf("the core key pair does not load: %v", err), "")
+	}
+	return result("keys", nil, "public key "+encryption.Fingerprint(public))
+}
+
+// CheckConfig validates cfg. reloadError is the error of the last reload, if any.
+func CheckConfig(cfg *config.AppConfig, reloadError string) Check {
+	if err := cfg.Validate(); err != nil {
+		return result("config", err, "")
+	}
+	if reloadError != "" {
+		return Check{Name: "config", Status: StatusWarn, Detail: "the last reload failed: " + reloadError}
+	}
+	return result("config", nil, "")
+}
+
+// CheckApp reports whether the supervised app is ready. Builds without an app
+// pass, as the core serves the API alone then.
+func CheckApp(s *supervisor.Supervisor) Check {
+	if s == nil {
+		return Check{Name: "app", Status: StatusSkipped, Detail: "no app is supervised"}
+	}
+	status := s.Status()
+	switch status.State {
+	case supervisor.StateReady:
+		return result("app", nil, "ready")
+	case supervisor.StateDisabled:
+		return Check{Name: "app", Status: StatusSkipped, Detail: status.Error}
+	default:
+		detail := fmt.Sprintf("the app is %s", status.State)
+		if status.Error != "" {
+			detail += ": " + status.Error
+		}
+		return result("app", errors.New(detail), "")
+	}
+}
+
+// CheckDisk checks that the directories the core writes to are writable. A
+// directory not created yet is checked by its nearest existing parent.
+func CheckDisk(cfg *config.AppConfig) Check {
+	for _, dir := range writableDirs(cfg) {
+		if err := writable(dir); err != nil {
+			return result("disk", err, "")
+		}
+	}
+	return result("disk", nil, "")
+}
+
+// writableDirs returns the directories of the files and trees the core writes
+func writableDirs(cfg *config.AppConfig) []string {
+	dirs := []string{}
+	for _, file := range []string{cfg.Logging.File, cfg.Audit.File, cfg.UI.LogFile} {
+		if file != "" {
+			dirs = append(dirs, filepath.Dir(file))
+		}
+	}
+	for _, dir := range []string{cfg.Profiles.Dir, cfg.App.CacheDir} {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func writable(dir string) error {
+	for {
+		if info, err := os.Stat(dir); err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".spi-write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Certificate describes the server certificate
+type Certificate struct {
+	Subject     string    `json:"subject"`
+	Expires     time.Time `json:"expires"`
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of the DER encoding
+}
+
+// LoadCertificate loads the server certificate; nil without TLS
+func LoadCertificate(cfg *config.AppConfig) (*Certificate, error) {
+	if !cfg.Server.TLSEnabled {
+		return nil, nil
+	}
+	pair, err := tls.LoadX509KeyPair(cfg.Server.CertFile, cfg.Server.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(pair.Leaf.Raw)
+	return &Certificate{Subject: pair.Leaf.Subject.String(), Expires: pair.Leaf.NotAfter, Fingerprint: hex.EncodeToString(sum[:])}, nil
+}
+
+// CheckCertificate loads the server certificate and checks its expiry
+func CheckCertificate(cfg *config.AppConfig, now time.Time) Check {
+	cert, err := LoadCertificate(cfg)
+	switch {
+	case err != nil:
+		return result("certificate", fmt.Errorf("the server certificate does not load: %v", err), "")
+	case cert == nil:
+		return Check{Name: "certificate", Status: StatusSkipped, Detail: "TLS is disabled"}
+	case now.After(cert.Expires):
+		return result("certificate", fmt.Errorf("expired on %s", cert.Expires.Format(time.DateOnly)), "")
+	case cert.Expires.Sub(now) < CertificateWarning:
+		return Check{Name: "certificate", Status: StatusWarn, Detail: "expires on " + cert.Expires.Format(time.DateOnly)}
+	default:
+		return result("certificate", nil, "expires on "+cert.Expires.Format(time.DateOnly))
+	}
+}
+
+// Ready runs the checks of the readiness probe
+func Ready(cfg *config.AppConfig, reloadError string, app *supervisor.Supervisor) []Check {
+	return []Check{CheckKeys(cfg), CheckConfig(cfg, reloadError), CheckApp(app), CheckDisk(cfg)}
+}
+
+// Offline runs the checks that need no running server, for the doctor command
+func Offline(cfg *config.AppConfig, now time.Time) []Check {
+	return []Check{CheckKeys(cfg), CheckConfig(cfg, ""), CheckCertificate(cfg, now), CheckDisk(cfg)}
+}
+
+// Diagnostics describe the running core for operators
+type Diagnostics struct {
+	Version    string       `json:"version"`
+	GoVersion  string       `json:"goVersion"`
+	Started    time.Time    `json:"started"`
+	Uptime     string       `json:"uptime"`
+	TLS        string       `json:"tls"`                          // https or http
+	Encryption string       `json:"encryption"`                   // enabled or disabled
+	CoreKey    string       `json:"coreKeyFingerprint,omitempty"` // SHA-256 of the core public key
+	Cert       *Certificate `json:"certificate,omitempty"`
+	Checks     []Check      `json:"checks"`
+}
+
+// Diagnose describes the running core
+func Diagnose(cfg *config.AppConfig, reloadError string, app *supervisor.Supervisor, now time.Time) Diagnostics {
+	d := Diagnostics{
+		Version:    BuildVersion(),
+		GoVersion:  runtime.Version(),
+		Started:    started,
+		Uptime:     now.Sub(started).Round(time.Second).String(),
+		TLS:        "http",
+		Encryption: "disabled",
+		Checks:     append(Ready(cfg, reloadError, app), CheckCertificate(cfg, now)),
+	}
+	if cfg.Server.TLSEnabled {
+		d.TLS = "https"
+	}
+	if cfg.Encryption.Enabled {
+		d.Encryption = "enabled"
+	}
+	if public, err := encryption.GetGoCorePublicKeyPEM(cfg.Encryption.PublicKey); err == nil {
+		if key, err := encryption.ParsePublicKey(public); err == nil {
+			d.CoreKey = encryption.Fingerprint(key)
+		}
+	}
+	d.Cert, _ = LoadCertificate(cfg)
+	return d
+}
@@ -0,0 +1,114 @@
+package health_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/health"
+	"spi-go-core/internal/supervisor"
+	"spi-go-core/internal/testutil"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate expiring at notAfter and its key
+func writeCertificate(t *testing.T, dir string, key *rsa.PrivateKey, notAfter time.Time) (string, string) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "spi-go-core"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "cert-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	return certFile, keyFile
+}
+
+func TestCheckKeys(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, publicPath := testutil.WriteKeyFiles(t, dir, testutil.GenerateKey(t))
+
+	cfg := &config.AppConfig{}
+	cfg.Encryption.PrivateKey, cfg.Encryption.PublicKey = privatePath, publicPath
+	if check := health.CheckKeys(cfg); check.Status != health.StatusOK {
+		t.Errorf("Expected the keys to load, got %+v", check)
+	}
+
+	cfg.Encryption.PrivateKey = filepath.Join(dir, "missing.pem")
+	if check := health.CheckKeys(cfg); check.Status != health.StatusFail {
+		t.Errorf("Expected a missing key to fail, got %+v", check)
+	}
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Now()
+	key := testutil.GenerateKey(t)
+	cfg := &config.AppConfig{}
+	if check := health.CheckCertificate(cfg, now); check.Status != health.StatusSkipped {
+		t.Errorf("Expected the check to be skipped without TLS, got %+v", check)
+	}
+
+	cfg.Server.TLSEnabled = true
+	for _, tc := range []struct {
+		expires time.Time
+		want    health.Status
+	}{
+		{now.Add(90 * 24 * time.Hour), health.StatusOK},
+		{now.Add(3 * 24 * time.Hour), health.StatusWarn},
+		{now.Add(-time.Hour), health.StatusFail},
+	} {
+		cfg.Server.CertFile, cfg.Server.KeyFile = writeCertificate(t, t.TempDir(), key, tc.expires)
+		if check := health.CheckCertificate(cfg, now); check.Status != tc.want {
+			t.Errorf("Certificate expiring %s: expected %s, got %+v", tc.expires, tc.want, check)
+		}
+	}
+}
+
+func TestCheckApp(t *testing.T) {
+	if check := health.CheckApp(nil); check.Status != health.StatusSkipped {
+		t.Errorf("Expected builds without an app to skip the check, got %+v", check)
+	}
+
+	app := supervisor.New("app", nil, executor.Spec{})
+	if check := health.CheckApp(app); check.Status != health.StatusFail {
+		t.Errorf("Expected an app not started to fail the check, got %+v", check)
+	}
+	app.Disable("no manifest")
+	if check := health.CheckApp(app); check.Status != health.StatusSkipped || check.Detail != "no manifest" {
+		t.Errorf("Expected a disabled app to be skipped, got %+v", check)
+	}
+}
+
+func TestCheckDiskChecksTheNearestExistingParent(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.AppConfig{}
+	cfg.Logging.File = filepath.Join(dir, "logs", "not", "yet", "core.log")
+	cfg.Profiles.Dir = dir
+	if check := health.CheckDisk(cfg); check.Status != health.StatusOK {
+		t.Errorf("Expected the directories to be writable, got %+v", check)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected the check to leave nothing behind, got %v", entries)
+	}
+
+	cfg.Profiles.Dir = filepath.Join(dir, "file")
+	os.WriteFile(cfg.Profiles.Dir, nil, 0644)
+	if check := health.CheckDisk(cfg); check.Status != health.StatusFail {
+		t.Errorf("Expected a file in place of a directory to fail, got %+v", check)
+	}
+}
@@ -0,0 +1,439 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/metrics"
+	"spi-go-core/internal/output"
+	"spi-go-core/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Status describes the lifecycle state of a job
+type Status string
+
+const (
+	StatusAwaitingApproval Status = "awaiting_approval"
+	StatusRunning          Status = "running"
+	StatusSucceeded        Status = "succeeded"
+	StatusFailed           Status = "failed"
+	StatusCanceled         Status = "canceled"
+)
+
+// ErrNotFound is returned when a job ID is unknown
+var ErrNotFound = errors.New("job not found")
+
+// execLog is the log of the exec component
+var execLog = logging.For(logging.Exec)
+
+// DefaultHistory is how many finished jobs a Manager keeps unless History is set
+const DefaultHistory = 100
+
+// DefaultMaxLines is how many output lines a job keeps unless MaxLines is set
+const DefaultMaxLines = 10000
+
+// ErrShuttingDown is returned by Start once Shutdown has been called
+var ErrShuttingDown = errors.New("shutting down, not accepting new jobs")
+
+// Line is a single line of output produced by a job
+type Line struct {
+	Seq    int          `json:"seq"`
+	Stream string       `json:"stream"`
+	Text   string       `json:"text"`
+	Level  output.Level `json:"level"`
+}
+
+// Info is a point-in-time snapshot of a job, safe to encode as JSON
+type Info struct {
+	ID         string     `json:"id"`
+	Command    string     `json:"command"`
+	Status     Status     `json:"status"`
+	ExitCode   int        `json:"exitCode"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Lines      int        `json:"lines"` // printed so far, including lines no longer kept
+}
+
+// Job is a command running in the background whose output is kept in memory
+type Job struct {
+	id        string
+	command   string
+	tool      string // the program, whose output rules classify the lines
+	startedAt time.Time
+	cancel    context.CancelFunc
+
+	mu         sync.Mutex
+	status     Status
+	exitCode   int
+	err        string
+	finishedAt time.Time
+	lines      []Line // the most recent output, a ring once it holds maxLines
+	start      int    // index of the oldest line in lines once full
+	written    int    // lines written so far, the Seq of the next one
+	maxLines   int
+	changed    chan struct{}
+	done       chan struct{}
+}
+
+// ID returns the job identifier
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Info returns a snapshot of the job state
+func (j *Job) Info() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := Info{
+		ID:        j.id,
+		Command:   j.command,
+		Status:    j.status,
+		ExitCode:  j.exitCode,
+		Error:     j.err,
+		StartedAt: j.startedAt,
+		Lines:     j.written,
+	}
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		info.FinishedAt = &finishedAt
+	}
+	return info
+}
+
+// Lines returns the output lines whose Seq is from or later, whether the job
+// has finished and a channel that is closed when new output or a status change
+// arrives. Only the last MaxLines lines are kept: once older ones are dropped,
+// the lines returned start past from. Continue after the Seq of the last one.
+func (j *Job) Lines(from int) ([]Line, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	oldest := j.written - len(j.lines)
+	if from < oldest {
+		from = oldest
+	}
+	var lines []Line
+	for seq := from; seq < j.written; seq++ {
+		lines = append(lines, j.lines[(j.start+seq-oldest)%len(j.lines)])
+	}
+	return lines, !j.finishedAt.IsZero(), j.changed
+}
+
+// Done returns a channel that is closed once the job has finished
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Cancel stops a running job
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+func (j *Job) appendLine(line output.Line) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stored := Line{Seq: j.written, Stream: line.Stream, Text: line.Text, Level: line.Level}
+	j.written++
+	if len(j.lines) < j.maxLines {
+		j.lines = append(j.lines, stored)
+	} else {
+		j.lines[j.start] = stored
+		j.start = (j.start + 1) % len(j.lines)
+	}
+	j.notifyLocked()
+}
+
+func (j *Job) setStatus(status Status) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status = status
+	j.notifyLocked()
+}
+
+func (j *Job) finish(status Status, exitCode int, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status = status
+	j.exitCode = exitCode
+	if err != nil {
+		j.err = err.Error()
+	}
+	j.finishedAt = time.Now()
+	j.notifyLocked()
+	close(j.done)
+}
+
+// notifyLocked wakes up every waiter on the current changed channel
+func (j *Job) notifyLocked() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// Manager keeps track of background jobs
+type Manager struct {
+	// Events receives a task event when a job starts and when it finishes and an
+	// info event per line of output
+	Events *events.Bus
+	// History is how many finished jobs List and Get still know about. The
+	// oldest ones beyond it are dropped as new jobs start, 0 means DefaultHistory.
+	History int
+	// MaxLines is how many output lines each job keeps. The oldest ones beyond
+	// it are dropped, 0 means DefaultMaxLines.
+	MaxLines int
+
+	executor executor.Executor
+
+	mu      sync.RWMutex
+	jobs    map[string]*Job
+	closing bool
+	running sync.WaitGroup
+}
+
+// NewManager creates an empty job manager that spawns processes through ex
+func NewManager(ex executor.Executor) *Manager {
+	return &Manager{executor: ex, jobs: make(map[string]*Job)}
+}
+
+// Start launches args in the background and returns the new job
+func (m *Manager) Start(args []string) (*Job, error) {
+	return m.StartApproved(context.Background(), args, nil)
+}
+
+// StartApproved is Start for commands that need a decision first. The job
+// waits as awaiting_approval until approve returns, and fails without running
+// anything if it returns an error. With a nil approve the job starts at once.
+// The job is traced as a child of the span in parent, whose cancellation it
+// does not follow.
+func (m *Manager) StartApproved(parent context.Context, args []string, approve func(ctx context.Context) error) (*Job, error) {
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		return nil, ErrShuttingDown
+	}
+	m.running.Add(1)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		id:        encryption.GenerateReqId(),
+		command:   strings.Join(args, " "),
+		startedAt: time.Now(),
+		cancel:    cancel,
+		status:    StatusRunning,
+		maxLines:  m.MaxLines,
+		changed:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if job.maxLines <= 0 {
+		job.maxLines = DefaultMaxLines
+	}
+	if len(args) > 0 {
+		job.tool = args[0]
+	}
+	ctx, span := tracing.Start(tracing.WithParent(ctx, parent), "job",
+		attribute.String("spi.job.id", job.id), attribute.String("process.executable.name", metrics.CommandLabel(args, true)))
+
+	if approve == nil {
+		proc, err := m.executor.Start(ctx, executor.Spec{Args: args})
+		if err != nil {
+			tracing.End(span, err)
+			cancel()
+			m.running.Done()
+			return nil, err
+		}
+		m.add(job)
+		go m.wait(ctx, job, proc)
+		return job, nil
+	}
+
+	job.status = StatusAwaitingApproval
+	m.add(job)
+	go func() {
+		err := approve(ctx)
+		if err != nil {
+			metrics.PolicyDenials.Inc("not_approved")
+		}
+		var proc executor.Process
+		if err == nil {
+			proc, err = m.executor.Start(ctx, executor.Spec{Args: args})
+		}
+		if err != nil {
+			status := StatusFailed
+			if ctx.Err() != nil {
+				status = StatusCanceled
+			}
+			job.finish(status, -1, err)
+			m.publishFinished(job)
+			tracing.End(span, err)
+			cancel()
+			m.running.Done()
+			return
+		}
+		job.setStatus(StatusRunning)
+		m.Events.Publish(events.Event{Source: events.SourceJob, Task: job.id, Title: job.command, Status: events.StatusRunning})
+		m.wait(ctx, job, proc)
+	}()
+	return job, nil
+}
+
+// add registers job, forgets the finished jobs beyond the history and
+// announces job
+func (m *Manager) add(job *Job) {
+	m.mu.Lock()
+	m.jobs[job.id] = job
+	m.pruneLocked()
+	m.mu.Unlock()
+
+	event := events.Event{Source: events.SourceJob, Task: job.id, Title: job.command, Status: events.StatusRunning}
+	if job.status == StatusAwaitingApproval {
+		event.Status, event.Message = events.StatusPending, "awaiting approval"
+	}
+	m.Events.Publish(event)
+}
+
+// pruneLocked drops the oldest finished jobs beyond the history
+func (m *Manager) pruneLocked() {
+	limit := m.History
+	if limit <= 0 {
+		limit = DefaultHistory
+	}
+	var finished []Info
+	for _, job := range m.jobs {
+		if info := job.Info(); info.FinishedAt != nil {
+			finished = append(finished, info)
+		}
+	}
+	if len(finished) <= limit {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].FinishedAt.Before(*finished[k].FinishedAt)
+	})
+	for _, info := range finished[:len(finished)-limit] {
+		delete(m.jobs, info.ID)
+	}
+}
+
+// wait collects the output of proc until it exits and finishes job
+func (m *Manager) wait(ctx context.Context, job *Job, proc executor.Process) {
+	// Every line goes to the API stream and the UI, the log shows what the verbosity lets through
+	pipeline := output.New(job.tool, job.appendLine, func(line output.Line) {
+		m.Events.Publish(events.Event{Source: events.SourceJob, Task: job.id, Status: events.StatusInfo, Stream: line.Stream, Message: line.Text, Level: line.Level})
+	}, output.Shown(output.Log(execLog.With("job", job.id))))
+	started := time.Now()
+	streamErr := executor.Stream(proc, pipeline.Line)
+	code, err := proc.Wait()
+	metrics.CommandDuration.Observe(time.Since(started).Seconds(), metrics.CommandLabel([]string{job.tool}, true))
+	if err == nil {
+		err = streamErr
+	}
+	switch {
+	case ctx.Err() != nil:
+		err = ctx.Err()
+		job.finish(StatusCanceled, -1, err)
+	case err != nil:
+		job.finish(StatusFailed, code, err)
+	default:
+		job.finish(StatusSucceeded, 0, nil)
+	}
+	m.publishFinished(job)
+	tracing.End(trace.SpanFromContext(ctx), err)
+	job.cancel()
+	m.running.Done()
+}
+
+// publishFinished reports the final status of job
+func (m *Manager) publishFinished(job *Job) {
+	info := job.Info()
+	event := events.Event{Source: events.SourceJob, Task: info.ID, Title: info.Command, Status: events.StatusSucceeded, Error: info.Error}
+	switch info.Status {
+	case StatusFailed:
+		event.Status = events.StatusFailed
+	case StatusCanceled:
+		event.Status = events.StatusFailed
+		event.Message = "canceled"
+	}
+	m.Events.Publish(event)
+}
+
+// Get returns the job with the given ID
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, exists := m.jobs[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+// List returns snapshots of all known jobs, oldest first
+func (m *Manager) List() []Info {
+	m.mu.RLock()
+	infos := make([]Info, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		infos = append(infos, job.Info())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(infos, func(i, k int) bool {
+		return infos[i].StartedAt.Before(infos[k].StartedAt)
+	})
+	return infos
+}
+
+// Shutdown stops accepting new jobs and waits for the running ones. With drain
+// unset they are canceled right away, otherwise only once ctx is done, in
+// which case ctx.Err() is returned.
+func (m *Manager) Shutdown(ctx context.Context, drain bool) error {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(finished)
+	}()
+	if !drain {
+		m.cancelAll()
+		<-finished
+		return nil
+	}
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		m.cancelAll()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// cancelAll cancels every job that is still running
+func (m *Manager) cancelAll() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, job := range m.jobs {
+		job.Cancel()
+	}
+}
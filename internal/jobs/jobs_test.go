@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"spi-go-core/internal/executor"
+)
+
+func TestShutdownDrainsJobs(t *testing.T) {
+	fake := executor.NewFake(executor.Script{Match: []string{"pwd"}, Stdout: []string{"/"}, Delay: 10 * time.Millisecond})
+	m := NewManager(fake)
+	job, err := m.Start([]string{"pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Shutdown(context.Background(), true); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if info := job.Info(); info.Status != StatusSucceeded {
+		t.Errorf("Expected the job to finish, got %s", info.Status)
+	}
+	if _, err := m.Start([]string{"pwd"}); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected new jobs to be refused, got %v", err)
+	}
+}
+
+func TestShutdownCancelsAtDeadline(t *testing.T) {
+	fake := executor.NewFake(executor.Script{Match: []string{"sleep"}, Stdout: []string{"done"}, Delay: time.Hour})
+	m := NewManager(fake)
+	job, err := m.Start([]string{"sleep", "60"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to be reported, got %v", err)
+	}
+	if info := job.Info(); info.Status != StatusCanceled {
+		t.Errorf("Expected the job to be canceled, got %s", info.Status)
+	}
+
+	// Without draining, jobs are canceled right away
+	m = NewManager(fake)
+	job, _ = m.Start([]string{"sleep", "60"})
+	if err := m.Shutdown(context.Background(), false); err != nil || job.Info().Status != StatusCanceled {
+		t.Errorf("Expected an immediate cancel, got %v and %s", err, job.Info().Status)
+	}
+}
+
+func TestFinishedJobsBeyondTheHistoryAreDropped(t *testing.T) {
+	fake := executor.NewFake(executor.Script{Match: []string{"sleep"}, Stdout: []string{"done"}, Delay: time.Hour}, executor.Script{Match: []string{"pwd"}})
+	m := NewManager(fake)
+	m.History = 2
+	defer m.Shutdown(context.Background(), false)
+
+	sleeper, err := m.Start([]string{"sleep", "60"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finished []*Job
+	for range 4 {
+		job, err := m.Start([]string{"pwd"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-job.Done()
+		finished = append(finished, job)
+	}
+
+	// Starting the fourth job dropped the first, the fourth finished afterwards
+	if _, err := m.Get(finished[0].ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the oldest finished job to be dropped, got %v", err)
+	}
+	for _, job := range append(finished[1:], sleeper) {
+		if _, err := m.Get(job.ID()); err != nil {
+			t.Errorf("Expected job %s to be kept: %v", job.ID(), err)
+		}
+	}
+	if infos := m.List(); len(infos) != 4 {
+		t.Errorf("Expected 4 jobs, got %+v", infos)
+	}
+}
+
+func TestOnlyTheLastLinesAreKept(t *testing.T) {
+	fake := executor.NewFake(executor.Script{Match: []string{"seq"}, Stdout: []string{"1", "2", "3", "4", "5"}})
+	m := NewManager(fake)
+	m.MaxLines = 3
+	job, err := m.Start([]string{"seq", "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-job.Done()
+
+	// The first two lines were dropped, the others keep their Seq
+	lines, done, _ := job.Lines(0)
+	if !done || len(lines) != 3 || lines[0].Seq != 2 || lines[0].Text != "3" || lines[2].Seq != 4 || lines[2].Text != "5" {
+		t.Fatalf("Expected lines 2 to 4, got %+v", lines)
+	}
+	if lines, _, _ := job.Lines(4); len(lines) != 1 || lines[0].Text != "5" {
+		t.Errorf("Expected the last line from Seq 4, got %+v", lines)
+	}
+	if lines, _, _ := job.Lines(5); len(lines) != 0 {
+		t.Errorf("Expected no lines past the end, got %+v", lines)
+	}
+	if info := job.Info(); info.Lines != 5 {
+		t.Errorf("Expected all 5 lines to be counted, got %d", info.Lines)
+	}
+}
@@ -0,0 +1,290 @@
+// Package logging is the structured log of the core, built on log/slog. Every
+// component logs through For, which adds the component, the request and
+// session IDs and the trace of the context to each line, applies the
+// component's level and redacts secrets. Lines go to stderr, or to the UI
+// while it owns the terminal, and to a rotated file. Plain log.Printf calls
+// end up here too.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/output"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Components, as logging.levels names them
+const (
+	Server    = "server"
+	Config    = "config"
+	Handshake = "handshake"
+	Exec      = "exec"
+	Setup     = "setup"
+	App       = "app"
+	UI        = "ui"
+)
+
+// state is the configuration every logger shares, so loggers created before
+// Configure or a reload follow it too
+type state struct {
+	mu       sync.RWMutex
+	base     slog.Level
+	levels   map[string]slog.Level
+	format   string
+	console  slog.Handler
+	file     slog.Handler
+	closer   io.Closer
+	rotation Rotation
+}
+
+var current = &state{
+	levels:  map[string]slog.Level{},
+	format:  "text",
+	console: newHandler(os.Stderr, "text"),
+}
+
+func newHandler(w io.Writer, format string) slog.Handler {
+	options := &slog.HandlerOptions{Level: slog.LevelDebug} // the levels are checked before
+	if format == "json" {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// BaseLevel returns the level of components without one of their own for a
+// logging.verbosity: warnings for quiet, debug for debug and info otherwise
+func BaseLevel(verbosity string) slog.Level {
+	switch verbosity {
+	case "quiet":
+		return slog.LevelWarn
+	case "debug":
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// Configure applies cfg: the format, the levels, the file and its rotation.
+// It makes the core's logger the default, so the log package and slog's
+// top-level functions write through it. Reloads call it again.
+func Configure(cfg config.Logging) error {
+	levels := map[string]slog.Level{}
+	for _, entry := range cfg.Levels {
+		component, name, _ := strings.Cut(entry, "=")
+		level, err := ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("invalid logging.levels entry %q: %v", entry, err)
+		}
+		levels[component] = level
+	}
+	format := cfg.Format
+	if format == "" {
+		format = "text"
+	}
+	rotation := Rotation{
+		MaxSize:    int64(cfg.MaxSizeMB) << 20,
+		MaxAge:     time.Duration(cfg.MaxAgeDays) * 24 * time.Hour,
+		MaxBackups: cfg.MaxBackups,
+	}
+
+	var file slog.Handler
+	var closer io.Closer
+	if cfg.File != "" {
+		f, err := OpenFile(cfg.File, rotation)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %v", err)
+		}
+		file, closer = newHandler(f, format), f
+	}
+
+	current.mu.Lock()
+	old := current.closer
+	current.base, current.levels, current.rotation = BaseLevel(cfg.Verbosity), levels, rotation
+	if format != current.format {
+		current.format, current.console = format, newHandler(os.Stderr, format)
+	}
+	current.file, current.closer = file, closer
+	current.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	slog.SetDefault(slog.New(&handler{s: current}))
+	// After SetDefault, so the log package writes to logWriter rather than slog's bridge
+	log.SetOutput(logWriter{})
+	log.SetFlags(0)
+	return nil
+}
+
+// logWriter logs the lines of the log package at the level their wording
+// suggests: errors and warnings as such, everything else as info
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	level := slog.LevelInfo
+	switch leveled, _ := output.Generic.Classify("", message); leveled {
+	case output.LevelError:
+		level = slog.LevelError
+	case output.LevelWarn:
+		level = slog.LevelWarn
+	}
+	slog.Default().Log(context.Background(), level, message)
+	return len(p), nil
+}
+
+// Close closes the log file; later lines only go to the console
+func Close() error {
+	current.mu.Lock()
+	closer := current.closer
+	current.file, current.closer = nil, nil
+	current.mu.Unlock()
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
+
+// CurrentRotation returns the rotation limits of logging.file, for other
+// files the core writes
+func CurrentRotation() Rotation {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	return current.rotation
+}
+
+// Redirect sends the lines meant for stderr to h instead until restore is
+// called, e.g. while the terminal UI owns the screen
+func Redirect(h slog.Handler) (restore func()) {
+	current.mu.Lock()
+	previous := current.console
+	current.console = h
+	current.mu.Unlock()
+	return func() {
+		current.mu.Lock()
+		current.console = previous
+		current.mu.Unlock()
+	}
+}
+
+// For returns the logger of component
+func For(component string) *slog.Logger {
+	return slog.New(&handler{s: current, component: component, attrs: []slog.Attr{slog.String("component", component)}})
+}
+
+type contextKey struct{}
+
+// ids are the request and session a context belongs to
+type ids struct {
+	request string
+	session string
+}
+
+// WithIDs returns a context whose log lines carry requestID and sessionID
+func WithIDs(ctx context.Context, requestID, sessionID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ids{request: requestID, session: sessionID})
+}
+
+// RequestID returns the request ID WithIDs attached to ctx
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(ids)
+	return id.request
+}
+
+// handler applies the levels, adds the IDs of the context, redacts and hands
+// each record to the console and the file of the shared state
+type handler struct {
+	s         *state
+	component string
+	attrs     []slog.Attr
+	group     string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	h.s.mu.RLock()
+	defer h.s.mu.RUnlock()
+	min, ok := h.s.levels[h.component]
+	if !ok {
+		min = h.s.base
+	}
+	return level >= min
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	record := slog.NewRecord(r.Time, r.Level, RedactText(r.Message), r.PC)
+	record.AddAttrs(h.attrs...)
+	if id, ok := ctx.Value(contextKey{}).(ids); ok {
+		if id.request != "" {
+			record.AddAttrs(slog.String("request_id", id.request))
+		}
+		if id.session != "" {
+			record.AddAttrs(slog.String("session", id.session))
+		}
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		record.AddAttrs(h.prepare(a))
+		return true
+	})
+
+	h.s.mu.RLock()
+	console, file := h.s.console, h.s.file
+	h.s.mu.RUnlock()
+	err := console.Handle(ctx, record)
+	if file != nil {
+		if fileErr := file.Handle(ctx, record); err == nil {
+			err = fileErr
+		}
+	}
+	return err
+}
+
+// prepare qualifies a by the group and redacts it
+func (h *handler) prepare(a slog.Attr) slog.Attr {
+	if h.group != "" {
+		a.Key = h.group + "." + a.Key
+	}
+	return Redact(a)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		if a.Key == "component" && h.group == "" {
+			next.component = a.Value.String()
+		}
+		next.attrs = append(next.attrs, h.prepare(a))
+	}
+	return &next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	next.group = name
+	return &next
+}
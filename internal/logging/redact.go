@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in log lines
+const Redacted = "[REDACTED]"
+
+// secretKey matches the attribute keys whose values are never logged: secrets,
+// passwords, tokens, challenges and anything about private keys, their paths
+// included
+var secretKey = regexp.MustCompile(`(?i)secret|passw|token|challenge|private|signature|authorization|cookie`)
+
+// pemBlock matches PEM encoded key material
+var pemBlock = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----[\s\S]*?(-----END [A-Z0-9 ]+-----|$)`)
+
+// Redact hides the value of a when its key names a secret or the value holds
+// key material. Groups are redacted member by member.
+func Redact(a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, member := range attrs {
+			redacted[i] = Redact(member)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	if secretKey.MatchString(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindString || a.Value.Kind() == slog.KindAny {
+		if text := a.Value.Resolve().String(); strings.Contains(text, "-----BEGIN ") {
+			return slog.String(a.Key, RedactText(text))
+		}
+	}
+	return a
+}
+
+// RedactText hides PEM blocks in text
+func RedactText(text string) string {
+	if !strings.Contains(text, "-----BEGIN ") {
+		return text
+	}
+	return pemBlock.ReplaceAllString(text, Redacted)
+}
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation limits a log file. Zero values mean no limit.
+type Rotation struct {
+	MaxSize    int64         // rotate before the file grows beyond this many bytes
+	MaxAge     time.Duration // rotate a file written to this long, delete rotated files this old
+	MaxBackups int           // rotated files kept
+}
+
+// backupTime names rotated files, sorting them by age
+const backupTime = "20060102-150405.000"
+
+// File is a log file that is rotated by size and age: the full file is
+// renamed with the time as a suffix and a new one started
+type File struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// OpenFile opens path for appending, creating its directory if needed
+func OpenFile(path string, rotation Rotation) (*File, error) {
+	f := &File{path: path, rotation: rotation, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.f, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+// Name returns the path of the current file
+func (f *File) Name() string {
+	return f.path
+}
+
+// Write appends p, rotating first if p would take the file beyond its limits
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := f.rotation.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.rotation.MaxSize
+	tooOld := f.rotation.MaxAge > 0 && f.size > 0 && f.now().Sub(f.opened) >= f.rotation.MaxAge
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and starts a new one, then deletes the
+// rotated files beyond the limits
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, f.path+"."+f.now().Format(backupTime)); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// Backups returns the rotated files, oldest first
+func (f *File) Backups() []string {
+	matches, _ := filepath.Glob(f.path + ".*")
+	backups := matches[:0]
+	for _, match := range matches {
+		if _, err := time.Parse(backupTime, strings.TrimPrefix(match, f.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+func (f *File) prune() {
+	backups := f.Backups()
+	for i, backup := range backups {
+		stamp, _ := time.ParseInLocation(backupTime, strings.TrimPrefix(backup, f.path+"."), time.Local)
+		tooMany := f.rotation.MaxBackups > 0 && len(backups)-i > f.rotation.MaxBackups
+		tooOld := f.rotation.MaxAge > 0 && f.now().Sub(stamp) > f.rotation.MaxAge
+		if tooMany || tooOld {
+			os.Remove(backup)
+		}
+	}
+}
+
+// Close closes the current file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
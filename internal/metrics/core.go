@@ -0,0 +1,48 @@
+package metrics
+
+import "path/filepath"
+
+// The core's metrics. Gauges of state other packages own, such as the active
+// sessions, are registered where that state is wired up.
+var (
+	HTTPRequests = Default.NewCounter("spi_http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "code")
+	HTTPDuration = Default.NewHistogram("spi_http_request_duration_seconds",
+		"Time taken to serve HTTP requests by route.", nil, "route")
+
+	HandshakeAttempts = Default.NewCounter("spi_handshake_attempts_total",
+		"Handshake requests by stage: key_exchange, verify or finalize.", "stage")
+	HandshakeFailures = Default.NewCounter("spi_handshake_failures_total",
+		"Handshake requests that failed, by stage.", "stage")
+
+	ExecRequests = Default.NewCounter("spi_exec_requests_total",
+		"Commands asked for through /api/exec and /api/jobs by endpoint, command and outcome.", "endpoint", "command", "outcome")
+	CommandDuration = Default.NewHistogram("spi_command_duration_seconds",
+		"Run time of the commands executed for exec requests and jobs.", nil, "command")
+	PolicyDenials = Default.NewCounter("spi_policy_denials_total",
+		"Commands and profile steps refused by the policy or the operator, by reason.", "reason")
+
+	SupervisorRestarts = Default.NewCounter("spi_supervisor_restarts_total",
+		"Restarts of supervised processes.", "process")
+	ConfigReloads = Default.NewCounter("spi_config_reloads_total",
+		"Configuration reloads by result: succeeded or failed.", "result")
+)
+
+// Outcomes of exec requests
+const (
+	OutcomeDenied      = "denied"       // refused by the command policy
+	OutcomeNotApproved = "not_approved" // refused or not decided by the operator
+	OutcomeStarted     = "started"      // a job was started
+	OutcomeSucceeded   = "succeeded"
+	OutcomeFailed      = "failed"
+)
+
+// CommandLabel returns the label of the program argv runs. Only allowed
+// commands should be labelled by name; pass allowed false for the others, so
+// clients cannot create a series per command they make up.
+func CommandLabel(argv []string, allowed bool) string {
+	if !allowed || len(argv) == 0 {
+		return "other"
+	}
+	return filepath.Base(argv[0])
+}
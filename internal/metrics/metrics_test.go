@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextFormat(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests.\nBy route.", "route", "code")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("sessions", "Sessions.", func() float64 { return 3 })
+
+	requests.Inc("/api/jobs", "200")
+	requests.Add(2, "/api/jobs", "200")
+	requests.Inc(`/say "hi"`, "404")
+	latency.Observe(0.05, "/api/jobs")
+	latency.Observe(0.5, "/api/jobs")
+	latency.Observe(5, "/api/jobs")
+
+	var out strings.Builder
+	r.Write(&out)
+	want := `# HELP requests_total Requests.\nBy route.
+# TYPE requests_total counter
+requests_total{route="/api/jobs",code="200"} 3
+requests_total{route="/say \"hi\"",code="404"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/api/jobs",le="0.1"} 1
+latency_seconds_bucket{route="/api/jobs",le="1"} 2
+latency_seconds_bucket{route="/api/jobs",le="+Inf"} 3
+latency_seconds_sum{route="/api/jobs"} 5.55
+latency_seconds_count{route="/api/jobs"} 3
+# HELP sessions Sessions.
+# TYPE sessions gauge
+sessions 3
+`
+	if out.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if requests.Value("/api/jobs", "200") != 3 || latency.Count("/api/jobs") != 3 {
+		t.Error("Expected the values back")
+	}
+}
+
+func TestHandlerRequiresTheToken(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("up_total", "Up.").Inc()
+	handler := r.Handler("s3cret")
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "s3cret": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Token %q: expected %d, got %d", token, want, rec.Code)
+		}
+		if want == http.StatusOK && !strings.Contains(rec.Body.String(), "up_total 1") {
+			t.Errorf("Expected the metrics, got %q", rec.Body.String())
+		}
+	}
+}
+
+func TestCommandLabelHidesDeniedCommands(t *testing.T) {
+	if got := CommandLabel([]string{"/usr/bin/ls", "-la"}, true); got != "ls" {
+		t.Errorf("Expected ls, got %q", got)
+	}
+	if got := CommandLabel([]string{"curl", "evil"}, false); got != "other" {
+		t.Errorf("Expected denied commands to share a label, got %q", got)
+	}
+}
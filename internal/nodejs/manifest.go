@@ -0,0 +1,136 @@
+// Package nodejs provisions the Node.js runtime the embedded TypeScript app
+// runs on: an official release tarball for the host architecture, verified
+// against a pinned SHA-256 manifest and unpacked into a private prefix.
+package nodejs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tarball is one pinned release artifact
+type Tarball struct {
+	File   string `json:"file"` // e.g. node-v20.18.1-linux-arm64.tar.gz
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest pins a Node.js release to one checksummed tarball per architecture
+type Manifest struct {
+	Version  string             `json:"version"`
+	Tarballs map[string]Tarball `json:"tarballs"` // keyed by GOARCH
+}
+
+// nodeArch maps GOARCH to the architecture names used in Node.js release file names
+var nodeArch = map[string]string{
+	"amd64":   "x64",
+	"arm64":   "arm64",
+	"arm":     "armv7l",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// LoadManifest reads and validates a manifest file
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid Node.js manifest %s: %v", path, err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Node.js manifest %s: %v", path, err)
+	}
+	return manifest, nil
+}
+
+// Validate checks that every entry carries a well-formed checksum for the pinned version
+func (m *Manifest) Validate() error {
+	if !strings.HasPrefix(m.Version, "v") {
+		return fmt.Errorf("version %q must look like v20.18.1", m.Version)
+	}
+	if len(m.Tarballs) == 0 {
+		return fmt.Errorf("no tarballs pinned")
+	}
+	for arch, tarball := range m.Tarballs {
+		if _, ok := nodeArch[arch]; !ok {
+			return fmt.Errorf("unsupported architecture %q", arch)
+		}
+		if tarball.File != fileName(m.Version, arch) {
+			return fmt.Errorf("%s: file %q does not match version %s", arch, tarball.File, m.Version)
+		}
+		if !sha256Pattern.MatchString(tarball.SHA256) {
+			return fmt.Errorf("%s: sha256 %q is not a hex SHA-256 digest", arch, tarball.SHA256)
+		}
+	}
+	return nil
+}
+
+// Save writes the manifest as indented JSON
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Tarball returns the pinned tarball for a GOARCH
+func (m *Manifest) Tarball(arch string) (Tarball, error) {
+	tarball, ok := m.Tarballs[arch]
+	if !ok {
+		return Tarball{}, fmt.Errorf("Node.js %s is not pinned for %s (pinned: %s)", m.Version, arch, strings.Join(m.arches(), ", "))
+	}
+	return tarball, nil
+}
+
+func (m *Manifest) arches() []string {
+	arches := make([]string, 0, len(m.Tarballs))
+	for arch := range m.Tarballs {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+	return arches
+}
+
+// PinFromSHASUMS builds a manifest from the SHASUMS256.txt published with
+// every Node.js release. Verify the file's signature before pinning it.
+func PinFromSHASUMS(version string, r io.Reader) (*Manifest, error) {
+	files := map[string]string{}
+	for arch := range nodeArch {
+		files[fileName(version, arch)] = arch
+	}
+
+	manifest := &Manifest{Version: version, Tarballs: map[string]Tarball{}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if arch, ok := files[fields[1]]; ok {
+			manifest.Tarballs[arch] = Tarball{File: fields[1], SHA256: strings.ToLower(fields[0])}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// fileName is the official Linux tarball name, e.g. node-v20.18.1-linux-x64.tar.gz
+func fileName(version, arch string) string {
+	return fmt.Sprintf("node-%s-linux-%s.tar.gz", version, nodeArch[arch])
+}
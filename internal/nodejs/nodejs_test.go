@@ -0,0 +1,196 @@
+package nodejs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVersion = "v20.18.1"
+
+type entry struct {
+	name, body, link string
+}
+
+// buildTarball returns a gzipped tarball shaped like an official release
+func buildTarball(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0755, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			header = &tar.Header{Name: e.name, Linkname: e.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func releaseTarball(t *testing.T) []byte {
+	root := "node-" + testVersion + "-linux-arm64/"
+	return buildTarball(t,
+		entry{name: root + "bin/node", body: "#!/bin/sh\necho node\n"},
+		entry{name: root + "lib/node_modules/npm/bin/npm-cli.js", body: "// npm\n"},
+		entry{name: root + "bin/npm", link: "../lib/node_modules/npm/bin/npm-cli.js"},
+	)
+}
+
+func manifestFor(data []byte) *Manifest {
+	sum := sha256.Sum256(data)
+	return &Manifest{Version: testVersion, Tarballs: map[string]Tarball{
+		"arm64": {File: fileName(testVersion, "arm64"), SHA256: hex.EncodeToString(sum[:])},
+	}}
+}
+
+func TestEnsureFromBundledTarball(t *testing.T) {
+	data := releaseTarball(t)
+	bundleDir := t.TempDir()
+	os.WriteFile(filepath.Join(bundleDir, fileName(testVersion, "arm64")), data, 0644)
+
+	p := &Provisioner{Manifest: manifestFor(data), Prefix: t.TempDir(), Arch: "arm64", OfflineDir: bundleDir, Offline: true}
+	rt, err := p.Ensure(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Ensure failed: %v", err)
+	}
+	if rt.Dir != filepath.Join(p.Prefix, "node-"+testVersion+"-linux-arm64") {
+		t.Errorf("Unexpected runtime dir %s", rt.Dir)
+	}
+	if _, err := os.Stat(rt.Node()); err != nil {
+		t.Errorf("node binary missing: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(rt.Dir, "bin", "npm")); err != nil || target != "../lib/node_modules/npm/bin/npm-cli.js" {
+		t.Errorf("npm symlink not preserved: %s (%v)", target, err)
+	}
+
+	// A second call finds the verified installation and does not need the tarball
+	os.RemoveAll(bundleDir)
+	var lines []string
+	if _, err := p.Ensure(context.Background(), func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatalf("Second Ensure failed: %v", err)
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], "already installed") {
+		t.Errorf("Expected the existing runtime to be reused: %v", lines)
+	}
+}
+
+func TestEnsureDownloads(t *testing.T) {
+	data := releaseTarball(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+testVersion+"/"+fileName(testVersion, "arm64") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	p := &Provisioner{Manifest: manifestFor(data), Prefix: t.TempDir(), Arch: "arm64", BaseURL: server.URL}
+	if _, err := p.Ensure(context.Background(), nil); err != nil {
+		t.Fatalf("Ensure failed: %v", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(p.Prefix, ".*"))
+	if len(leftovers) != 0 {
+		t.Errorf("Temporary files were left behind: %v", leftovers)
+	}
+}
+
+func TestEnsureStopsAStalledDownloadWhenCanceled(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000000")
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		close(stalled)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stalled
+		cancel()
+	}()
+	p := &Provisioner{Manifest: manifestFor(nil), Prefix: t.TempDir(), Arch: "arm64", BaseURL: server.URL}
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Ensure(ctx, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected the canceled download to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ensure kept waiting for the download after the cancel")
+	}
+}
+
+func TestEnsureRejectsChecksumMismatch(t *testing.T) {
+	data := releaseTarball(t)
+	bundleDir := t.TempDir()
+	os.WriteFile(filepath.Join(bundleDir, fileName(testVersion, "arm64")), append(data, 0), 0644)
+
+	p := &Provisioner{Manifest: manifestFor(data), Prefix: t.TempDir(), Arch: "arm64", OfflineDir: bundleDir, Offline: true}
+	_, err := p.Ensure(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected a checksum mismatch, got %v", err)
+	}
+	if entries, _ := os.ReadDir(p.Prefix); len(entries) != 0 {
+		t.Errorf("Nothing should be unpacked after a mismatch: %v", entries)
+	}
+}
+
+func TestEnsureOfflineWithoutTarball(t *testing.T) {
+	p := &Provisioner{Manifest: manifestFor(nil), Prefix: t.TempDir(), Arch: "arm64", OfflineDir: t.TempDir(), Offline: true}
+	if _, err := p.Ensure(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "offline mode") {
+		t.Errorf("Expected offline mode to refuse downloading, got %v", err)
+	}
+}
+
+func TestPinFromSHASUMS(t *testing.T) {
+	x64 := strings.Repeat("a", 64)
+	arm64 := strings.Repeat("b", 64)
+	shasums := strings.Join([]string{
+		x64 + "  node-v20.18.1-linux-x64.tar.gz",
+		strings.Repeat("c", 64) + "  node-v20.18.1-linux-x64.tar.xz",
+		arm64 + "  node-v20.18.1-linux-arm64.tar.gz",
+		strings.Repeat("d", 64) + "  node-v20.18.1-darwin-arm64.tar.gz",
+	}, "\n")
+
+	manifest, err := PinFromSHASUMS(testVersion, strings.NewReader(shasums))
+	if err != nil {
+		t.Fatalf("PinFromSHASUMS failed: %v", err)
+	}
+	if len(manifest.Tarballs) != 2 || manifest.Tarballs["amd64"].SHA256 != x64 || manifest.Tarballs["arm64"].SHA256 != arm64 {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	path := filepath.Join(t.TempDir(), "node-manifest.json")
+	if err := manifest.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadManifest(path); err != nil {
+		t.Errorf("Saved manifest does not load: %v", err)
+	}
+	if _, err := manifest.Tarball("386"); err == nil {
+		t.Error("Expected an unpinned architecture to fail")
+	}
+}
@@ -0,0 +1,222 @@
+package nodejs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"spi-go-core/internal/bundle"
+)
+
+// DefaultBaseURL is where official release tarballs are downloaded from
+const DefaultBaseURL = "https://nodejs.org/dist"
+
+// downloadClient fetches tarballs when the Provisioner has no HTTPClient. Its
+// timeout bounds a stalled mirror; shutdown cancels through the context.
+var downloadClient = &http.Client{Timeout: 10 * time.Minute}
+
+// checksumFile records the verified digest of an unpacked runtime
+const checksumFile = ".sha256"
+
+// Runtime is an unpacked Node.js installation
+type Runtime struct {
+	Version string
+	Dir     string
+}
+
+// Node returns the path of the node binary
+func (r *Runtime) Node() string {
+	return filepath.Join(r.Dir, "bin", "node")
+}
+
+// Env returns the environment for child processes with the runtime first on PATH
+func (r *Runtime) Env() []string {
+	env := []string{"PATH=" + filepath.Join(r.Dir, "bin") + string(os.PathListSeparator) + os.Getenv("PATH")}
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, "PATH=") {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
+
+// Provisioner makes the pinned runtime available below Prefix
+type Provisioner struct {
+	Manifest *Manifest
+	// Prefix holds one directory per unpacked runtime, e.g. Prefix/node-v20.18.1-linux-arm64
+	Prefix string
+	// Arch is the GOARCH to provision for, defaulting to the architecture of this binary
+	Arch       string
+	BaseURL    string
+	HTTPClient *http.Client
+	// OfflineDir is searched for the tarball before downloading, typically the
+	// directory of the binary. With Offline set nothing is ever downloaded.
+	OfflineDir string
+	Offline    bool
+}
+
+// Ensure returns the pinned runtime, fetching, verifying and unpacking it
+// first unless an intact copy is already present. progress, which may be nil,
+// receives one line per stage.
+func (p *Provisioner) Ensure(ctx context.Context, progress func(string)) (*Runtime, error) {
+	if progress == nil {
+		progress = func(string) {}
+	}
+	if p.Manifest == nil {
+		return nil, errors.New("no Node.js manifest configured")
+	}
+	arch := p.Arch
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	tarball, err := p.Manifest.Tarball(arch)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := &Runtime{Version: p.Manifest.Version, Dir: filepath.Join(p.Prefix, strings.TrimSuffix(tarball.File, ".tar.gz"))}
+	if p.installed(rt, tarball) {
+		progress(fmt.Sprintf("Node.js %s already installed in %s", rt.Version, rt.Dir))
+		return rt, nil
+	}
+	if err := os.MkdirAll(p.Prefix, 0755); err != nil {
+		return nil, err
+	}
+
+	path, cleanup, err := p.fetch(ctx, tarball, progress)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	progress("Verifying " + tarball.File)
+	if err := verify(path, tarball.SHA256); err != nil {
+		return nil, err
+	}
+
+	progress("Unpacking into " + rt.Dir)
+	if err := p.unpack(path, rt.Dir, tarball.SHA256); err != nil {
+		return nil, err
+	}
+	progress(fmt.Sprintf("Node.js %s ready", rt.Version))
+	return rt, nil
+}
+
+// installed reports whether rt was unpacked from the pinned tarball
+func (p *Provisioner) installed(rt *Runtime, tarball Tarball) bool {
+	recorded, err := os.ReadFile(filepath.Join(rt.Dir, checksumFile))
+	if err != nil || strings.TrimSpace(string(recorded)) != tarball.SHA256 {
+		return false
+	}
+	_, err = os.Stat(rt.Node())
+	return err == nil
+}
+
+// fetch returns a local path of the tarball, preferring a bundled copy, and a
+// function removing anything it downloaded
+func (p *Provisioner) fetch(ctx context.Context, tarball Tarball, progress func(string)) (string, func(), error) {
+	noop := func() {}
+	if p.OfflineDir != "" {
+		bundled := filepath.Join(p.OfflineDir, tarball.File)
+		if _, err := os.Stat(bundled); err == nil {
+			progress("Using bundled " + bundled)
+			return bundled, noop, nil
+		}
+	}
+	if p.Offline {
+		return "", noop, fmt.Errorf("offline mode: %s not found in %s", tarball.File, p.OfflineDir)
+	}
+
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	url := fmt.Sprintf("%s/%s/%s", strings.TrimRight(baseURL, "/"), p.Manifest.Version, tarball.File)
+	progress("Downloading " + url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", noop, err
+	}
+	client := p.HTTPClient
+	if client == nil {
+		client = downloadClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", noop, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	file, err := os.CreateTemp(p.Prefix, ".download-*")
+	if err != nil {
+		return "", noop, err
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	return file.Name(), cleanup, nil
+}
+
+// verify compares the SHA-256 of the file at path with the pinned digest
+func verify(path, expected string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: got %s, pinned %s", filepath.Base(path), actual, expected)
+	}
+	return nil
+}
+
+// unpack extracts the tarball next to dir and swaps it into place, so a
+// failed or interrupted extraction never leaves a half-written runtime behind
+func (p *Provisioner) unpack(path, dir, digest string) error {
+	staging, err := os.MkdirTemp(p.Prefix, ".unpack-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// Release tarballs have a single node-vX-linux-ARCH/ top-level directory
+	if err := bundle.ExtractTarGz(file, staging, 1); err != nil {
+		return fmt.Errorf("failed to unpack %s: %v", filepath.Base(path), err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, checksumFile), []byte(digest+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(staging, dir)
+}
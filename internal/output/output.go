@@ -0,0 +1,255 @@
+// Package output classifies the lines subprocesses print and fans them out to
+// the log, the terminal, the UI and the API streams. Every consumer filters by
+// the same verbosity, so quiet, normal, verbose and debug mean the same thing
+// everywhere.
+package output
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is how important a line of output is, most important first. The zero
+// Level means the line was not classified.
+type Level int
+
+const (
+	LevelError    Level = iota + 1
+	LevelWarn           // something the operator may need to look at
+	LevelProgress       // a milestone, e.g. a package installed or a step done
+	LevelInfo           // ordinary output
+	LevelDebug
+)
+
+var levelNames = map[Level]string{
+	LevelError:    "error",
+	LevelWarn:     "warn",
+	LevelProgress: "progress",
+	LevelInfo:     "info",
+	LevelDebug:    "debug",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// MarshalText encodes the level by name
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes a level name; an empty name is the zero Level
+func (l *Level) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*l = 0
+		return nil
+	}
+	for level, name := range levelNames {
+		if name == string(text) {
+			*l = level
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output level %q", text)
+}
+
+// MaxLevel returns the least important level verbosity shows: errors only for
+// quiet, progress and above for normal (or empty), everything but debug for
+// verbose and everything for debug
+func MaxLevel(verbosity string) Level {
+	switch verbosity {
+	case "quiet":
+		return LevelError
+	case "verbose":
+		return LevelInfo
+	case "debug":
+		return LevelDebug
+	default:
+		return LevelProgress
+	}
+}
+
+// maxLevel is the level of the running logging.verbosity
+var maxLevel atomic.Int32
+
+func init() {
+	SetVerbosity("normal")
+}
+
+// SetVerbosity applies logging.verbosity to every consumer; reloads call it again
+func SetVerbosity(verbosity string) {
+	maxLevel.Store(int32(MaxLevel(verbosity)))
+}
+
+// MaxShown returns the least important level the running verbosity shows
+func MaxShown() Level {
+	return Level(maxLevel.Load())
+}
+
+// Shows reports whether the running verbosity shows lines of level l.
+// Unclassified lines count as info.
+func Shows(l Level) bool {
+	if l == 0 {
+		l = LevelInfo
+	}
+	return l <= MaxShown()
+}
+
+// Debugging reports whether the verbosity is debug
+func Debugging() bool {
+	return MaxShown() == LevelDebug
+}
+
+// Classifier assigns a level to a line, reporting false if it has no opinion
+type Classifier interface {
+	Classify(stream, text string) (Level, bool)
+}
+
+// ClassifierFunc adapts a function to Classifier
+type ClassifierFunc func(stream, text string) (Level, bool)
+
+// Classify implements Classifier
+func (f ClassifierFunc) Classify(stream, text string) (Level, bool) {
+	return f(stream, text)
+}
+
+// Rule gives the lines matching Pattern a level
+type Rule struct {
+	Pattern *regexp.Regexp
+	Level   Level
+}
+
+// Rules classify a line by the first rule matching it
+type Rules []Rule
+
+// Classify implements Classifier
+func (r Rules) Classify(stream, text string) (Level, bool) {
+	for _, rule := range r {
+		if rule.Pattern.MatchString(text) {
+			return rule.Level, true
+		}
+	}
+	return 0, false
+}
+
+// Generic classifies the output of tools without rules of their own by its wording
+var Generic = Rules{
+	{regexp.MustCompile(`(?i)\b(error|errors|fatal|failed|failure)\b|^E: `), LevelError},
+	{regexp.MustCompile(`(?i)\b(warn|warning|deprecated)\b|^W: `), LevelWarn},
+	{regexp.MustCompile(`(?i)\b(done|complete|completed|finished|success|successfully|installed)\b|\b\d{1,3}%|\(\d+/\d+\)`), LevelProgress},
+}
+
+var (
+	classifiersMu sync.RWMutex
+	classifiers   = map[string]Classifier{
+		"npm": Rules{
+			{regexp.MustCompile(`^npm (ERR!|error)`), LevelError},
+			{regexp.MustCompile(`^npm (WARN|warn)`), LevelWarn},
+			{regexp.MustCompile(`^(added|removed|changed|updated) \d+ packages?`), LevelProgress},
+			{regexp.MustCompile(`^npm (http|timing|verb|sill)`), LevelDebug},
+		},
+	}
+)
+
+// Register sets the classifier for the program tool, e.g. "apt-get"
+func Register(tool string, c Classifier) {
+	classifiersMu.Lock()
+	defer classifiersMu.Unlock()
+	classifiers[tool] = c
+}
+
+// Classify returns the level of a line tool printed: what the classifier
+// registered for it says, else what Generic says, else info
+func Classify(tool, stream, text string) Level {
+	classifiersMu.RLock()
+	c := classifiers[filepath.Base(tool)]
+	classifiersMu.RUnlock()
+	if c != nil {
+		if level, ok := c.Classify(stream, text); ok {
+			return level
+		}
+	}
+	if level, ok := Generic.Classify(stream, text); ok {
+		return level
+	}
+	return LevelInfo
+}
+
+// Line is one classified line of output
+type Line struct {
+	Tool   string
+	Stream string // "stdout" or "stderr"
+	Text   string
+	Level  Level
+}
+
+// Sink receives the lines of a pipeline. Sinks of one pipeline are called one
+// line at a time.
+type Sink func(Line)
+
+// Pipeline classifies the output of one process and passes every line to its
+// sinks. Wrap a sink in Shown to apply the verbosity.
+type Pipeline struct {
+	tool  string
+	sinks []Sink
+	mu    sync.Mutex
+}
+
+// New returns a pipeline for the output of tool, usually argv[0]
+func New(tool string, sinks ...Sink) *Pipeline {
+	return &Pipeline{tool: tool, sinks: sinks}
+}
+
+// Line classifies a line and fans it out. It has the shape of
+// executor.LineFunc, so p.Line can be passed where one is wanted.
+func (p *Pipeline) Line(stream, text string) {
+	line := Line{Tool: p.tool, Stream: stream, Text: text, Level: Classify(p.tool, stream, text)}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sink := range p.sinks {
+		sink(line)
+	}
+}
+
+// Shown passes on the lines the running verbosity shows
+func Shown(sink Sink) Sink {
+	return func(line Line) {
+		if Shows(line.Level) {
+			sink(line)
+		}
+	}
+}
+
+// slogLevels are the log levels of the output levels; progress is logged as info
+var slogLevels = map[Level]slog.Level{
+	LevelError:    slog.LevelError,
+	LevelWarn:     slog.LevelWarn,
+	LevelProgress: slog.LevelInfo,
+	LevelInfo:     slog.LevelInfo,
+	LevelDebug:    slog.LevelDebug,
+}
+
+// Log writes lines to logger at the log level of their output level, with the
+// tool and the stream as attributes
+func Log(logger *slog.Logger) Sink {
+	return func(line Line) {
+		level, ok := slogLevels[line.Level]
+		if !ok {
+			level = slog.LevelInfo
+		}
+		logger.Log(context.Background(), level, line.Text, "tool", filepath.Base(line.Tool), "stream", line.Stream)
+	}
+}
+
+// Writer writes the text of each line to w, e.g. a log file or the terminal
+func Writer(w io.Writer) Sink {
+	return func(line Line) {
+		fmt.Fprintln(w, line.Text)
+	}
+}
@@ -0,0 +1,85 @@
+package output
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestClassifyFallsBackToGenericRules(t *testing.T) {
+	for _, c := range []struct {
+		tool, line string
+		want       Level
+	}{
+		{"npm", "npm ERR! code ENOENT", LevelError},
+		{"/usr/local/bin/npm", "npm WARN deprecated inflight@1.0.6", LevelWarn},
+		{"npm", "added 120 packages in 3s", LevelProgress},
+		{"npm", "npm timing idealTree Completed in 20ms", LevelDebug},
+		{"curl", "curl: (6) Could not resolve host: failed", LevelError},
+		{"tar", "extracting 45%", LevelProgress},
+		{"tar", "node-v20/bin/node", LevelInfo},
+	} {
+		if got := Classify(c.tool, "stderr", c.line); got != c.want {
+			t.Errorf("%s %q classified as %s, want %s", c.tool, c.line, got, c.want)
+		}
+	}
+}
+
+func TestRegisteredRulesComeFirst(t *testing.T) {
+	Register("mytool", Rules{{regexp.MustCompile(`^ok `), LevelDebug}})
+	if got := Classify("mytool", "stdout", "ok all done"); got != LevelDebug {
+		t.Errorf("Expected the registered rule to win, got %s", got)
+	}
+	if got := Classify("mytool", "stdout", "build failed"); got != LevelError {
+		t.Errorf("Expected unmatched lines to fall back to the generic rules, got %s", got)
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	defer SetVerbosity("normal")
+	for verbosity, shown := range map[string][]Level{
+		"quiet":   {LevelError},
+		"normal":  {LevelError, LevelWarn, LevelProgress},
+		"verbose": {LevelError, LevelWarn, LevelProgress, LevelInfo},
+		"debug":   {LevelError, LevelWarn, LevelProgress, LevelInfo, LevelDebug},
+	} {
+		SetVerbosity(verbosity)
+		count := 0
+		for level := LevelError; level <= LevelDebug; level++ {
+			if Shows(level) {
+				count++
+			}
+		}
+		if count != len(shown) || !Shows(shown[len(shown)-1]) {
+			t.Errorf("%s shows %d levels, want %v", verbosity, count, shown)
+		}
+	}
+}
+
+func TestPipelineFansOut(t *testing.T) {
+	defer SetVerbosity("normal")
+	SetVerbosity("quiet")
+
+	var all, shown []Line
+	var file strings.Builder
+	p := New("apt-get", func(line Line) { all = append(all, line) }, Shown(func(line Line) { shown = append(shown, line) }), Writer(&file))
+	p.Line("stdout", "Reading package lists...")
+	p.Line("stderr", "E: Unable to locate package nope")
+
+	if len(all) != 2 || len(shown) != 1 || shown[0].Level != LevelError || shown[0].Tool != "apt-get" {
+		t.Errorf("Unexpected lines %+v and %+v", all, shown)
+	}
+	if file.String() != "Reading package lists...\nE: Unable to locate package nope\n" {
+		t.Errorf("Unexpected file contents %q", file.String())
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	var level Level
+	if err := level.UnmarshalText([]byte("progress")); err != nil || level != LevelProgress {
+		t.Errorf("Expected progress, got %s (%v)", level, err)
+	}
+	if err := level.UnmarshalText([]byte("loud")); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+}
@@ -0,0 +1,343 @@
+package pkg
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// queryFunc runs a read-only command, see manager.query
+type queryFunc func(ctx context.Context, args ...string) (stdout string, found bool, err error)
+
+// backend describes how to drive one package manager
+type backend struct {
+	name    string
+	install []string
+	remove  []string
+	update  []string
+	// pin joins a name and a version in install arguments; empty if the tool cannot pin
+	pin string
+	// env is added to the environment of changing commands
+	env []string
+
+	installed func(ctx context.Context, query queryFunc, name string) (string, error)
+	available func(ctx context.Context, query queryFunc, name string) (string, error)
+	// parse classifies one line of install, remove or update output
+	parse func(line string) Event
+}
+
+var backends = []backend{
+	{
+		name:    "apt-get",
+		install: []string{"apt-get", "install", "-y"},
+		remove:  []string{"apt-get", "remove", "-y"},
+		update:  []string{"apt-get", "update"},
+		pin:     "=",
+		env:     []string{"DEBIAN_FRONTEND=noninteractive"},
+		installed: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			out, found, err := query(ctx, "dpkg-query", "-W", "-f=${Status} ${Version}", name)
+			if !found || !strings.HasPrefix(out, "install ok installed") {
+				return "", err
+			}
+			return strings.TrimSpace(strings.TrimPrefix(out, "install ok installed")), nil
+		},
+		available: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			out, _, err := query(ctx, "apt-cache", "policy", name)
+			if version := field(out, "Candidate:"); version != "(none)" {
+				return version, err
+			}
+			return "", err
+		},
+		parse: parseApt,
+	},
+	{
+		name:      "dnf",
+		install:   []string{"dnf", "install", "-y"},
+		remove:    []string{"dnf", "remove", "-y"},
+		update:    []string{"dnf", "makecache"},
+		pin:       "-",
+		installed: rpmInstalled,
+		available: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			return yumAvailable(ctx, query, "dnf", name)
+		},
+		parse: parseYum,
+	},
+	{
+		name:      "yum",
+		install:   []string{"yum", "install", "-y"},
+		remove:    []string{"yum", "remove", "-y"},
+		update:    []string{"yum", "makecache"},
+		pin:       "-",
+		installed: rpmInstalled,
+		available: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			return yumAvailable(ctx, query, "yum", name)
+		},
+		parse: parseYum,
+	},
+	{
+		name:      "zypper",
+		install:   []string{"zypper", "--non-interactive", "install"},
+		remove:    []string{"zypper", "--non-interactive", "remove"},
+		update:    []string{"zypper", "--non-interactive", "refresh"},
+		pin:       "=",
+		installed: rpmInstalled,
+		available: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			out, _, err := query(ctx, "zypper", "--non-interactive", "--quiet", "info", name)
+			return field(out, "Version"), err
+		},
+		parse: parseZypper,
+	},
+	{
+		name:    "apk",
+		install: []string{"apk", "add"},
+		remove:  []string{"apk", "del"},
+		update:  []string{"apk", "update"},
+		pin:     "=",
+		installed: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			out, _, err := query(ctx, "apk", "list", "--installed", name)
+			return apkVersion(out, name), err
+		},
+		available: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			out, _, err := query(ctx, "apk", "list", name)
+			return apkVersion(out, name), err
+		},
+		parse: parseApk,
+	},
+	{
+		name:    "pacman",
+		install: []string{"pacman", "-S", "--noconfirm", "--needed"},
+		remove:  []string{"pacman", "-R", "--noconfirm"},
+		update:  []string{"pacman", "-Sy"},
+		installed: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			out, found, err := query(ctx, "pacman", "-Q", name)
+			if fields := strings.Fields(out); found && len(fields) == 2 {
+				return fields[1], nil
+			}
+			return "", err
+		},
+		available: func(ctx context.Context, query queryFunc, name string) (string, error) {
+			out, _, err := query(ctx, "pacman", "-Si", name)
+			return field(out, "Version"), err
+		},
+		parse: parsePacman,
+	},
+}
+
+// rpmInstalled queries the rpm database shared by dnf, yum and zypper
+func rpmInstalled(ctx context.Context, query queryFunc, name string) (string, error) {
+	out, found, err := query(ctx, "rpm", "-q", "--qf", "%{VERSION}-%{RELEASE}", name)
+	if !found {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// yumAvailable reads the newest version from "list available", whose rows are "name.arch version repo"
+func yumAvailable(ctx context.Context, query queryFunc, tool, name string) (string, error) {
+	out, _, err := query(ctx, tool, "list", "available", "-q", name)
+	version := ""
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.HasPrefix(fields[0], name+".") {
+			version = fields[1]
+		}
+	}
+	return version, err
+}
+
+// apkVersion extracts the version from "apk list" rows such as "curl-8.5.0-r0 x86_64 {curl} (MIT)"
+func apkVersion(out, name string) string {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], name+"-") {
+			continue
+		}
+		version := strings.TrimPrefix(fields[0], name+"-")
+		// "curl-dev-8.5.0-r0" also starts with "curl-"
+		if version != "" && version[0] >= '0' && version[0] <= '9' {
+			return version
+		}
+	}
+	return ""
+}
+
+// field returns the value of the first "Key: value" or "Key   : value" line
+func field(out, key string) string {
+	key = strings.TrimSuffix(key, ":")
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// splitNEVRA splits an rpm file name like "1:curl-7.76.1-26.el9.x86_64" into name and version-release
+func splitNEVRA(nevra string) (string, string) {
+	nevra = strings.TrimSuffix(nevra, ".rpm")
+	if _, rest, ok := strings.Cut(nevra, ":"); ok {
+		nevra = rest
+	}
+	if i := strings.LastIndex(nevra, "."); i > 0 {
+		nevra = nevra[:i]
+	}
+	release := strings.LastIndex(nevra, "-")
+	if release <= 0 {
+		return nevra, ""
+	}
+	version := strings.LastIndex(nevra[:release], "-")
+	if version <= 0 {
+		return nevra, ""
+	}
+	return nevra[:version], nevra[version+1:]
+}
+
+// trimArch drops the ":amd64" suffix dpkg adds on multi-arch systems
+func trimArch(name string) string {
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+var (
+	aptFetch   = regexp.MustCompile(`^Get:\d+ \S+ \S+ \S+ (\S+) \S+ (\S+) \[`)
+	aptPackage = regexp.MustCompile(`^(Unpacking|Setting up|Removing) (\S+) \(([^)]+)\)`)
+)
+
+func parseApt(line string) Event {
+	switch {
+	case strings.HasPrefix(line, "E: "), strings.HasPrefix(line, "dpkg: error"):
+		return Event{Kind: EventError}
+	case strings.HasPrefix(line, "W: "):
+		return Event{Kind: EventWarning}
+	}
+	if m := aptFetch.FindStringSubmatch(line); m != nil {
+		return Event{Kind: EventDownload, Package: m[1], Version: m[2]}
+	}
+	if m := aptPackage.FindStringSubmatch(line); m != nil {
+		kind := map[string]EventKind{"Unpacking": EventInstall, "Setting up": EventConfigure, "Removing": EventRemove}[m[1]]
+		return Event{Kind: kind, Package: trimArch(m[2]), Version: m[3]}
+	}
+	if strings.HasPrefix(line, "Get:") || strings.HasPrefix(line, "Hit:") || strings.HasPrefix(line, "Ign:") {
+		return Event{Kind: EventRefresh}
+	}
+	return Event{Kind: EventInfo}
+}
+
+var (
+	yumStep     = regexp.MustCompile(`^\s*(Installing|Upgrading|Reinstalling|Downgrading|Erasing|Removing|Running scriptlet)\s*: (\S+)\s+(\d+)/(\d+)`)
+	yumDownload = regexp.MustCompile(`^\((\d+)/(\d+)\): (\S+\.rpm)`)
+)
+
+func parseYum(line string) Event {
+	switch {
+	case strings.HasPrefix(line, "Error:"), strings.HasPrefix(line, "No match for argument"):
+		return Event{Kind: EventError}
+	case strings.HasPrefix(line, "Warning:"):
+		return Event{Kind: EventWarning}
+	case strings.Contains(line, "metadata"):
+		return Event{Kind: EventRefresh}
+	}
+	if m := yumDownload.FindStringSubmatch(line); m != nil {
+		name, version := splitNEVRA(m[3])
+		return Event{Kind: EventDownload, Package: name, Version: version, Current: atoi(m[1]), Total: atoi(m[2])}
+	}
+	if m := yumStep.FindStringSubmatch(line); m != nil {
+		kind := EventInstall
+		switch m[1] {
+		case "Erasing", "Removing":
+			kind = EventRemove
+		case "Running scriptlet":
+			kind = EventConfigure
+		}
+		name, version := splitNEVRA(m[2])
+		return Event{Kind: kind, Package: name, Version: version, Current: atoi(m[3]), Total: atoi(m[4])}
+	}
+	return Event{Kind: EventInfo}
+}
+
+var (
+	zypperDownload = regexp.MustCompile(`^Retrieving package (\S+) \((\d+)/(\d+)\)`)
+	zypperStep     = regexp.MustCompile(`^\((\d+)/(\d+)\) (Installing|Removing):? (\S+)`)
+)
+
+func parseZypper(line string) Event {
+	switch {
+	case strings.HasPrefix(line, "ERROR"), strings.HasPrefix(line, "Problem:"), strings.HasPrefix(line, "No provider of"):
+		return Event{Kind: EventError}
+	case strings.HasPrefix(line, "Warning:"):
+		return Event{Kind: EventWarning}
+	case strings.HasPrefix(line, "Retrieving repository"), strings.HasPrefix(line, "Building repository"), strings.HasPrefix(line, "Refreshing"):
+		return Event{Kind: EventRefresh}
+	}
+	if m := zypperDownload.FindStringSubmatch(line); m != nil {
+		name, version := splitNEVRA(m[1])
+		return Event{Kind: EventDownload, Package: name, Version: version, Current: atoi(m[2]), Total: atoi(m[3])}
+	}
+	if m := zypperStep.FindStringSubmatch(line); m != nil {
+		kind := EventInstall
+		if m[3] == "Removing" {
+			kind = EventRemove
+		}
+		name, version := splitNEVRA(m[4])
+		return Event{Kind: kind, Package: name, Version: version, Current: atoi(m[1]), Total: atoi(m[2])}
+	}
+	return Event{Kind: EventInfo}
+}
+
+var apkStep = regexp.MustCompile(`^\((\d+)/(\d+)\) (Installing|Upgrading|Downgrading|Purging|Deleting) (\S+) \(([^)]+)\)`)
+
+func parseApk(line string) Event {
+	switch {
+	case strings.HasPrefix(line, "ERROR:"):
+		return Event{Kind: EventError}
+	case strings.HasPrefix(line, "WARNING:"):
+		return Event{Kind: EventWarning}
+	case strings.HasPrefix(line, "fetch "):
+		return Event{Kind: EventRefresh}
+	case strings.HasPrefix(line, "Executing "):
+		return Event{Kind: EventConfigure}
+	}
+	if m := apkStep.FindStringSubmatch(line); m != nil {
+		kind := EventInstall
+		if m[3] == "Purging" || m[3] == "Deleting" {
+			kind = EventRemove
+		}
+		// Upgrades are reported as "(old -> new)"
+		version := m[5]
+		if _, upgraded, ok := strings.Cut(version, " -> "); ok {
+			version = upgraded
+		}
+		return Event{Kind: kind, Package: m[4], Version: version, Current: atoi(m[1]), Total: atoi(m[2])}
+	}
+	return Event{Kind: EventInfo}
+}
+
+var pacmanStep = regexp.MustCompile(`^\(\s*(\d+)/(\d+)\) (installing|upgrading|reinstalling|downgrading|removing) (\S+)`)
+
+func parsePacman(line string) Event {
+	switch {
+	case strings.HasPrefix(line, "error:"):
+		return Event{Kind: EventError}
+	case strings.HasPrefix(line, "warning:"):
+		return Event{Kind: EventWarning}
+	case strings.HasPrefix(line, ":: Synchronizing"):
+		return Event{Kind: EventRefresh}
+	case strings.HasPrefix(strings.TrimSpace(line), "downloading "):
+		return Event{Kind: EventDownload}
+	}
+	if m := pacmanStep.FindStringSubmatch(line); m != nil {
+		kind := EventInstall
+		if m[3] == "removing" {
+			kind = EventRemove
+		}
+		return Event{Kind: kind, Package: m[4], Current: atoi(m[1]), Total: atoi(m[2])}
+	}
+	return Event{Kind: EventInfo}
+}
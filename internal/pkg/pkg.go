@@ -0,0 +1,259 @@
+// Package pkg drives the host package manager (apt, dnf, yum, zypper, apk or
+// pacman) through a single interface and turns its output into structured
+// progress events.
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/output"
+)
+
+// ErrNoManager is returned by Detect when none of the supported tools is installed
+var ErrNoManager = errors.New("no supported package manager found")
+
+// ErrPinUnsupported is returned when a version pin is requested from a tool that cannot install one
+var ErrPinUnsupported = errors.New("package manager does not support version pins")
+
+// Package is a package name with an optional pinned version
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// ParsePackage parses "name" or "name=version"
+func ParsePackage(spec string) Package {
+	name, version, _ := strings.Cut(strings.TrimSpace(spec), "=")
+	return Package{Name: name, Version: version}
+}
+
+func (p Package) String() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return p.Name + "=" + p.Version
+}
+
+// EventKind classifies a line of package manager output
+type EventKind string
+
+const (
+	EventInfo      EventKind = "info"
+	EventRefresh   EventKind = "refresh"   // a repository index is fetched
+	EventDownload  EventKind = "download"  // a package is downloaded
+	EventInstall   EventKind = "install"   // a package is unpacked or installed
+	EventConfigure EventKind = "configure" // post-install setup of a package
+	EventRemove    EventKind = "remove"
+	EventWarning   EventKind = "warning"
+	EventError     EventKind = "error"
+)
+
+// Level is how important lines of kind k are: errors and warnings as such,
+// changes to packages as progress and everything else as info
+func (k EventKind) Level() output.Level {
+	switch k {
+	case EventError:
+		return output.LevelError
+	case EventWarning:
+		return output.LevelWarn
+	case EventDownload, EventInstall, EventConfigure, EventRemove:
+		return output.LevelProgress
+	default:
+		return output.LevelInfo
+	}
+}
+
+func init() {
+	// Lines the parser cannot place are left to the generic rules
+	for i := range backends {
+		parse := backends[i].parse
+		output.Register(backends[i].name, output.ClassifierFunc(func(stream, text string) (output.Level, bool) {
+			kind := parse(text).Kind
+			return kind.Level(), kind != EventInfo
+		}))
+	}
+}
+
+// Event is one parsed line of package manager output
+type Event struct {
+	Kind    EventKind `json:"kind"`
+	Package string    `json:"package,omitempty"`
+	Version string    `json:"version,omitempty"`
+	// Current and Total give the position in the transaction when the tool reports it, e.g. (2/5)
+	Current int    `json:"current,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	Stream  string `json:"stream"`
+	Line    string `json:"line"`
+}
+
+// Level is how important the line is; lines the parser cannot place are
+// classified by their wording
+func (e Event) Level() output.Level {
+	if e.Kind == EventInfo {
+		return output.Classify("", e.Stream, e.Line)
+	}
+	return e.Kind.Level()
+}
+
+// EventFunc receives progress events while a package operation runs
+type EventFunc func(Event)
+
+// Manager installs, removes and queries packages with one tool
+type Manager interface {
+	// Name is the tool in use, e.g. "apt-get"
+	Name() string
+	// Installed returns the installed version of name, or "" if it is not installed
+	Installed(ctx context.Context, name string) (string, error)
+	// Available returns the version the repositories would install, or "" if there is none
+	Available(ctx context.Context, name string) (string, error)
+	Install(ctx context.Context, packages []Package, fn EventFunc) error
+	Remove(ctx context.Context, names []string, fn EventFunc) error
+	// Update refreshes the package index
+	Update(ctx context.Context, fn EventFunc) error
+
+	// InstallArgs, RemoveArgs and UpdateArgs return the commands the operations above run
+	InstallArgs(packages []Package) ([]string, error)
+	RemoveArgs(names []string) []string
+	UpdateArgs() []string
+}
+
+// Names lists the supported tools in the order Detect tries them
+func Names() []string {
+	names := make([]string, 0, len(backends))
+	for _, b := range backends {
+		names = append(names, b.name)
+	}
+	return names
+}
+
+// New returns the manager for the named tool, running commands through ex
+func New(name string, ex executor.Executor) (Manager, error) {
+	for i := range backends {
+		if backends[i].name == name {
+			return &manager{backend: &backends[i], executor: ex}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported package manager: %s", name)
+}
+
+// Detect returns the manager for the first supported tool found by lookPath,
+// which defaults to exec.LookPath
+func Detect(ex executor.Executor, lookPath func(string) (string, error)) (Manager, error) {
+	if lookPath == nil {
+		lookPath = exec.LookPath
+	}
+	for i := range backends {
+		if _, err := lookPath(backends[i].name); err == nil {
+			return &manager{backend: &backends[i], executor: ex}, nil
+		}
+	}
+	return nil, ErrNoManager
+}
+
+// manager implements Manager on top of a backend description
+type manager struct {
+	*backend
+	executor executor.Executor
+}
+
+func (m *manager) Name() string {
+	return m.name
+}
+
+func (m *manager) Installed(ctx context.Context, name string) (string, error) {
+	return m.installed(ctx, m.query, name)
+}
+
+func (m *manager) Available(ctx context.Context, name string) (string, error) {
+	return m.available(ctx, m.query, name)
+}
+
+func (m *manager) InstallArgs(packages []Package) ([]string, error) {
+	args := append([]string{}, m.install...)
+	for _, p := range packages {
+		if p.Version == "" {
+			args = append(args, p.Name)
+			continue
+		}
+		if m.pin == "" {
+			return nil, fmt.Errorf("%s: %w", m.name, ErrPinUnsupported)
+		}
+		args = append(args, p.Name+m.pin+p.Version)
+	}
+	return args, nil
+}
+
+func (m *manager) RemoveArgs(names []string) []string {
+	return append(append([]string{}, m.remove...), names...)
+}
+
+func (m *manager) UpdateArgs() []string {
+	return append([]string{}, m.update...)
+}
+
+func (m *manager) Install(ctx context.Context, packages []Package, fn EventFunc) error {
+	args, err := m.InstallArgs(packages)
+	if err != nil {
+		return err
+	}
+	return m.transaction(ctx, args, fn)
+}
+
+func (m *manager) Remove(ctx context.Context, names []string, fn EventFunc) error {
+	return m.transaction(ctx, m.RemoveArgs(names), fn)
+}
+
+func (m *manager) Update(ctx context.Context, fn EventFunc) error {
+	return m.transaction(ctx, m.UpdateArgs(), fn)
+}
+
+// transaction runs a changing command, parsing every output line into an event.
+// On failure the last error event, if any, explains what went wrong.
+func (m *manager) transaction(ctx context.Context, args []string, fn EventFunc) error {
+	var lastError string
+	_, err := executor.Run(ctx, m.executor, m.spec(args), func(stream, line string) {
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+		event := m.parse(line)
+		event.Stream, event.Line = stream, line
+		if event.Kind == EventError {
+			lastError = strings.TrimSpace(line)
+		}
+		if fn != nil {
+			fn(event)
+		}
+	})
+	if err != nil && lastError != "" {
+		return fmt.Errorf("%s failed: %s", args[0], lastError)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %v", args[0], err)
+	}
+	return nil
+}
+
+// query runs a read-only command and returns its stdout. found is false when
+// the tool exits non-zero, which all of them do for unknown packages.
+func (m *manager) query(ctx context.Context, args ...string) (stdout string, found bool, err error) {
+	result, err := executor.Run(ctx, m.executor, m.spec(args), nil)
+	var exitErr *executor.ExitError
+	if errors.As(err, &exitErr) {
+		return result.Stdout, false, nil
+	}
+	return result.Stdout, err == nil, err
+}
+
+func (m *manager) spec(args []string) executor.Spec {
+	spec := executor.Spec{Args: args}
+	if len(m.env) > 0 {
+		spec.Env = append(os.Environ(), m.env...)
+	}
+	return spec
+}
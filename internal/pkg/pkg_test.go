@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/output"
+)
+
+func newManager(t *testing.T, name string, scripts ...executor.Script) (Manager, *executor.Fake) {
+	t.Helper()
+	fake := executor.NewFake(scripts...)
+	m, err := New(name, fake)
+	if err != nil {
+		t.Fatalf("New(%s) failed: %v", name, err)
+	}
+	return m, fake
+}
+
+func TestInstallArgsWithPins(t *testing.T) {
+	packages := []Package{ParsePackage("nginx=1.24.0-1"), ParsePackage("curl")}
+	for name, expected := range map[string]string{
+		"apt-get": "apt-get install -y nginx=1.24.0-1 curl",
+		"dnf":     "dnf install -y nginx-1.24.0-1 curl",
+		"zypper":  "zypper --non-interactive install nginx=1.24.0-1 curl",
+		"apk":     "apk add nginx=1.24.0-1 curl",
+	} {
+		m, _ := newManager(t, name)
+		args, err := m.InstallArgs(packages)
+		if err != nil || strings.Join(args, " ") != expected {
+			t.Errorf("%s: got %v (%v), expected %q", name, args, err, expected)
+		}
+	}
+
+	m, _ := newManager(t, "pacman")
+	if _, err := m.InstallArgs(packages); !errors.Is(err, ErrPinUnsupported) {
+		t.Errorf("Expected pacman to reject pins, got %v", err)
+	}
+}
+
+func TestVersionQueries(t *testing.T) {
+	ctx := context.Background()
+
+	apt, _ := newManager(t, "apt-get",
+		executor.Script{Match: []string{"dpkg-query", "-W", "-f=${Status} ${Version}", "curl"}, Stdout: []string{"install ok installed 7.81.0-1ubuntu1.15"}},
+		executor.Script{Match: []string{"dpkg-query", "-W", "-f=${Status} ${Version}", "nginx"}, Stderr: []string{"dpkg-query: no packages found matching nginx"}, ExitCode: 1},
+		executor.Script{Match: []string{"apt-cache", "policy", "nginx"}, Stdout: []string{"nginx:", "  Installed: (none)", "  Candidate: 1.18.0-6ubuntu14.4"}},
+	)
+	if version, err := apt.Installed(ctx, "curl"); err != nil || version != "7.81.0-1ubuntu1.15" {
+		t.Errorf("apt Installed(curl) = %q, %v", version, err)
+	}
+	if version, err := apt.Installed(ctx, "nginx"); err != nil || version != "" {
+		t.Errorf("apt Installed(nginx) = %q, %v", version, err)
+	}
+	if version, err := apt.Available(ctx, "nginx"); err != nil || version != "1.18.0-6ubuntu14.4" {
+		t.Errorf("apt Available(nginx) = %q, %v", version, err)
+	}
+
+	dnf, _ := newManager(t, "dnf",
+		executor.Script{Match: []string{"dnf", "list", "available"}, Stdout: []string{"Available Packages", "nginx.x86_64    1:1.20.1-14.el9    appstream"}},
+	)
+	if version, err := dnf.Available(ctx, "nginx"); err != nil || version != "1:1.20.1-14.el9" {
+		t.Errorf("dnf Available(nginx) = %q, %v", version, err)
+	}
+
+	apk, _ := newManager(t, "apk",
+		executor.Script{Match: []string{"apk", "list", "--installed"}, Stdout: []string{"curl-dev-8.5.0-r0 x86_64 {curl} (curl) [installed]", "curl-8.5.0-r0 x86_64 {curl} (curl) [installed]"}},
+	)
+	if version, err := apk.Installed(ctx, "curl"); err != nil || version != "8.5.0-r0" {
+		t.Errorf("apk Installed(curl) = %q, %v", version, err)
+	}
+}
+
+func TestInstallEmitsEvents(t *testing.T) {
+	m, fake := newManager(t, "apt-get", executor.Script{
+		Match: []string{"apt-get", "install"},
+		Stdout: []string{
+			"Reading package lists...",
+			"Get:1 http://archive.ubuntu.com/ubuntu jammy-updates/main amd64 curl amd64 7.81.0-1ubuntu1.15 [194 kB]",
+			"Unpacking curl (7.81.0-1ubuntu1.15) ...",
+			"Setting up curl:amd64 (7.81.0-1ubuntu1.15) ...",
+		},
+	})
+
+	var events []Event
+	if err := m.Install(context.Background(), []Package{{Name: "curl"}}, func(e Event) { events = append(events, e) }); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	var kinds []EventKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+		if e.Kind != EventInfo && (e.Package != "curl" || e.Version != "7.81.0-1ubuntu1.15") {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	}
+	expected := []EventKind{EventInfo, EventDownload, EventInstall, EventConfigure}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Got kinds %v, expected %v", kinds, expected)
+	}
+	if env := fake.Calls()[0].Env; len(env) == 0 || env[len(env)-1] != "DEBIAN_FRONTEND=noninteractive" {
+		t.Errorf("apt-get should run non-interactively, env ends with %v", env[len(env)-1:])
+	}
+}
+
+func TestInstallFailureReportsError(t *testing.T) {
+	m, _ := newManager(t, "apk", executor.Script{
+		Match:    []string{"apk", "add"},
+		Stderr:   []string{"ERROR: unable to select packages:", "  nodejs-nope (no such package):"},
+		ExitCode: 1,
+	})
+	err := m.Install(context.Background(), []Package{{Name: "nodejs-nope"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "unable to select packages") {
+		t.Errorf("Expected the error line in the failure, got %v", err)
+	}
+}
+
+func TestParsers(t *testing.T) {
+	cases := []struct {
+		parse    func(string) Event
+		line     string
+		expected Event
+	}{
+		{parseApt, "E: Unable to locate package nope", Event{Kind: EventError}},
+		{parseApt, "Removing curl (7.81.0-1) ...", Event{Kind: EventRemove, Package: "curl", Version: "7.81.0-1"}},
+		{parseApt, "Hit:1 http://archive.ubuntu.com/ubuntu jammy InRelease", Event{Kind: EventRefresh}},
+		{parseYum, "  Installing       : curl-7.76.1-26.el9.x86_64        1/2 ", Event{Kind: EventInstall, Package: "curl", Version: "7.76.1-26.el9", Current: 1, Total: 2}},
+		{parseYum, "(2/2): libcurl-minimal-7.76.1-26.el9.x86_64.rpm   1.2 MB/s | 284 kB  00:00", Event{Kind: EventDownload, Package: "libcurl-minimal", Version: "7.76.1-26.el9", Current: 2, Total: 2}},
+		{parseYum, "Error: Unable to find a match: nope", Event{Kind: EventError}},
+		{parseZypper, "(1/1) Installing: curl-8.0.1-1.1.x86_64 ....[done]", Event{Kind: EventInstall, Package: "curl", Version: "8.0.1-1.1", Current: 1, Total: 1}},
+		{parseZypper, "Retrieving package curl-8.0.1-1.1.x86_64 (1/2), 300.5 KiB", Event{Kind: EventDownload, Package: "curl", Version: "8.0.1-1.1", Current: 1, Total: 2}},
+		{parseApk, "(2/3) Upgrading curl (8.5.0-r0 -> 8.9.0-r0)", Event{Kind: EventInstall, Package: "curl", Version: "8.9.0-r0", Current: 2, Total: 3}},
+		{parseApk, "(1/1) Purging curl (8.9.0-r0)", Event{Kind: EventRemove, Package: "curl", Version: "8.9.0-r0", Current: 1, Total: 1}},
+		{parsePacman, "( 3/12) installing curl                [######] 100%", Event{Kind: EventInstall, Package: "curl", Current: 3, Total: 12}},
+		{parsePacman, "error: target not found: nope", Event{Kind: EventError}},
+	}
+	for _, c := range cases {
+		if got := c.parse(c.line); got != c.expected {
+			t.Errorf("%q: got %+v, expected %+v", c.line, got, c.expected)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	lookPath := func(file string) (string, error) {
+		if file == "yum" || file == "zypper" {
+			return "/usr/bin/" + file, nil
+		}
+		return "", exec.ErrNotFound
+	}
+	m, err := Detect(executor.NewFake(), lookPath)
+	if err != nil || m.Name() != "yum" {
+		t.Errorf("Expected yum to be picked first, got %v (%v)", m, err)
+	}
+
+	_, err = Detect(executor.NewFake(), func(string) (string, error) { return "", exec.ErrNotFound })
+	if !errors.Is(err, ErrNoManager) {
+		t.Errorf("Expected ErrNoManager, got %v", err)
+	}
+}
+
+func TestPackageManagersClassifyTheirOutput(t *testing.T) {
+	for _, c := range []struct {
+		tool, line string
+		want       output.Level
+	}{
+		{"apt-get", "E: Unable to locate package nope", output.LevelError},
+		{"apt-get", "Setting up nginx (1.24.0-2) ...", output.LevelProgress},
+		{"apt-get", "Hit:1 http://deb.debian.org/debian bookworm InRelease", output.LevelInfo},
+		{"/usr/bin/dnf", "Warning: failed loading '/etc/yum.repos.d/x.repo', skipping.", output.LevelWarn},
+		{"dnf", "Complete!", output.LevelProgress},
+		{"pacman", "resolving dependencies...", output.LevelInfo},
+	} {
+		if got := output.Classify(c.tool, "stdout", c.line); got != c.want {
+			t.Errorf("%s %q classified as %s, want %s", c.tool, c.line, got, c.want)
+		}
+	}
+}
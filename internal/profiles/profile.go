@@ -0,0 +1,254 @@
+// Package profiles implements declarative server profiles: an ordered list of
+// package, file, user, service and command steps that is validated, planned
+// and applied against the host.
+package profiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/pkg"
+)
+
+// StepType selects what a step manages
+type StepType string
+
+const (
+	StepPackage StepType = "package"
+	StepFile    StepType = "file"
+	StepUser    StepType = "user"
+	StepService StepType = "service"
+	StepCommand StepType = "command"
+)
+
+// Desired states understood by the different step types
+const (
+	StatePresent = "present"
+	StateAbsent  = "absent"
+	StateRunning = "running"
+	StateStopped = "stopped"
+)
+
+// Profile is a named list of steps applied in order
+type Profile struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Steps       []Step `json:"steps" yaml:"steps"`
+}
+
+// Step is a single unit of work. Which fields apply depends on Type.
+type Step struct {
+	Name  string   `json:"name" yaml:"name"`
+	Type  StepType `json:"type" yaml:"type"`
+	State string   `json:"state,omitempty" yaml:"state,omitempty"`
+	// When restricts the step to hosts whose facts match, e.g. {"os.family": "debian", "arch": "arm64"}
+	When map[string]string `json:"when,omitempty" yaml:"when,omitempty"`
+
+	// package, entries are "name" or "name=version"
+	Packages []string `json:"packages,omitempty" yaml:"packages,omitempty"`
+	Update   bool     `json:"update,omitempty" yaml:"update,omitempty"` // refresh the package index before installing
+
+	// file
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`
+	Content string `json:"content,omitempty" yaml:"content,omitempty"`
+	Mode    string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Owner   string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Group   string `json:"group,omitempty" yaml:"group,omitempty"`
+
+	// user
+	User   string   `json:"user,omitempty" yaml:"user,omitempty"`
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Shell  string   `json:"shell,omitempty" yaml:"shell,omitempty"`
+	Home   string   `json:"home,omitempty" yaml:"home,omitempty"`
+	System bool     `json:"system,omitempty" yaml:"system,omitempty"`
+
+	// service
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	Enabled *bool  `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+
+	// command
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+	Creates string   `json:"creates,omitempty" yaml:"creates,omitempty"`
+}
+
+// desiredState returns the step state, falling back to the type's default
+func (s Step) desiredState() string {
+	if s.State != "" {
+		return s.State
+	}
+	if s.Type == StepService {
+		return StateRunning
+	}
+	return StatePresent
+}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Parse decodes a profile from JSON or YAML. JSON is detected by a leading '{'.
+func Parse(data []byte) (*Profile, error) {
+	profile := &Profile{}
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(profile); err != nil {
+			return nil, fmt.Errorf("invalid JSON profile: %v", err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(trimmed))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(profile); err != nil {
+			return nil, fmt.Errorf("invalid YAML profile: %v", err)
+		}
+	}
+	return profile, nil
+}
+
+// LoadFile reads and validates a profile file
+func LoadFile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Validate checks the whole profile and returns every problem found
+func (p *Profile) Validate() error {
+	var errs []error
+	if !namePattern.MatchString(p.Name) {
+		errs = append(errs, fmt.Errorf("profile name %q must be alphanumeric (dots, dashes and underscores allowed)", p.Name))
+	}
+	if len(p.Steps) == 0 {
+		errs = append(errs, errors.New("profile has no steps"))
+	}
+
+	seen := map[string]bool{}
+	for i, step := range p.Steps {
+		label := fmt.Sprintf("step %d", i+1)
+		if step.Name != "" {
+			label = fmt.Sprintf("step %d (%s)", i+1, step.Name)
+			if seen[step.Name] {
+				errs = append(errs, fmt.Errorf("%s: duplicate step name", label))
+			}
+			seen[step.Name] = true
+		} else {
+			errs = append(errs, fmt.Errorf("%s: name is required", label))
+		}
+		for _, err := range step.validate() {
+			errs = append(errs, fmt.Errorf("%s: %v", label, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s Step) validate() []error {
+	var errs []error
+	state := s.desiredState()
+	allowStates := func(states ...string) {
+		for _, allowed := range states {
+			if state == allowed {
+				return
+			}
+		}
+		errs = append(errs, fmt.Errorf("state %q is not one of %s", state, strings.Join(states, ", ")))
+	}
+
+	for key := range s.When {
+		if !facts.ValidSelector(key) {
+			errs = append(errs, fmt.Errorf("unknown fact %q in when (known: %s)", key, strings.Join(facts.SelectorKeys(), ", ")))
+		}
+	}
+
+	switch s.Type {
+	case StepPackage:
+		allowStates(StatePresent, StateAbsent)
+		if len(s.Packages) == 0 {
+			errs = append(errs, errors.New("packages is required"))
+		}
+		for _, spec := range s.Packages {
+			p := pkg.ParsePackage(spec)
+			if p.Name == "" || strings.HasPrefix(p.Name, "-") || strings.ContainsAny(spec, " \t") {
+				errs = append(errs, fmt.Errorf("invalid package %q", spec))
+			}
+			if strings.Contains(spec, "=") && p.Version == "" {
+				errs = append(errs, fmt.Errorf("package %q has an empty version pin", spec))
+			}
+		}
+	case StepFile:
+		allowStates(StatePresent, StateAbsent)
+		if !filepath.IsAbs(s.Path) {
+			errs = append(errs, fmt.Errorf("path %q must be absolute", s.Path))
+		} else if hasParentRef(s.Path) {
+			errs = append(errs, fmt.Errorf("path %q must not contain ..", s.Path))
+		}
+		if s.Mode != "" {
+			if _, err := strconv.ParseUint(s.Mode, 8, 32); err != nil {
+				errs = append(errs, fmt.Errorf("mode %q is not an octal file mode", s.Mode))
+			}
+		}
+	case StepUser:
+		allowStates(StatePresent, StateAbsent)
+		if !namePattern.MatchString(s.User) {
+			errs = append(errs, fmt.Errorf("invalid user name %q", s.User))
+		}
+	case StepService:
+		allowStates(StateRunning, StateStopped)
+		if !namePattern.MatchString(s.Service) {
+			errs = append(errs, fmt.Errorf("invalid service name %q", s.Service))
+		}
+	case StepCommand:
+		if s.State != "" {
+			errs = append(errs, errors.New("command steps do not take a state"))
+		}
+		if len(s.Command) == 0 {
+			errs = append(errs, errors.New("command is required"))
+		}
+		if s.Creates != "" && !filepath.IsAbs(s.Creates) {
+			errs = append(errs, fmt.Errorf("creates %q must be absolute", s.Creates))
+		} else if hasParentRef(s.Creates) {
+			errs = append(errs, fmt.Errorf("creates %q must not contain ..", s.Creates))
+		}
+	case "":
+		errs = append(errs, errors.New("type is required"))
+	default:
+		errs = append(errs, fmt.Errorf("unknown step type %q", s.Type))
+	}
+	return errs
+}
+
+// fileMode returns the configured mode or the default for new files
+func (s Step) fileMode() os.FileMode {
+	if s.Mode == "" {
+		return 0644
+	}
+	mode, _ := strconv.ParseUint(s.Mode, 8, 32)
+	return os.FileMode(mode)
+}
+
+// hasParentRef reports whether p has a .. element
+func hasParentRef(p string) bool {
+	for _, element := range strings.Split(filepath.ToSlash(p), "/") {
+		if element == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,375 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/pkg"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const sampleYAML = `
+name: sample
+steps:
+  - name: tools
+    type: package
+    packages: [curl, git]
+  - name: motd
+    type: file
+    path: /etc/motd
+    content: "hello\n"
+    mode: "0600"
+  - name: marker
+    type: command
+    command: [touch, /tmp/marker]
+    creates: /etc/motd
+`
+
+// newTestHost returns a host rooted in a temp dir that pretends apt-get is installed
+func newTestHost(t *testing.T, fake *executor.Fake) *Host {
+	t.Helper()
+	return &Host{
+		Executor: fake,
+		Root:     t.TempDir(),
+		LookPath: func(file string) (string, error) {
+			if file == "apt-get" {
+				return "/usr/bin/apt-get", nil
+			}
+			return "", errors.New("not found")
+		},
+	}
+}
+
+func TestParseYAMLAndJSON(t *testing.T) {
+	fromYAML, err := Parse([]byte(sampleYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	if err := fromYAML.Validate(); err != nil {
+		t.Fatalf("Sample profile should be valid: %v", err)
+	}
+
+	fromJSON, err := Parse([]byte(`{"name": "sample", "steps": [{"name": "x", "type": "command", "command": ["true"]}]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if fromJSON.Name != "sample" || len(fromJSON.Steps) != 1 {
+		t.Errorf("Unexpected profile: %+v", fromJSON)
+	}
+
+	if _, err := Parse([]byte("name: x\nstepz: []\n")); err == nil {
+		t.Error("Expected unknown fields to be rejected")
+	}
+}
+
+func TestValidateCollectsAllErrors(t *testing.T) {
+	profile := &Profile{
+		Name: "bad name",
+		Steps: []Step{
+			{Name: "a", Type: StepPackage},
+			{Name: "a", Type: StepFile, Path: "relative", Mode: "999"},
+			{Name: "c", Type: StepService, Service: "nginx", State: StatePresent},
+			{Name: "d", Type: "reboot"},
+			{Name: "e", Type: StepFile, Path: "/../../etc/passwd"},
+		},
+	}
+	err := profile.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, expected := range []string{"profile name", "packages is required", "duplicate step name", "must be absolute", "octal", `state "present"`, "unknown step type", "must not contain .."} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Validation errors are missing %q:\n%v", expected, err)
+		}
+	}
+}
+
+func TestApplyConvergesHost(t *testing.T) {
+	profile, _ := Parse([]byte(sampleYAML))
+	fake := executor.NewFake(
+		executor.Script{Match: []string{"dpkg-query", "-W", "-f=${Status} ${Version}", "curl"}, Stdout: []string{"install ok installed 7.88.1-10"}},
+		executor.Script{Match: []string{"dpkg-query"}, ExitCode: 1},
+		executor.Script{Match: []string{"apt-get", "install"}, Stdout: []string{"Setting up git"}},
+	)
+	host := newTestHost(t, fake)
+
+	run, err := NewRunner(host).Apply(context.Background(), profile, nil)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if run.Status != RunSucceeded {
+		t.Fatalf("Expected run to succeed: %+v", run)
+	}
+
+	expected := []StepStatus{StepChanged, StepChanged, StepOK}
+	for i, step := range run.Steps {
+		if step.Status != expected[i] {
+			t.Errorf("Step %s: expected %s, got %s (%s)", step.Name, expected[i], step.Status, step.Error)
+		}
+	}
+
+	// Only the missing package is installed
+	commands := strings.Join(fake.Commands(), "\n")
+	if !strings.Contains(commands, "apt-get install -y git") || strings.Contains(commands, "install -y curl") {
+		t.Errorf("Unexpected commands:\n%s", commands)
+	}
+
+	info, err := os.Stat(filepath.Join(host.Root, "etc/motd"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected /etc/motd with mode 0600, got %v (%v)", info, err)
+	}
+}
+
+func TestPinnedPackageIsReinstalled(t *testing.T) {
+	profile := &Profile{Name: "pinned", Steps: []Step{
+		{Name: "nginx", Type: StepPackage, Packages: []string{"nginx=1.24.0-1"}, Update: true},
+	}}
+	fake := executor.NewFake(
+		executor.Script{Match: []string{"dpkg-query"}, Stdout: []string{"install ok installed 1.18.0-6"}},
+		executor.Script{Match: []string{"apt-get", "update"}, Stdout: []string{"Hit:1 http://deb.debian.org/debian bookworm InRelease"}},
+		executor.Script{Match: []string{"apt-get", "install"}, Stdout: []string{"Unpacking nginx (1.24.0-1) over (1.18.0-6) ..."}},
+	)
+
+	run, _ := NewRunner(newTestHost(t, fake)).Apply(context.Background(), profile, nil)
+	step := run.Steps[0]
+	if step.Status != StepChanged {
+		t.Fatalf("Expected the pinned package to be installed: %+v", step)
+	}
+	if len(step.Commands) != 2 || step.Commands[0] != "apt-get update" || step.Commands[1] != "apt-get install -y nginx=1.24.0-1" {
+		t.Errorf("Unexpected commands: %v", step.Commands)
+	}
+	last := step.Progress[len(step.Progress)-1]
+	if last.Kind != pkg.EventInstall || last.Package != "nginx" || last.Version != "1.24.0-1" {
+		t.Errorf("Unexpected progress: %+v", step.Progress)
+	}
+}
+
+func TestStepsSelectedByFacts(t *testing.T) {
+	profile := &Profile{Name: "arch-specific", Steps: []Step{
+		{Name: "arm marker", Type: StepCommand, Command: []string{"touch", "/tmp/arm"}, When: map[string]string{"arch": "arm64"}},
+		{Name: "rhel marker", Type: StepCommand, Command: []string{"touch", "/tmp/rhel"}, When: map[string]string{"os.family": "rhel,fedora"}},
+	}}
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("Profile should be valid: %v", err)
+	}
+
+	fake := executor.NewFake(executor.Script{Match: []string{"touch"}})
+	host := newTestHost(t, fake)
+	factsRoot := t.TempDir()
+	writeFile(t, filepath.Join(factsRoot, "etc/os-release"), "ID=ubuntu\nID_LIKE=debian\n")
+	writeFile(t, filepath.Join(factsRoot, "proc/sys/kernel/arch"), "aarch64\n")
+	host.Facts = facts.NewCollector(factsRoot)
+	runner := NewRunner(host)
+
+	plan := runner.Plan(context.Background(), profile)
+	if plan.Changes != 1 || plan.Steps[0].Skipped != "" || !strings.Contains(plan.Steps[1].Skipped, "os.family") {
+		t.Errorf("Unexpected plan: %+v", plan)
+	}
+
+	run, _ := runner.Apply(context.Background(), profile, nil)
+	if run.Status != RunSucceeded || run.Steps[0].Status != StepChanged || run.Steps[1].Status != StepSkipped {
+		t.Errorf("Unexpected run: %+v", run.Steps)
+	}
+	if commands := fake.Commands(); len(commands) != 1 || commands[0] != "touch /tmp/arm" {
+		t.Errorf("Unexpected commands: %v", commands)
+	}
+
+	profile.Steps[0].When = map[string]string{"distro": "ubuntu"}
+	if err := profile.Validate(); err == nil || !strings.Contains(err.Error(), `unknown fact "distro"`) {
+		t.Errorf("Expected an unknown fact to be rejected, got %v", err)
+	}
+}
+
+func TestApplyStopsAfterFailure(t *testing.T) {
+	profile := &Profile{Name: "failing", Steps: []Step{
+		{Name: "broken", Type: StepCommand, Command: []string{"false"}},
+		{Name: "never", Type: StepCommand, Command: []string{"true"}},
+	}}
+	fake := executor.NewFake(executor.Script{Match: []string{"false"}, ExitCode: 1})
+
+	run, _ := NewRunner(newTestHost(t, fake)).Apply(context.Background(), profile, nil)
+	if run.Status != RunFailed || run.Steps[0].Status != StepFailed || run.Steps[1].Status != StepSkipped {
+		t.Errorf("Expected failure followed by skip: %+v", run.Steps)
+	}
+	if len(fake.Calls()) != 1 {
+		t.Errorf("Skipped steps must not run anything: %v", fake.Commands())
+	}
+}
+
+func TestStepsAreTracedUnderTheRun(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	profile := &Profile{Name: "failing", Steps: []Step{
+		{Name: "broken", Type: StepCommand, Command: []string{"false"}},
+		{Name: "never", Type: StepCommand, Command: []string{"true"}},
+	}}
+	fake := executor.NewFake(executor.Script{Match: []string{"false"}, ExitCode: 1})
+	host := newTestHost(t, fake)
+	host.Executor = executor.Traced(fake)
+	NewRunner(host).Apply(context.Background(), profile, nil)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	run, step, wait := spans["profile.run"], spans["profile.step"], spans["process.wait"]
+	if run == nil || step == nil || wait == nil || len(recorder.Ended()) != 4 {
+		t.Fatalf("Expected the run, the failed step and its process, got %v", recorder.Ended())
+	}
+	if step.Parent().SpanID() != run.SpanContext().SpanID() || wait.Parent().SpanID() != step.SpanContext().SpanID() {
+		t.Error("Expected the process under the step and the step under the run")
+	}
+	if step.Status().Code != codes.Error || run.Status().Code != codes.Error {
+		t.Errorf("Expected the step and the run to be marked failed, got %v and %v", step.Status(), run.Status())
+	}
+}
+
+func TestShutdownCancelsRunAtDeadline(t *testing.T) {
+	profile := &Profile{Name: "slow", Steps: []Step{
+		{Name: "sleep", Type: StepCommand, Command: []string{"sleep", "60"}},
+	}}
+	fake := executor.NewFake(executor.Script{Match: []string{"sleep"}, Stdout: []string{"done"}, Delay: time.Hour})
+	runner := NewRunner(newTestHost(t, fake))
+	run, err := runner.Start(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := runner.Shutdown(ctx, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the run to be cut off at the deadline, got %v", err)
+	}
+	if finished, _ := runner.Get(run.ID); finished.Status != RunFailed {
+		t.Errorf("Expected the canceled run to fail, got %s", finished.Status)
+	}
+	if _, err := runner.Start(profile); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected no new runs after shutdown, got %v", err)
+	}
+}
+
+func TestPathsStayBelowTheHostRoot(t *testing.T) {
+	host := newTestHost(t, executor.NewFake())
+	outside := filepath.Join(filepath.Dir(host.Root), "escaped")
+	// Built by hand, as Validate refuses paths with .. before they get here
+	profile := &Profile{Name: "escape", Steps: []Step{
+		{Name: "write", Type: StepFile, Path: "/../" + filepath.Base(outside), Content: "x"},
+		{Name: "run", Type: StepCommand, Command: []string{"true"}, Creates: "/../../etc/passwd"},
+	}}
+
+	plan := NewRunner(host).Plan(context.Background(), profile)
+	if plan.Errors != 2 {
+		t.Fatalf("Expected both steps to fail, got %+v", plan)
+	}
+	for _, step := range plan.Steps {
+		if !strings.Contains(step.Error, "escapes the host root") {
+			t.Errorf("Unexpected error for step %s: %q", step.Name, step.Error)
+		}
+	}
+	if err := (fileAction{profile.Steps[0]}).apply(context.Background(), host, stepState{}); err == nil {
+		t.Error("Expected writing outside the host root to fail")
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("A file was written outside the host root: %v", err)
+	}
+}
+
+func TestPlanDoesNotChangeHost(t *testing.T) {
+	profile, _ := Parse([]byte(sampleYAML))
+	fake := executor.NewFake(executor.Script{Match: []string{"dpkg-query"}, ExitCode: 1})
+	host := newTestHost(t, fake)
+
+	plan := NewRunner(host).Plan(context.Background(), profile)
+	if len(plan.Steps) != 3 || plan.Changes != 3 || plan.Errors != 0 {
+		t.Fatalf("Unexpected plan: %+v", plan)
+	}
+	tools := plan.Steps[0]
+	if tools.Current != "curl absent, git absent" || tools.Desired != "curl, git present" {
+		t.Errorf("Unexpected package states: %q -> %q", tools.Current, tools.Desired)
+	}
+	if len(tools.Commands) != 1 || tools.Commands[0] != "apt-get install -y curl git" {
+		t.Errorf("Unexpected package commands: %v", tools.Commands)
+	}
+	if marker := plan.Steps[2]; marker.Current != "/etc/motd missing" || marker.Commands[0] != "touch /tmp/marker" {
+		t.Errorf("Unexpected command step plan: %+v", marker)
+	}
+	for _, command := range fake.Commands() {
+		if !strings.HasPrefix(command, "dpkg-query") {
+			t.Errorf("Plan ran a mutating command: %s", command)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(host.Root, "etc/motd")); !os.IsNotExist(err) {
+		t.Error("Plan must not write files")
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	profile, _ := Parse([]byte(sampleYAML))
+	if err := store.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := store.Get("sample")
+	if err != nil || len(loaded.Steps) != 3 {
+		t.Fatalf("Get returned %+v (%v)", loaded, err)
+	}
+	if _, err := store.Get("../etc/passwd"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("Expected path-like names to be rejected, got %v", err)
+	}
+	listed, _ := store.List()
+	if len(listed) != 1 {
+		t.Errorf("Expected one stored profile, got %d", len(listed))
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFinishedRunsBeyondTheHistoryAreDropped(t *testing.T) {
+	runner := NewRunner(newTestHost(t, executor.NewFake()))
+	runner.History = 2
+	profile := &Profile{Name: "noop", Steps: []Step{{Name: "run", Type: StepCommand, Command: []string{"true"}}}}
+
+	var runs []Run
+	for range 4 {
+		run, err := runner.Apply(context.Background(), profile, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+
+	// Starting the fourth run dropped the first, the fourth finished afterwards
+	if _, err := runner.Get(runs[0].ID); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("Expected the oldest finished run to be dropped, got %v", err)
+	}
+	listed := runner.List()
+	if len(listed) != 3 || listed[0].ID != runs[1].ID || listed[2].ID != runs[3].ID {
+		t.Errorf("Expected the last 3 runs, got %+v", listed)
+	}
+}
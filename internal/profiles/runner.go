@@ -0,0 +1,509 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/output"
+	"spi-go-core/internal/pkg"
+	"spi-go-core/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// StepStatus is the outcome of a single step
+type StepStatus string
+
+const (
+	StepPending StepStatus = "pending"
+	StepRunning StepStatus = "running"
+	StepOK      StepStatus = "ok" // already in the desired state
+	StepChanged StepStatus = "changed"
+	StepFailed  StepStatus = "failed"
+	StepSkipped StepStatus = "skipped"
+)
+
+// RunStatus is the overall state of a profile run
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+)
+
+// ErrBusy is returned when a profile is applied while another run is in progress
+var ErrBusy = errors.New("another profile run is in progress")
+
+// ErrShuttingDown is returned when a profile is applied after Shutdown
+var ErrShuttingDown = errors.New("shutting down, not starting profile runs")
+
+// DefaultHistory is how many finished runs a Runner keeps unless History is set
+const DefaultHistory = 50
+
+// ErrRunNotFound is returned for unknown run IDs
+var ErrRunNotFound = errors.New("run not found")
+
+// setupLog is the log of the setup component
+var setupLog = logging.For(logging.Setup)
+
+// StepResult reports what happened to one step
+type StepResult struct {
+	Name     string     `json:"name"`
+	Type     StepType   `json:"type"`
+	Status   StepStatus `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Skipped  string     `json:"skipped,omitempty"` // why a skipped step did not run
+	Commands []string   `json:"commands,omitempty"`
+	Output   []string   `json:"output,omitempty"`
+	// Progress holds the parsed package manager events of package steps
+	Progress []pkg.Event `json:"progress,omitempty"`
+	Duration string      `json:"duration,omitempty"`
+}
+
+// Run is a snapshot of a profile application
+type Run struct {
+	ID         string       `json:"id"`
+	Profile    string       `json:"profile"`
+	Status     RunStatus    `json:"status"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+	Steps      []StepResult `json:"steps"`
+}
+
+// PlanStep tells how applying a step would change the host
+type PlanStep struct {
+	Name     string   `json:"name"`
+	Type     StepType `json:"type"`
+	Current  string   `json:"current"`
+	Desired  string   `json:"desired"`
+	Commands []string `json:"commands"`
+	Changes  bool     `json:"changes"`
+	Error    string   `json:"error,omitempty"`
+	Skipped  string   `json:"skipped,omitempty"` // why the step does not apply to this host
+}
+
+// Plan is the dry-run result for a whole profile
+type Plan struct {
+	Profile string     `json:"profile"`
+	Steps   []PlanStep `json:"steps"`
+	Changes int        `json:"changes"` // number of steps that would change the host
+	Errors  int        `json:"errors"`  // number of steps whose state could not be determined
+}
+
+// Runner applies profiles to a host, one run at a time
+type Runner struct {
+	Host *Host
+	// Events receives a task event per run, a step event whenever a step changes
+	// and an info event per line of step output
+	Events *events.Bus
+	// LogOutput also logs step output, as far as the verbosity shows it
+	LogOutput bool
+	// History is how many finished runs List and Get still know about. The
+	// oldest ones beyond it are dropped as new runs start, 0 means DefaultHistory.
+	History int
+
+	applying sync.Mutex
+	mu       sync.RWMutex
+	runs     map[string]*Run
+	closing  bool
+	// background runs use ctx and are canceled by Shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRunner creates a runner for host
+func NewRunner(host *Host) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{Host: host, runs: make(map[string]*Run), ctx: ctx, cancel: cancel}
+}
+
+// Plan inspects every step and reports the current state, the desired state
+// and the commands apply would run. Only read-only queries are executed.
+func (r *Runner) Plan(ctx context.Context, profile *Profile) Plan {
+	plan := Plan{Profile: profile.Name, Steps: make([]PlanStep, 0, len(profile.Steps))}
+	selector := r.selector()
+	for _, step := range profile.Steps {
+		if applies, reason, err := selector(step); err != nil || !applies {
+			planStep := PlanStep{Name: step.Name, Type: step.Type, Skipped: reason}
+			if err != nil {
+				planStep.Error = err.Error()
+				plan.Errors++
+			}
+			plan.Steps = append(plan.Steps, planStep)
+			continue
+		}
+
+		state, err := newAction(step).inspect(ctx, r.Host)
+		planStep := PlanStep{
+			Name:     step.Name,
+			Type:     step.Type,
+			Current:  state.current,
+			Desired:  state.desired,
+			Commands: state.describe(),
+			Changes:  !state.inSync(),
+		}
+		if err != nil {
+			planStep.Error = err.Error()
+			plan.Errors++
+		} else if planStep.Changes {
+			plan.Changes++
+		}
+		plan.Steps = append(plan.Steps, planStep)
+	}
+	return plan
+}
+
+// Apply runs profile synchronously. progress, if not nil, is called with a
+// snapshot every time a step changes status.
+func (r *Runner) Apply(ctx context.Context, profile *Profile, progress func(Run)) (Run, error) {
+	if !r.applying.TryLock() {
+		return Run{}, ErrBusy
+	}
+	defer r.applying.Unlock()
+
+	run := r.newRun(profile)
+	r.execute(ctx, profile, run, progress, nil)
+	return r.snapshot(run), nil
+}
+
+// Approver decides whether step may run commands to change the host. It
+// returns nil to let the step go ahead; an error fails the step.
+type Approver func(ctx context.Context, step Step, commands []string) error
+
+// Start applies profile in the background and returns the initial snapshot
+func (r *Runner) Start(profile *Profile) (Run, error) {
+	return r.StartApproved(context.Background(), profile, nil)
+}
+
+// StartApproved is Start with every step that would change the host held
+// until approve lets it go ahead. Steps already in the desired state are not
+// asked about. The run is traced as a child of the span in parent.
+func (r *Runner) StartApproved(parent context.Context, profile *Profile, approve Approver) (Run, error) {
+	r.mu.RLock()
+	closing := r.closing
+	r.mu.RUnlock()
+	if closing {
+		return Run{}, ErrShuttingDown
+	}
+	if !r.applying.TryLock() {
+		return Run{}, ErrBusy
+	}
+
+	run := r.newRun(profile)
+	go func() {
+		defer r.applying.Unlock()
+		r.execute(tracing.WithParent(r.ctx, parent), profile, run, nil, approve)
+	}()
+	return r.snapshot(run), nil
+}
+
+// Shutdown stops accepting runs and waits for the current one. With drain
+// unset it is canceled right away, otherwise only once ctx is done, in which
+// case ctx.Err() is returned.
+func (r *Runner) Shutdown(ctx context.Context, drain bool) error {
+	r.mu.Lock()
+	r.closing = true
+	r.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		// Holding the lock means no run is in progress and none can start
+		r.applying.Lock()
+		close(finished)
+	}()
+	if !drain {
+		r.cancel()
+		<-finished
+		return nil
+	}
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// Get returns a snapshot of a run
+func (r *Runner) Get(id string) (Run, error) {
+	r.mu.RLock()
+	run, exists := r.runs[id]
+	r.mu.RUnlock()
+	if !exists {
+		return Run{}, ErrRunNotFound
+	}
+	return r.snapshot(run), nil
+}
+
+// List returns snapshots of all runs, oldest first
+func (r *Runner) List() []Run {
+	r.mu.RLock()
+	runs := make([]Run, 0, len(r.runs))
+	for _, run := range r.runs {
+		runs = append(runs, r.snapshotLocked(run))
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(runs, func(i, k int) bool {
+		return runs[i].StartedAt.Before(runs[k].StartedAt)
+	})
+	return runs
+}
+
+func (r *Runner) newRun(profile *Profile) *Run {
+	run := &Run{
+		ID:        encryption.GenerateReqId(),
+		Profile:   profile.Name,
+		Status:    RunRunning,
+		StartedAt: time.Now(),
+		Steps:     make([]StepResult, len(profile.Steps)),
+	}
+	for i, step := range profile.Steps {
+		run.Steps[i] = StepResult{Name: step.Name, Type: step.Type, Status: StepPending}
+	}
+
+	r.mu.Lock()
+	r.runs[run.ID] = run
+	r.pruneLocked()
+	r.mu.Unlock()
+	return run
+}
+
+// pruneLocked drops the oldest finished runs beyond the history
+func (r *Runner) pruneLocked() {
+	limit := r.History
+	if limit <= 0 {
+		limit = DefaultHistory
+	}
+	var finished []*Run
+	for _, run := range r.runs {
+		if run.FinishedAt != nil {
+			finished = append(finished, run)
+		}
+	}
+	if len(finished) <= limit {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].FinishedAt.Before(*finished[k].FinishedAt)
+	})
+	for _, run := range finished[:len(finished)-limit] {
+		delete(r.runs, run.ID)
+	}
+}
+
+// execute applies the steps in order, skipping everything after the first
+// failure. The run and every step that runs are traced.
+func (r *Runner) execute(ctx context.Context, profile *Profile, run *Run, progress func(Run), approve Approver) {
+	ctx, runSpan := tracing.Start(ctx, "profile.run", attribute.String("spi.profile", profile.Name), attribute.String("spi.run.id", run.ID))
+	// update changes step i (or the run itself when i is -1) and reports it
+	update := func(i int, fn func()) {
+		r.mu.Lock()
+		fn()
+		r.mu.Unlock()
+		snapshot := r.snapshot(run)
+		if progress != nil {
+			progress(snapshot)
+		}
+		r.publish(snapshot, i)
+	}
+	// Announce every step up front so subscribers know how many there are
+	snapshot := r.snapshot(run)
+	r.publish(snapshot, -1)
+	for i := range snapshot.Steps {
+		r.publish(snapshot, i)
+	}
+
+	failed := false
+	selector := r.selector()
+	for i, step := range profile.Steps {
+		if failed {
+			update(i, func() {
+				run.Steps[i].Status = StepSkipped
+				run.Steps[i].Skipped = "an earlier step failed"
+			})
+			continue
+		}
+		stepCtx, stepSpan := tracing.Start(ctx, "profile.step", attribute.String("spi.step.name", step.Name), attribute.String("spi.step.type", string(step.Type)))
+		applies, reason, err := selector(step)
+		if err != nil {
+			tracing.End(stepSpan, err)
+			update(i, func() {
+				run.Steps[i].Status = StepFailed
+				run.Steps[i].Error = err.Error()
+			})
+			failed = true
+			continue
+		}
+		if !applies {
+			stepSpan.SetAttributes(attribute.String("spi.step.status", string(StepSkipped)))
+			stepSpan.End()
+			update(i, func() {
+				run.Steps[i].Status = StepSkipped
+				run.Steps[i].Skipped = reason
+			})
+			continue
+		}
+		update(i, func() { run.Steps[i].Status = StepRunning })
+
+		started := time.Now()
+		host := *r.Host
+		// Every line is kept with the step and goes to the UI, the log shows what the verbosity lets through
+		logLine := func(output.Line) {}
+		if r.LogOutput {
+			logLine = output.Shown(output.Log(setupLog.With("run", run.ID, "profile", run.Profile, "step", step.Name)))
+		}
+		host.lines = func(line output.Line) {
+			r.mu.Lock()
+			run.Steps[i].Output = append(run.Steps[i].Output, line.Text)
+			r.mu.Unlock()
+			r.Events.Publish(events.Event{Source: events.SourceProfile, Task: run.ID, Step: step.Name, Status: events.StatusInfo, Stream: line.Stream, Message: line.Text, Level: line.Level})
+			logLine(line)
+		}
+		host.progress = func(event pkg.Event) {
+			r.mu.Lock()
+			run.Steps[i].Progress = append(run.Steps[i].Progress, event)
+			r.mu.Unlock()
+		}
+
+		status, commands, err := applyStep(stepCtx, &host, step, approve)
+		stepSpan.SetAttributes(attribute.String("spi.step.status", string(status)))
+		tracing.End(stepSpan, err)
+		update(i, func() {
+			run.Steps[i].Status = status
+			run.Steps[i].Commands = commands
+			run.Steps[i].Duration = time.Since(started).Round(time.Millisecond).String()
+			if err != nil {
+				run.Steps[i].Error = err.Error()
+			}
+		})
+		failed = status == StepFailed
+	}
+
+	update(-1, func() {
+		finishedAt := time.Now()
+		run.FinishedAt = &finishedAt
+		run.Status = RunSucceeded
+		if failed {
+			run.Status = RunFailed
+		}
+	})
+	if failed {
+		runSpan.SetStatus(codes.Error, "a step failed")
+	}
+	runSpan.End()
+}
+
+// publish reports the run, or its step i, on the event bus
+func (r *Runner) publish(run Run, i int) {
+	if r.Events == nil {
+		return
+	}
+	event := events.Event{Source: events.SourceProfile, Task: run.ID, Title: "profile " + run.Profile}
+	if i < 0 {
+		event.Status = events.StatusRunning
+		switch run.Status {
+		case RunSucceeded:
+			event.Status = events.StatusSucceeded
+		case RunFailed:
+			event.Status = events.StatusFailed
+		}
+		r.Events.Publish(event)
+		return
+	}
+	step := run.Steps[i]
+	event.Step = step.Name
+	event.Error = step.Error
+	event.Message = step.Skipped
+	switch step.Status {
+	case StepPending:
+		event.Status = events.StatusPending
+	case StepRunning:
+		event.Status = events.StatusRunning
+	case StepOK, StepChanged:
+		event.Status = events.StatusSucceeded
+		event.Message = string(step.Status)
+	case StepFailed:
+		event.Status = events.StatusFailed
+	case StepSkipped:
+		event.Status = events.StatusSkipped
+	}
+	r.Events.Publish(event)
+}
+
+// selector returns a function telling whether a step applies to the host.
+// Facts are only collected, once, if some step has a condition.
+func (r *Runner) selector() func(Step) (bool, string, error) {
+	var (
+		hostFacts *facts.Facts
+		err       error
+		collected bool
+	)
+	return func(step Step) (bool, string, error) {
+		if len(step.When) == 0 {
+			return true, "", nil
+		}
+		if !collected {
+			hostFacts, err = r.Host.facts()
+			collected = true
+		}
+		if err != nil {
+			return false, "", fmt.Errorf("failed to collect host facts: %v", err)
+		}
+		applies, reason := hostFacts.Match(step.When)
+		return applies, reason, nil
+	}
+}
+
+// applyStep converges a single step if it is not already in the desired state
+// and approve, when set, agrees, and returns what was done
+func applyStep(ctx context.Context, host *Host, step Step, approve Approver) (StepStatus, []string, error) {
+	act := newAction(step)
+	state, err := act.inspect(ctx, host)
+	if err != nil {
+		return StepFailed, nil, err
+	}
+	if state.inSync() {
+		return StepOK, nil, nil
+	}
+	if approve != nil {
+		if err := approve(ctx, step, state.describe()); err != nil {
+			return StepFailed, state.describe(), err
+		}
+	}
+	if err := act.apply(ctx, host, state); err != nil {
+		return StepFailed, state.describe(), err
+	}
+	return StepChanged, state.describe(), nil
+}
+
+func (r *Runner) snapshot(run *Run) Run {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.snapshotLocked(run)
+}
+
+func (r *Runner) snapshotLocked(run *Run) Run {
+	copied := *run
+	copied.Steps = make([]StepResult, len(run.Steps))
+	for i, step := range run.Steps {
+		step.Output = append([]string(nil), step.Output...)
+		step.Commands = append([]string(nil), step.Commands...)
+		step.Progress = append([]pkg.Event(nil), step.Progress...)
+		copied.Steps[i] = step
+	}
+	return copied
+}
@@ -0,0 +1,474 @@
+package profiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/output"
+	"spi-go-core/internal/pkg"
+)
+
+// Host is the machine steps are checked and applied against
+type Host struct {
+	Executor executor.Executor
+	// Root prefixes every path touched by file steps and "creates" checks, "/" on a real host
+	Root string
+	// Packages is the package manager used by package steps. When nil it is
+	// detected with LookPath, which defaults to exec.LookPath.
+	Packages pkg.Manager
+	LookPath func(file string) (string, error)
+	// Facts collects the facts step conditions are matched against. When nil they are read below Root.
+	Facts *facts.Collector
+
+	lines    output.Sink
+	progress pkg.EventFunc
+}
+
+// path resolves an absolute profile path below the host root, refusing paths
+// that would leave it
+func (h *Host) path(p string) (string, error) {
+	if h.Root == "" {
+		return p, nil
+	}
+	root := filepath.Clean(h.Root)
+	target := filepath.Join(root, p)
+	if target != root && !strings.HasPrefix(target, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s escapes the host root", p)
+	}
+	return target, nil
+}
+
+// facts collects the current host facts
+func (h *Host) facts() (*facts.Facts, error) {
+	if h.Facts != nil {
+		return h.Facts.Collect()
+	}
+	return facts.NewCollector(h.Root).Collect()
+}
+
+// run executes args and forwards the output, classified, to the current step
+func (h *Host) run(ctx context.Context, args ...string) (executor.Result, error) {
+	var lines executor.LineFunc
+	if h.lines != nil && len(args) > 0 {
+		lines = output.New(args[0], h.lines).Line
+	}
+	return executor.Run(ctx, h.Executor, executor.Spec{Args: args}, lines)
+}
+
+// succeeds runs args and reports whether it exited with status zero
+func (h *Host) succeeds(ctx context.Context, args ...string) (bool, error) {
+	_, err := h.run(ctx, args...)
+	var exitErr *executor.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// stepState is the difference between the host and a step as found by inspect
+type stepState struct {
+	current string
+	desired string
+	// commands are run in order by apply
+	commands [][]string
+	// operations describe changes apply makes without spawning a process (e.g. file writes)
+	operations []string
+	// packages are installed or removed by package steps
+	packages []pkg.Package
+}
+
+func (s stepState) inSync() bool {
+	return len(s.commands) == 0 && len(s.operations) == 0
+}
+
+// describe lists everything apply would do, one line per command or operation
+func (s stepState) describe() []string {
+	lines := make([]string, 0, len(s.commands)+len(s.operations))
+	for _, command := range s.commands {
+		lines = append(lines, strings.Join(command, " "))
+	}
+	return append(lines, s.operations...)
+}
+
+// action knows how to inspect and converge one step. inspect only runs
+// read-only queries; apply carries out exactly what inspect planned.
+type action interface {
+	inspect(ctx context.Context, host *Host) (stepState, error)
+	apply(ctx context.Context, host *Host, state stepState) error
+}
+
+func newAction(step Step) action {
+	switch step.Type {
+	case StepPackage:
+		return packageAction{step}
+	case StepFile:
+		return fileAction{step}
+	case StepUser:
+		return userAction{step}
+	case StepService:
+		return serviceAction{step}
+	default:
+		return commandAction{step}
+	}
+}
+
+// runCommands is the apply implementation of every action whose changes are plain commands
+func runCommands(ctx context.Context, host *Host, state stepState) error {
+	for _, command := range state.commands {
+		if _, err := host.run(ctx, command...); err != nil {
+			return fmt.Errorf("%s: %v", strings.Join(command, " "), err)
+		}
+	}
+	return nil
+}
+
+// packageManager returns the configured manager or detects one on the host
+func (h *Host) packageManager() (pkg.Manager, error) {
+	if h.Packages != nil {
+		return h.Packages, nil
+	}
+	return pkg.Detect(h.Executor, h.LookPath)
+}
+
+// packageEvent forwards package manager progress to the current step
+func (h *Host) packageEvent(event pkg.Event) {
+	if h.lines != nil {
+		h.lines(output.Line{Stream: event.Stream, Text: event.Line, Level: event.Level()})
+	}
+	if h.progress != nil {
+		h.progress(event)
+	}
+}
+
+type packageAction struct{ step Step }
+
+func (a packageAction) inspect(ctx context.Context, host *Host) (stepState, error) {
+	manager, err := host.packageManager()
+	if err != nil {
+		return stepState{}, err
+	}
+
+	wantInstalled := a.step.desiredState() == StatePresent
+	var current, pending []string
+	var packages []pkg.Package
+	for _, spec := range a.step.Packages {
+		wanted := pkg.ParsePackage(spec)
+		version, err := manager.Installed(ctx, wanted.Name)
+		if err != nil {
+			return stepState{}, err
+		}
+		if version == "" {
+			current = append(current, wanted.Name+" absent")
+		} else {
+			current = append(current, wanted.Name+" "+version)
+		}
+
+		// A pinned package also needs installing when another version is present
+		inSync := (version != "") == wantInstalled
+		if wantInstalled && wanted.Version != "" && version != wanted.Version {
+			inSync = false
+		}
+		if !inSync {
+			pending = append(pending, wanted.Name)
+			packages = append(packages, wanted)
+		}
+	}
+
+	state := stepState{
+		current:  strings.Join(current, ", "),
+		desired:  strings.Join(a.step.Packages, ", ") + " " + a.step.desiredState(),
+		packages: packages,
+	}
+	if len(packages) == 0 {
+		return state, nil
+	}
+	if !wantInstalled {
+		state.commands = [][]string{manager.RemoveArgs(pending)}
+		return state, nil
+	}
+	install, err := manager.InstallArgs(packages)
+	if err != nil {
+		return state, err
+	}
+	if a.step.Update {
+		state.commands = append(state.commands, manager.UpdateArgs())
+	}
+	state.commands = append(state.commands, install)
+	return state, nil
+}
+
+func (a packageAction) apply(ctx context.Context, host *Host, state stepState) error {
+	manager, err := host.packageManager()
+	if err != nil {
+		return err
+	}
+	if a.step.desiredState() == StateAbsent {
+		names := make([]string, 0, len(state.packages))
+		for _, p := range state.packages {
+			names = append(names, p.Name)
+		}
+		return manager.Remove(ctx, names, host.packageEvent)
+	}
+	if a.step.Update {
+		if err := manager.Update(ctx, host.packageEvent); err != nil {
+			return err
+		}
+	}
+	return manager.Install(ctx, state.packages, host.packageEvent)
+}
+
+type fileAction struct{ step Step }
+
+func (a fileAction) inspect(ctx context.Context, host *Host) (stepState, error) {
+	state := stepState{desired: a.step.desiredState()}
+	path, err := host.path(a.step.Path)
+	if err != nil {
+		return state, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		state.current = StateAbsent
+		if a.step.desiredState() == StatePresent {
+			state.operations = append(state.operations, fmt.Sprintf("create %s (%d bytes)", a.step.Path, len(a.step.Content)))
+			state.operations = append(state.operations, fmt.Sprintf("chmod %o %s", a.step.fileMode(), a.step.Path))
+			state.operations = append(state.operations, a.chownOperation()...)
+		}
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	state.current = fmt.Sprintf("present (%d bytes, mode %o)", info.Size(), info.Mode().Perm())
+	if a.step.desiredState() == StateAbsent {
+		state.operations = append(state.operations, "remove "+a.step.Path)
+		return state, nil
+	}
+	state.desired = fmt.Sprintf("present (%d bytes, mode %o)", len(a.step.Content), a.step.fileMode())
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	if !bytes.Equal(content, []byte(a.step.Content)) {
+		state.operations = append(state.operations, fmt.Sprintf("write %s (%d bytes)", a.step.Path, len(a.step.Content)))
+	}
+	if a.step.Mode != "" && info.Mode().Perm() != a.step.fileMode() {
+		state.operations = append(state.operations, fmt.Sprintf("chmod %o %s", a.step.fileMode(), a.step.Path))
+	}
+	uid, gid, err := a.ownership()
+	if err != nil {
+		return state, err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if (uid >= 0 && int(stat.Uid) != uid) || (gid >= 0 && int(stat.Gid) != gid) {
+			state.operations = append(state.operations, a.chownOperation()...)
+		}
+	}
+	return state, nil
+}
+
+func (a fileAction) chownOperation() []string {
+	if a.step.Owner == "" && a.step.Group == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("chown %s:%s %s", a.step.Owner, a.step.Group, a.step.Path)}
+}
+
+func (a fileAction) apply(ctx context.Context, host *Host, state stepState) error {
+	path, err := host.path(a.step.Path)
+	if err != nil {
+		return err
+	}
+	if a.step.desiredState() == StateAbsent {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(a.step.Content), a.step.fileMode()); err != nil {
+		return err
+	}
+	// WriteFile does not change the mode of an existing file
+	if err := os.Chmod(path, a.step.fileMode()); err != nil {
+		return err
+	}
+	uid, gid, err := a.ownership()
+	if err != nil {
+		return err
+	}
+	if uid >= 0 || gid >= 0 {
+		return os.Chown(path, uid, gid)
+	}
+	return nil
+}
+
+// ownership resolves owner and group to numeric IDs, -1 meaning unchanged
+func (a fileAction) ownership() (int, int, error) {
+	uid, gid := -1, -1
+	if a.step.Owner != "" {
+		u, err := user.Lookup(a.step.Owner)
+		if err != nil {
+			return 0, 0, err
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+	if a.step.Group != "" {
+		g, err := user.LookupGroup(a.step.Group)
+		if err != nil {
+			return 0, 0, err
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return uid, gid, nil
+}
+
+type userAction struct{ step Step }
+
+func (a userAction) inspect(ctx context.Context, host *Host) (stepState, error) {
+	state := stepState{desired: a.step.desiredState()}
+	if len(a.step.Groups) > 0 && a.step.desiredState() == StatePresent {
+		state.desired = "present in " + strings.Join(a.step.Groups, ",")
+	}
+
+	exists, err := host.succeeds(ctx, "id", "-u", a.step.User)
+	if err != nil {
+		return state, err
+	}
+	if !exists {
+		state.current = StateAbsent
+		if a.step.desiredState() == StatePresent {
+			state.commands = [][]string{a.addArgs()}
+		}
+		return state, nil
+	}
+	if a.step.desiredState() == StateAbsent {
+		state.current = StatePresent
+		state.commands = [][]string{{"userdel", a.step.User}}
+		return state, nil
+	}
+
+	result, err := host.run(ctx, "id", "-nG", a.step.User)
+	if err != nil {
+		return state, err
+	}
+	groups := strings.Fields(result.Stdout)
+	state.current = "present in " + strings.Join(groups, ",")
+
+	current := map[string]bool{}
+	for _, group := range groups {
+		current[group] = true
+	}
+	var missing []string
+	for _, group := range a.step.Groups {
+		if !current[group] {
+			missing = append(missing, group)
+		}
+	}
+	if len(missing) > 0 {
+		state.commands = [][]string{{"usermod", "-aG", strings.Join(missing, ","), a.step.User}}
+	}
+	return state, nil
+}
+
+func (a userAction) apply(ctx context.Context, host *Host, state stepState) error {
+	return runCommands(ctx, host, state)
+}
+
+func (a userAction) addArgs() []string {
+	args := []string{"useradd", "-m"}
+	if a.step.System {
+		args = append(args, "-r")
+	}
+	if a.step.Shell != "" {
+		args = append(args, "-s", a.step.Shell)
+	}
+	if a.step.Home != "" {
+		args = append(args, "-d", a.step.Home)
+	}
+	if len(a.step.Groups) > 0 {
+		args = append(args, "-G", strings.Join(a.step.Groups, ","))
+	}
+	return append(args, a.step.User)
+}
+
+type serviceAction struct{ step Step }
+
+func (a serviceAction) inspect(ctx context.Context, host *Host) (stepState, error) {
+	var state stepState
+
+	active, err := host.succeeds(ctx, "systemctl", "is-active", "--quiet", a.step.Service)
+	if err != nil {
+		return state, err
+	}
+	wantActive := a.step.desiredState() == StateRunning
+	state.current = map[bool]string{true: StateRunning, false: StateStopped}[active]
+	state.desired = a.step.desiredState()
+
+	if a.step.Enabled != nil {
+		enabled, err := host.succeeds(ctx, "systemctl", "is-enabled", "--quiet", a.step.Service)
+		if err != nil {
+			return state, err
+		}
+		state.current += map[bool]string{true: ", enabled", false: ", disabled"}[enabled]
+		state.desired += map[bool]string{true: ", enabled", false: ", disabled"}[*a.step.Enabled]
+		if enabled != *a.step.Enabled {
+			verb := "disable"
+			if *a.step.Enabled {
+				verb = "enable"
+			}
+			state.commands = append(state.commands, []string{"systemctl", verb, a.step.Service})
+		}
+	}
+	if active != wantActive {
+		verb := "stop"
+		if wantActive {
+			verb = "start"
+		}
+		state.commands = append(state.commands, []string{"systemctl", verb, a.step.Service})
+	}
+	return state, nil
+}
+
+func (a serviceAction) apply(ctx context.Context, host *Host, state stepState) error {
+	return runCommands(ctx, host, state)
+}
+
+type commandAction struct{ step Step }
+
+func (a commandAction) inspect(ctx context.Context, host *Host) (stepState, error) {
+	state := stepState{current: "not run", desired: "run"}
+	if a.step.Creates != "" {
+		state.desired = a.step.Creates + " exists"
+		creates, err := host.path(a.step.Creates)
+		if err != nil {
+			return state, err
+		}
+		if _, err := os.Stat(creates); err == nil {
+			state.current = a.step.Creates + " exists"
+			return state, nil
+		}
+		state.current = a.step.Creates + " missing"
+	}
+	state.commands = [][]string{a.step.Command}
+	return state, nil
+}
+
+func (a commandAction) apply(ctx context.Context, host *Host, state stepState) error {
+	return runCommands(ctx, host, state)
+}
@@ -0,0 +1,98 @@
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrProfileNotFound is returned for unknown profile names
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Store keeps profiles as files in a directory. Uploaded profiles are written
+// as <name>.json; hand-written .json, .yaml and .yml files are picked up too.
+type Store struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewStore opens (and creates if needed) the profile directory
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Save validates and stores profile, replacing any profile with the same name
+func (s *Store) Save(profile *Profile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Remove hand-written variants so the uploaded version wins
+	for _, ext := range []string{".yaml", ".yml"} {
+		os.Remove(filepath.Join(s.dir, profile.Name+ext))
+	}
+	tmp := filepath.Join(s.dir, "."+profile.Name+".json.tmp")
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, profile.Name+".json"))
+}
+
+// Get loads a profile by name
+func (s *Store) Get(name string) (*Profile, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrProfileNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		profile, err := LoadFile(filepath.Join(s.dir, name+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		return profile, err
+	}
+	return nil, ErrProfileNotFound
+}
+
+// List loads every valid profile, sorted by name. Invalid files are logged and skipped.
+func (s *Store) List() ([]*Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []*Profile
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		profile, err := LoadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			setupLog.Warn("Skipping invalid profile", "file", entry.Name(), "error", err)
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, k int) bool { return profiles[i].Name < profiles[k].Name })
+	return profiles, nil
+}
@@ -0,0 +1,551 @@
+// Package supervisor runs a child process under a restart policy. It hands the
+// child its connection details on a private pipe, waits for it to report
+// ready, logs its output and stops it with a signal before killing it.
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/metrics"
+	"spi-go-core/internal/output"
+)
+
+// appLog is the log of the app component
+var appLog = logging.For(logging.App)
+
+// Default timings
+const (
+	DefaultMinBackoff   = 500 * time.Millisecond
+	DefaultMaxBackoff   = 30 * time.Second
+	DefaultStableAfter  = time.Minute
+	DefaultReadyTimeout = 30 * time.Second
+	DefaultStopTimeout  = 10 * time.Second
+)
+
+// Environment variables telling the child which descriptors to use
+const (
+	HandoffFDEnv = "SPI_HANDOFF_FD"
+	ReadyFDEnv   = "SPI_READY_FD"
+)
+
+// Policy decides whether an exited process is started again
+type Policy string
+
+const (
+	// RestartOnFailure restarts after a non-zero exit, a failed start or a missed readiness deadline
+	RestartOnFailure Policy = "on-failure"
+	// RestartAlways also restarts after a clean exit
+	RestartAlways Policy = "always"
+	// RestartNever runs the process once
+	RestartNever Policy = "never"
+)
+
+// ParsePolicy validates a policy name, an empty name meaning RestartOnFailure
+func ParsePolicy(name string) (Policy, error) {
+	switch Policy(name) {
+	case "":
+		return RestartOnFailure, nil
+	case RestartOnFailure, RestartAlways, RestartNever:
+		return Policy(name), nil
+	}
+	return "", fmt.Errorf("unknown restart policy %q (expected on-failure, always or never)", name)
+}
+
+// State is where the supervised process is in its lifecycle
+type State string
+
+const (
+	StateIdle     State = "idle"     // not started yet
+	StateDisabled State = "disabled" // there is nothing to run
+	StateStarting State = "starting" // started, not ready yet
+	StateReady    State = "ready"
+	StateBackoff  State = "backoff" // waiting to restart
+	StateStopping State = "stopping"
+	StateStopped  State = "stopped" // stopped by Stop or the context
+	StateExited   State = "exited"  // exited and not restarted
+	StateFailed   State = "failed"
+)
+
+// Readiness configures how the child reports that it is ready. With neither
+// option set the child counts as ready once it has started.
+type Readiness struct {
+	// Pipe passes a write-only descriptor (named by SPI_READY_FD) on which the
+	// child writes a line "ready"
+	Pipe bool
+	// HealthURL is polled until it answers with a 2xx status
+	HealthURL string
+	// Timeout is how long the child has to become ready before it is killed
+	Timeout time.Duration
+}
+
+// Status is a point-in-time snapshot of the supervisor, safe to encode as JSON
+type Status struct {
+	Name      string     `json:"name"`
+	State     State      `json:"state"`
+	Policy    Policy     `json:"policy"`
+	Command   string     `json:"command,omitempty"`
+	PID       int        `json:"pid,omitempty"`
+	Restarts  int        `json:"restarts"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	ReadyAt   *time.Time `json:"readyAt,omitempty"`
+	ExitCode  *int       `json:"exitCode,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Supervisor runs Spec under Policy. Configure it before calling Run.
+type Supervisor struct {
+	Name     string
+	Executor executor.Executor
+	Spec     executor.Spec
+	Policy   Policy
+	// Handoff is written to a read-only descriptor (named by SPI_HANDOFF_FD)
+	// and closed, so secrets never show up in the argv or environment
+	Handoff   []byte
+	Readiness Readiness
+	// Output receives every line the process writes. It defaults to the core's
+	// log, as far as the verbosity shows the line.
+	Output executor.LineFunc
+	// MinBackoff is the delay before the first restart; it doubles with every
+	// further failure up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// StableAfter resets the backoff once a run lasted at least this long
+	StableAfter time.Duration
+	// StopTimeout is how long Stop waits after signalling before it kills the process
+	StopTimeout time.Duration
+	// Events receives a task event whenever the state changes
+	Events *events.Bus
+
+	mu       sync.Mutex
+	status   Status
+	proc     executor.Process
+	procDone chan struct{} // closed when proc has exited
+	stopping bool
+	stop     chan struct{} // closed by the first Stop
+}
+
+// New returns a supervisor for spec with the default policy
+func New(name string, ex executor.Executor, spec executor.Spec) *Supervisor {
+	return &Supervisor{Name: name, Executor: ex, Spec: spec}
+}
+
+// Status returns a snapshot of the supervised process
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Name = s.Name
+	status.Policy = s.policy()
+	if status.State == "" {
+		status.State = StateIdle
+	}
+	return status
+}
+
+// SetHandoff replaces the connection details given to the next start, e.g.
+// after the server certificate was reloaded
+func (s *Supervisor) SetHandoff(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Handoff = data
+}
+
+// Disable records why there is nothing to supervise
+func (s *Supervisor) Disable(reason string) {
+	s.update(func(status *Status) {
+		status.State = StateDisabled
+		status.Error = reason
+	})
+}
+
+// Fail records an error that happened before the process could be started
+func (s *Supervisor) Fail(err error) {
+	s.update(func(status *Status) {
+		status.State = StateFailed
+		status.Error = err.Error()
+	})
+}
+
+// Stop forwards sig to the running process, ends the restart loop and waits
+// until the process has exited, killing it after StopTimeout
+func (s *Supervisor) Stop(sig os.Signal) {
+	s.mu.Lock()
+	first := !s.stopping
+	if first {
+		s.stopping = true
+		close(s.stopChan())
+	}
+	proc, done := s.proc, s.procDone
+	s.mu.Unlock()
+	if proc == nil {
+		return
+	}
+	s.update(func(status *Status) {
+		// Unless the process exited in the meantime
+		if s.proc == proc {
+			status.State = StateStopping
+		}
+	})
+
+	if first {
+		appLog.Info("Forwarding signal", "process", s.Name, "signal", sig.String(), "pid", proc.Pid())
+		proc.Signal(sig)
+	}
+	select {
+	case <-done:
+	case <-time.After(s.stopTimeout()):
+		appLog.Warn("Process did not exit in time, killing it", "process", s.Name, "timeout", s.stopTimeout())
+		proc.Kill()
+		<-done
+	}
+}
+
+// Run starts the process and restarts it as the policy demands. It returns
+// once the process will not be restarted again, after Stop or when ctx is
+// canceled, which stops the process with SIGTERM.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if len(s.Spec.Args) == 0 {
+		return errors.New("nothing to supervise")
+	}
+	s.mu.Lock()
+	stop := s.stopChan()
+	s.mu.Unlock()
+
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Stop(syscall.SIGTERM)
+		case <-watchDone:
+		}
+	}()
+
+	failures := 0
+	for {
+		if s.isStopping() {
+			s.update(func(status *Status) { status.State = StateStopped })
+			return nil
+		}
+		started := time.Now()
+		code, err := s.runOnce()
+
+		if s.isStopping() {
+			s.finish(StateStopped, code, nil)
+			return nil
+		}
+		if err == nil && s.policy() != RestartAlways {
+			appLog.Info("Process exited", "process", s.Name)
+			s.finish(StateExited, code, nil)
+			return nil
+		}
+		if err != nil && s.policy() == RestartNever {
+			appLog.Error("Process failed", "process", s.Name, "error", err)
+			s.finish(StateFailed, code, err)
+			return err
+		}
+
+		if time.Since(started) >= s.stableAfter() {
+			failures = 0
+		}
+		delay := s.backoff(failures)
+		failures++
+		if err != nil {
+			appLog.Warn("Process failed, restarting", "process", s.Name, "error", err, "delay", delay)
+		} else {
+			appLog.Info("Process exited, restarting", "process", s.Name, "delay", delay)
+		}
+		s.finish(StateBackoff, code, err)
+		metrics.SupervisorRestarts.Inc(s.Name)
+
+		select {
+		case <-stop:
+		case <-time.After(delay):
+			s.update(func(status *Status) { status.Restarts++ })
+		}
+	}
+}
+
+// runOnce starts the process, waits for it to become ready and to exit
+func (s *Supervisor) runOnce() (int, error) {
+	spec := s.Spec
+	spec.ExtraFiles = append([]*os.File(nil), s.Spec.ExtraFiles...)
+	var env []string
+	var parentEnds, childEnds []*os.File
+	closeAll := func(files []*os.File) {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+
+	s.mu.Lock()
+	handoffData := s.Handoff
+	s.mu.Unlock()
+	var handoff *os.File
+	if handoffData != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return -1, err
+		}
+		handoff = w
+		parentEnds, childEnds = append(parentEnds, w), append(childEnds, r)
+		env = append(env, fmt.Sprintf("%s=%d", HandoffFDEnv, 3+len(spec.ExtraFiles)))
+		spec.ExtraFiles = append(spec.ExtraFiles, r)
+	}
+	var ready *os.File
+	if s.Readiness.Pipe {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeAll(parentEnds)
+			closeAll(childEnds)
+			return -1, err
+		}
+		ready = r
+		parentEnds, childEnds = append(parentEnds, r), append(childEnds, w)
+		env = append(env, fmt.Sprintf("%s=%d", ReadyFDEnv, 3+len(spec.ExtraFiles)))
+		spec.ExtraFiles = append(spec.ExtraFiles, w)
+	}
+	if len(env) > 0 {
+		base := spec.Env
+		if base == nil {
+			base = os.Environ()
+		}
+		spec.Env = append(append([]string(nil), base...), env...)
+	}
+
+	s.update(func(status *Status) {
+		now := time.Now()
+		status.State = StateStarting
+		status.Command = spec.String()
+		status.StartedAt = &now
+		status.ReadyAt = nil
+		status.PID = 0
+	})
+
+	// The process is only ever ended through Stop or a readiness timeout
+	proc, err := s.Executor.Start(context.Background(), spec)
+	// The child holds its own copies now
+	closeAll(childEnds)
+	if err != nil {
+		closeAll(parentEnds)
+		return -1, err
+	}
+	defer closeAll(parentEnds)
+
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.proc, s.procDone = proc, done
+	s.status.PID = proc.Pid()
+	stopping := s.stopping
+	s.mu.Unlock()
+	if stopping {
+		// Stop was called while the process was starting
+		proc.Signal(syscall.SIGTERM)
+	}
+
+	if handoff != nil {
+		go func() {
+			handoff.Write(handoffData)
+			handoff.Close()
+		}()
+	}
+
+	exited := make(chan struct{})
+	readyErr := make(chan error, 1)
+	go func() { readyErr <- s.awaitReady(ready, exited) }()
+
+	lines := s.Output
+	if lines == nil {
+		lines = output.New(s.Spec.Args[0], output.Shown(output.Log(appLog.With("process", s.Name)))).Line
+	}
+	streamErr := executor.Stream(proc, lines)
+	code, err := proc.Wait()
+	close(exited)
+	if err == nil {
+		err = streamErr
+	}
+
+	s.mu.Lock()
+	s.proc, s.procDone = nil, nil
+	s.mu.Unlock()
+	close(done)
+	if notReady := <-readyErr; notReady != nil && !s.isStopping() {
+		return code, notReady
+	}
+	return code, err
+}
+
+// awaitReady marks the process ready or kills it when the deadline passes
+func (s *Supervisor) awaitReady(pipe *os.File, exited <-chan struct{}) error {
+	signalled := make(chan struct{})
+	switch {
+	case pipe != nil:
+		go func() {
+			scanner := bufio.NewScanner(pipe)
+			for scanner.Scan() {
+				if strings.TrimSpace(scanner.Text()) == "ready" {
+					close(signalled)
+					return
+				}
+			}
+		}()
+	case s.Readiness.HealthURL != "":
+		go s.pollHealth(signalled, exited)
+	default:
+		close(signalled)
+	}
+
+	timeout := s.Readiness.Timeout
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+	select {
+	case <-signalled:
+		s.update(func(status *Status) {
+			now := time.Now()
+			status.State = StateReady
+			status.ReadyAt = &now
+		})
+		appLog.Info("Process is ready", "process", s.Name)
+		return nil
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+		s.mu.Lock()
+		proc := s.proc
+		s.mu.Unlock()
+		if proc != nil {
+			proc.Kill()
+		}
+		return fmt.Errorf("not ready after %s", timeout)
+	}
+}
+
+// pollHealth closes ready once HealthURL answers with a 2xx status
+func (s *Supervisor) pollHealth(ready chan<- struct{}, exited <-chan struct{}) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if resp, err := client.Get(s.Readiness.HealthURL); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				close(ready)
+				return
+			}
+		}
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// finish records how a run ended and wakes up Stop
+func (s *Supervisor) finish(state State, code int, err error) {
+	s.update(func(status *Status) {
+		status.State = state
+		status.PID = 0
+		status.ExitCode = &code
+		status.Error = ""
+		if err != nil {
+			status.Error = err.Error()
+		}
+	})
+}
+
+func (s *Supervisor) update(fn func(status *Status)) {
+	s.mu.Lock()
+	previous := s.status.State
+	fn(&s.status)
+	status := s.status
+	s.mu.Unlock()
+	if status.State != previous {
+		s.publish(status)
+	}
+}
+
+// publish reports a state change on the event bus
+func (s *Supervisor) publish(status Status) {
+	event := events.Event{Source: events.SourceApp, Task: s.Name, Title: status.Command, Message: string(status.State), Error: status.Error}
+	switch status.State {
+	case StateReady:
+		event.Status = events.StatusSucceeded
+	case StateFailed:
+		event.Status = events.StatusFailed
+	case StateExited, StateStopped, StateDisabled:
+		event.Status = events.StatusSkipped
+		if status.ExitCode != nil && *status.ExitCode != 0 {
+			event.Status = events.StatusFailed
+		}
+	default:
+		event.Status = events.StatusRunning
+	}
+	s.Events.Publish(event)
+}
+
+// stopChan returns the channel closed by Stop; the caller holds s.mu
+func (s *Supervisor) stopChan() chan struct{} {
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	return s.stop
+}
+
+func (s *Supervisor) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+func (s *Supervisor) policy() Policy {
+	if s.Policy == "" {
+		return RestartOnFailure
+	}
+	return s.Policy
+}
+
+// backoff returns the delay after the given number of consecutive failures
+func (s *Supervisor) backoff(failures int) time.Duration {
+	delay, limit := s.MinBackoff, s.MaxBackoff
+	if delay <= 0 {
+		delay = DefaultMinBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultMaxBackoff
+	}
+	for i := 0; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+func (s *Supervisor) stableAfter() time.Duration {
+	if s.StableAfter <= 0 {
+		return DefaultStableAfter
+	}
+	return s.StableAfter
+}
+
+func (s *Supervisor) stopTimeout() time.Duration {
+	if s.StopTimeout <= 0 {
+		return DefaultStopTimeout
+	}
+	return s.StopTimeout
+}
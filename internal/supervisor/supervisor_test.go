@@ -0,0 +1,170 @@
+package supervisor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"spi-go-core/internal/executor"
+)
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRestartsAfterCrash(t *testing.T) {
+	fake := executor.NewFake(
+		executor.Script{Match: []string{"node"}, Stderr: []string{"boom"}, ExitCode: 1, Once: true},
+		executor.Script{Match: []string{"node"}, StartErr: "exec format error", Once: true},
+		executor.Script{Match: []string{"node"}, Stdout: []string{"listening"}},
+	)
+	var lines []string
+	s := New("app", fake, executor.Spec{Args: []string{"node", "dist/index.js"}})
+	s.Output = func(stream, line string) { lines = append(lines, stream+": "+line) }
+	s.MinBackoff = time.Millisecond
+
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if calls := fake.Calls(); len(calls) != 3 {
+		t.Errorf("Expected 3 starts, got %d", len(calls))
+	}
+	if len(lines) != 2 || lines[0] != "stderr: boom" || lines[1] != "stdout: listening" {
+		t.Errorf("Unexpected output %v", lines)
+	}
+	if status := s.Status(); status.State != StateExited || status.Restarts != 2 || *status.ExitCode != 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestRestartPolicies(t *testing.T) {
+	// never gives up after the first failure
+	fake := executor.NewFake(executor.Script{Match: []string{"node"}, ExitCode: 3})
+	s := New("app", fake, executor.Spec{Args: []string{"node"}})
+	s.Policy = RestartNever
+	if err := s.Run(context.Background()); err == nil || s.Status().State != StateFailed {
+		t.Errorf("Expected the app to fail once, got %v and %+v", err, s.Status())
+	}
+	if len(fake.Calls()) != 1 {
+		t.Errorf("Expected a single start, got %d", len(fake.Calls()))
+	}
+
+	// always restarts clean exits too, until stopped
+	fake = executor.NewFake(executor.Script{Match: []string{"node"}})
+	s = New("app", fake, executor.Spec{Args: []string{"node"}})
+	s.Policy = RestartAlways
+	s.MinBackoff, s.MaxBackoff = time.Millisecond, time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	waitFor(t, "three starts", func() bool { return len(fake.Calls()) >= 3 })
+	cancel()
+	if err := <-done; err != nil || s.Status().State != StateStopped {
+		t.Errorf("Expected a clean stop, got %v and %+v", err, s.Status())
+	}
+
+	if _, err := ParsePolicy("sometimes"); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
+
+func TestStopsWhenCanceled(t *testing.T) {
+	fake := executor.NewFake(executor.Script{Match: []string{"node"}, ExitCode: 1})
+	s := New("app", fake, executor.Spec{Args: []string{"node"}})
+	s.MinBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	// The first crash leaves the supervisor waiting out its backoff
+	waitFor(t, "the backoff", func() bool { return s.Status().State == StateBackoff })
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean stop, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Supervisor did not stop after cancellation")
+	}
+}
+
+func TestHandoffReadinessAndSignalForwarding(t *testing.T) {
+	// The child echoes the handoff, reports ready and exits 0 on SIGINT
+	script := `trap 'echo interrupted; exit 0' INT
+cat <&$SPI_HANDOFF_FD; echo
+echo ready >&$SPI_READY_FD
+while :; do sleep 0.01; done`
+	var mu sync.Mutex
+	var lines []string
+	s := New("app", executor.NewOS(), executor.Spec{Args: []string{"sh", "-c", script}})
+	s.Handoff = []byte(`{"port":8443}`)
+	s.Readiness = Readiness{Pipe: true, Timeout: 5 * time.Second}
+	s.Output = func(stream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Run(context.Background()) }()
+	waitFor(t, "readiness", func() bool { return s.Status().State == StateReady })
+
+	status := s.Status()
+	if status.PID == 0 || status.ReadyAt == nil || strings.Contains(status.Command, "8443") {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	s.Stop(syscall.SIGINT)
+	if err := <-done; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(lines, "\n") != "{\"port\":8443}\ninterrupted" {
+		t.Errorf("Unexpected output %q", lines)
+	}
+	if status := s.Status(); status.State != StateStopped {
+		t.Errorf("Expected the app to be stopped, got %+v", status)
+	}
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer health.Close()
+
+	fake := executor.NewFake(executor.Script{Match: []string{"node"}, Stdout: []string{"starting"}, Delay: time.Hour})
+	s := New("app", fake, executor.Spec{Args: []string{"node"}})
+	s.Policy = RestartNever
+	s.Readiness = Readiness{HealthURL: health.URL, Timeout: 50 * time.Millisecond}
+
+	err := s.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not ready after") {
+		t.Errorf("Expected a readiness timeout, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := &Supervisor{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for failures, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if delay := s.backoff(failures); delay != expected {
+			t.Errorf("backoff(%d) = %s, expected %s", failures, delay, expected)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package testutil provides an in-process SPI core server for tests. It
+// generates throwaway server keys and a config file in a temporary directory
+// and serves the real router through httptest.
+package testutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/profiles"
+	"spi-go-core/internal/supervisor"
+	"spi-go-core/routes"
+)
+
+// DefaultAllowedCommands is the allowlist written to the generated config
+var DefaultAllowedCommands = []string{"pwd", "whoami"}
+
+// Harness is a running in-process server together with the material it was started from
+type Harness struct {
+	Server     *httptest.Server
+	Config     *config.AppConfig
+	ConfigPath string
+	// ConfigStore reloads ConfigPath like the server does
+	ConfigStore *config.Store
+	ServerKey   *rsa.PrivateKey
+	Dir         string
+	// Supervisor runs a scripted "node dist/index.js" that prints one line and exits
+	Supervisor *supervisor.Supervisor
+	// Approvals is the gate commands and steps needing approval wait at; attach to decide
+	Approvals *approval.Gate
+	// Sessions holds the sessions of the handshake; shorten its TTL to expire them
+	Sessions *encryption.SessionStore
+}
+
+// NewHarness generates keys and a config file, resolves the config through the
+// regular loader and serves the real router until the test finishes
+func NewHarness(t testing.TB) *Harness {
+	t.Helper()
+
+	dir := t.TempDir()
+	key := GenerateKey(t)
+	privatePath, publicPath := WriteKeyFiles(t, dir, key)
+
+	manifest := filepath.Join(dir, "node-manifest.json")
+	if err := os.WriteFile(manifest, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	raw := map[string]any{
+		"server":     map[string]any{"port": 8443, "tls_enabled": false},
+		"commands":   map[string]any{"allowed": DefaultAllowedCommands},
+		"encryption": map[string]any{"enabled": false, "public_key": publicPath, "private_key": privatePath},
+		"logging":    map[string]any{"verbosity": "normal"},
+		"UI":         map[string]any{"enabled": false},
+		"runtime":    map[string]any{"manifest": manifest},
+	}
+	configPath := filepath.Join(dir, "config.json")
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to encode config: %v", err)
+	}
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// Only the generated file counts, not /etc/spi-go-core or SPI_* variables
+	load := func() (*config.Resolved, error) {
+		return config.Resolve(config.Options{SystemDir: filepath.Join(dir, "etc"), File: configPath, Env: []string{}})
+	}
+	resolved, err := load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg := resolved.Config
+	store := config.NewStore(resolved, load)
+	ex := executor.Traced(executor.NewOS())
+
+	profileStore, err := profiles.NewStore(filepath.Join(dir, "profiles"))
+	if err != nil {
+		t.Fatalf("Failed to open profile store: %v", err)
+	}
+
+	// Profiles and facts both work below dir/root instead of the real host
+	factsCollector := facts.NewCollector(filepath.Join(dir, "root"))
+	app := supervisor.New("app", executor.NewFake(executor.Script{Match: []string{"node"}, Stdout: []string{"listening"}}),
+		executor.Spec{Args: []string{"node", "dist/index.js"}})
+	approvals := approval.NewGate()
+	sessions := encryption.NewSessionStore(encryption.DefaultSessionTTL)
+	router := routes.NewRouter(routes.Dependencies{
+		Jobs:          jobs.NewManager(ex),
+		Profiles:      profileStore,
+		ProfileRunner: profiles.NewRunner(&profiles.Host{Executor: ex, Root: filepath.Join(dir, "root"), Facts: factsCollector}),
+		Facts:         factsCollector,
+		Supervisor:    app,
+		Config:        store,
+		Sessions:      sessions,
+		Approvals:     approvals,
+		Executor:      ex,
+	})
+	router.RegisterRoutes()
+	server := httptest.NewServer(router.Handler())
+	t.Cleanup(server.Close)
+
+	return &Harness{
+		Server:      server,
+		Config:      cfg,
+		ConfigPath:  configPath,
+		ConfigStore: store,
+		ServerKey:   key,
+		Dir:         dir,
+		Supervisor:  app,
+		Approvals:   approvals,
+		Sessions:    sessions,
+	}
+}
+
+// UpdateConfig rewrites the config file with the changes made by edit
+func (h *Harness) UpdateConfig(t testing.TB, edit func(raw map[string]any)) {
+	t.Helper()
+	data, err := os.ReadFile(h.ConfigPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+	edit(raw)
+	if data, err = json.MarshalIndent(raw, "", "  "); err != nil {
+		t.Fatalf("Failed to encode config: %v", err)
+	}
+	if err := os.WriteFile(h.ConfigPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+// GenerateKey creates a 2048-bit RSA key
+func GenerateKey(t testing.TB) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	return key
+}
+
+// WriteKeyFiles writes key as PKCS#8 private and PKIX public PEM files into dir
+func WriteKeyFiles(t testing.TB, dir string, key *rsa.PrivateKey) (string, string) {
+	t.Helper()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+	privatePath := filepath.Join(dir, "go_private_key.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+
+	publicPath := filepath.Join(dir, "go_public_key.pem")
+	if err := os.WriteFile(publicPath, []byte(PublicKeyPEM(t, &key.PublicKey)), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	return privatePath, publicPath
+}
+
+// PublicKeyPEM encodes key in the PKIX PEM form used by the key exchange
+func PublicKeyPEM(t testing.TB, key *rsa.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// Post sends a JSON body to path, attaching sessionID as X-Request-ID when it is not empty
+func (h *Harness) Post(t testing.TB, path, sessionID string, body any) *http.Response {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, h.Server.URL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		req.Header.Set("X-Request-ID", sessionID)
+	}
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Request to %s failed: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// Encrypt encrypts msg for key and base64-encodes it the way handshake payloads are sent
+func Encrypt(t testing.TB, key *rsa.PublicKey, msg []byte) string {
+	t.Helper()
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, key, msg)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+// Decrypt base64-decodes and decrypts a handshake payload addressed to key
+func Decrypt(t testing.TB, key *rsa.PrivateKey, encoded string) []byte {
+	t.Helper()
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	plaintext, err := rsa.DecryptPKCS1v15(rand.Reader, key, ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decrypt payload: %v", err)
+	}
+	return plaintext
+}
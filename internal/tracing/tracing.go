@@ -0,0 +1,153 @@
+// Package tracing records OpenTelemetry spans for HTTP requests, handshake
+// stages, policy decisions, processes, jobs and profile steps. Spans are
+// exported to an OTLP collector or, offline, as JSON to stdout or a file.
+// Without an exporter spans are not recorded, but the trace of an incoming
+// traceparent header still reaches the log lines of the request.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/logging"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// name is the instrumentation scope of every span
+const name = "spi-go-core"
+
+// propagator reads and writes W3C traceparent and tracestate headers
+var propagator = propagation.TraceContext{}
+
+func init() {
+	otel.SetTextMapPropagator(propagator)
+}
+
+// active is the provider Configure installed, flushed when it is replaced
+var active struct {
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider // nil without an exporter
+	closer   io.Closer                // the file of the file exporter
+}
+
+// Configure installs the exporter of cfg, replacing and flushing the one
+// before. version is reported as the service version. Reloads call it again.
+func Configure(cfg config.TracingConfig, version string) error {
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+		err      error
+	)
+	switch cfg.Exporter {
+	case "", "none":
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "file":
+		var f *logging.File
+		if f, err = logging.OpenFile(cfg.File, logging.CurrentRotation()); err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+			closer = f
+		}
+	default:
+		err = fmt.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up the %s span exporter: %v", cfg.Exporter, err)
+	}
+
+	var provider *sdktrace.TracerProvider
+	if exporter != nil {
+		provider = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+			sdktrace.WithResource(resource.NewSchemaless(
+				attribute.String("service.name", name),
+				attribute.String("service.version", version),
+			)),
+		)
+		otel.SetTracerProvider(provider)
+	} else {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	}
+
+	active.mu.Lock()
+	oldProvider, oldCloser := active.provider, active.closer
+	active.provider, active.closer = provider, closer
+	active.mu.Unlock()
+	return shutdown(context.Background(), oldProvider, oldCloser)
+}
+
+// Shutdown exports the spans still buffered and stops exporting
+func Shutdown(ctx context.Context) error {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	active.mu.Lock()
+	provider, closer := active.provider, active.closer
+	active.provider, active.closer = nil, nil
+	active.mu.Unlock()
+	return shutdown(ctx, provider, closer)
+}
+
+func shutdown(ctx context.Context, provider *sdktrace.TracerProvider, closer io.Closer) error {
+	var err error
+	if provider != nil {
+		err = provider.Shutdown(ctx)
+	}
+	if closer != nil {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// Tracer returns the tracer of the installed provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Start starts a span as a child of the span in ctx
+func Start(ctx context.Context, spanName string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, spanName, trace.WithAttributes(attrs...))
+}
+
+// End marks span as failed when err is set and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Extract returns ctx carrying the remote span of a traceparent header in
+// header, if there is a valid one
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject writes the traceparent of the span in ctx to header
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// WithParent returns ctx carrying the span of parent, for work such as jobs
+// that outlives the request which asked for it. Only the span is carried
+// over, not the cancellation or deadline of parent.
+func WithParent(ctx, parent context.Context) context.Context {
+	return trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(parent))
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"spi-go-core/internal/config"
+	"strings"
+	"testing"
+)
+
+// clientTrace is a sampled traceparent as a client would send it
+const clientTrace = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// exportedSpan is the part of a span the file exporter writes that the tests check
+type exportedSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	Status      struct{ Code string }
+}
+
+func TestFileExporterContinuesTheClientsTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "traces.jsonl")
+	if err := Configure(config.TracingConfig{Exporter: "file", File: path, SampleRatio: 0}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Shutdown(context.Background()) })
+
+	header := http.Header{}
+	header.Set("traceparent", clientTrace)
+	ctx, request := Start(Extract(context.Background(), header), "GET /api/exec")
+	_, step := Start(ctx, "process.wait")
+	End(step, errors.New("exit status 1"))
+	End(request, nil)
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spans []exportedSpan
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var span exportedSpan
+		if err := json.Unmarshal([]byte(line), &span); err != nil {
+			t.Fatalf("Invalid span %q: %v", line, err)
+		}
+		spans = append(spans, span)
+	}
+	// The client sampled the trace, so the ratio of 0 does not drop it
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %+v", spans)
+	}
+	wait, served := spans[0], spans[1]
+	if served.SpanContext.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || served.Parent.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("Expected the request span to continue the client's trace, got %+v", served)
+	}
+	if wait.Parent.SpanID != served.SpanContext.SpanID || wait.Status.Code != "Error" {
+		t.Errorf("Expected a failed child of the request span, got %+v", wait)
+	}
+}
+
+func TestInjectWritesTheTraceparent(t *testing.T) {
+	in := http.Header{}
+	in.Set("traceparent", clientTrace)
+	out := http.Header{}
+	Inject(WithParent(context.Background(), Extract(context.Background(), in)), out)
+	if out.Get("traceparent") != clientTrace {
+		t.Errorf("Expected %s, got %q", clientTrace, out.Get("traceparent"))
+	}
+}
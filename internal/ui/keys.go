@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// binding is a key the UI reacts to. The help overlay is built from the
+// bindings, so every key that works is listed there.
+type binding struct {
+	key  tcell.Key // tcell.KeyRune for characters, which match in either case
+	ch   rune
+	name string // the key as the help shows it
+	help string
+	run  func()
+}
+
+// runeKey binds the character ch
+func runeKey(ch rune, help string, run func()) binding {
+	return binding{key: tcell.KeyRune, ch: unicode.ToLower(ch), name: strings.ToUpper(string(ch)), help: help, run: run}
+}
+
+// specialKey binds a key that is not a character, e.g. tcell.KeyCtrlN
+func specialKey(key tcell.Key, name, help string, run func()) binding {
+	return binding{key: key, name: name, help: help, run: run}
+}
+
+func (b binding) matches(event *tcell.EventKey) bool {
+	if b.key == tcell.KeyRune {
+		return event.Key() == tcell.KeyRune && unicode.ToLower(event.Rune()) == b.ch
+	}
+	return event.Key() == b.key
+}
+
+// dispatch runs the first binding matching event, reporting whether there was one
+func dispatch(bindings []binding, event *tcell.EventKey) bool {
+	for _, b := range bindings {
+		if b.matches(event) {
+			b.run()
+			return true
+		}
+	}
+	return false
+}
+
+// helpSection is a titled group of bindings in the help overlay
+type helpSection struct {
+	title    string
+	bindings []binding
+}
+
+// helpText lists the sections for the help overlay
+func helpText(sections []helpSection) string {
+	var b strings.Builder
+	for i, section := range sections {
+		if len(section.bindings) == 0 {
+			continue
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[::b]%s[::-]\n", section.title)
+		for _, binding := range section.bindings {
+			fmt.Fprintf(&b, "  [yellow]%-8s[-] %s\n", tview.Escape(binding.name), tview.Escape(binding.help))
+		}
+	}
+	return b.String()
+}
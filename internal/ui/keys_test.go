@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestDispatchMatchesEitherCase(t *testing.T) {
+	var ran []string
+	bindings := []binding{
+		runeKey('r', "revoke", func() { ran = append(ran, "r") }),
+		specialKey(tcell.KeyEnter, "Enter", "tail", func() { ran = append(ran, "enter") }),
+	}
+	dispatch(bindings, tcell.NewEventKey(tcell.KeyRune, 'R', tcell.ModNone))
+	dispatch(bindings, tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	if dispatch(bindings, tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone)) {
+		t.Error("An unbound key should not be dispatched")
+	}
+	if strings.Join(ran, ",") != "r,enter" {
+		t.Errorf("Expected r then enter to run, got %v", ran)
+	}
+}
+
+func TestHelpTextListsEveryBinding(t *testing.T) {
+	text := helpText([]helpSection{
+		{title: "Everywhere", bindings: []binding{runeKey('?', "show or hide this help", nil)}},
+		{title: "Empty"},
+		{title: "Jobs", bindings: []binding{runeKey('c', "cancel the selected job", nil)}},
+	})
+	if !strings.Contains(text, "Everywhere") || !strings.Contains(text, "cancel the selected job") || strings.Contains(text, "Empty") {
+		t.Errorf("Unexpected help %q", text)
+	}
+	if !strings.Contains(text, "C ") {
+		t.Errorf("Keys should be listed in upper case, got %q", text)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{512: "512 B", 1536: "1.5 KiB", 8 << 30: "8.0 GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
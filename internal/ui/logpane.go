@@ -0,0 +1,346 @@
+package ui
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/output"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// Level is the severity of a log entry, most severe first, in the order of
+// the output levels
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelProgress
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = [...]string{"error", "warn", "progress", "info", "debug"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// levelColors maps a level to its tview color tag
+var levelColors = [...]string{"[red]", "[yellow]", "[green]", "[white]", "[gray]"}
+
+// levelOf returns the pane level of an output level, info for unclassified lines
+func levelOf(l output.Level) Level {
+	if l == 0 {
+		return LevelInfo
+	}
+	return Level(l - output.LevelError)
+}
+
+// DefaultScrollback is how many entries the log pane keeps when not configured
+const DefaultScrollback = 5000
+
+// Entry is one line of the log pane. Lines written through the log package
+// have no source, task or step.
+type Entry struct {
+	Seq    int
+	Time   time.Time
+	Level  Level
+	Source events.Source
+	Task   string
+	Step   string
+	Text   string
+}
+
+// Line renders e as plain text
+func (e Entry) Line() string {
+	return fmt.Sprintf("%s %-5s %s", e.Time.Format("15:04:05"), e.Level, e.Text)
+}
+
+// entryFromEvent turns an event into a log entry, failures as errors, skips
+// as warnings, output at the level it was classified as, other info events as
+// debug and the remaining changes of tasks and steps as progress
+func entryFromEvent(e events.Event) Entry {
+	level := LevelProgress
+	switch {
+	case e.Status == events.StatusFailed || e.Error != "":
+		level = LevelError
+	case e.Status == events.StatusSkipped:
+		level = LevelWarn
+	case e.Stream != "":
+		level = levelOf(e.Level)
+	case e.Status == events.StatusInfo:
+		level = LevelDebug
+	}
+	return Entry{Time: e.Time, Level: level, Source: e.Source, Task: e.Task, Step: e.Step, Text: eventText(e)}
+}
+
+// entryFromRecord turns a log record into an entry: the server's own info
+// messages are progress, the other levels map to their own. The text is the
+// message followed by the attributes, the component first.
+func entryFromRecord(r slog.Record) Entry {
+	entry := Entry{Time: r.Time, Level: LevelProgress, Text: r.Message}
+	switch {
+	case r.Level >= slog.LevelError:
+		entry.Level = LevelError
+	case r.Level >= slog.LevelWarn:
+		entry.Level = LevelWarn
+	case r.Level < slog.LevelInfo:
+		entry.Level = LevelDebug
+	}
+	var attrs []string
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "component" {
+			entry.Text = "[" + a.Value.String() + "] " + entry.Text
+		} else {
+			attrs = append(attrs, a.String())
+		}
+		return true
+	})
+	if len(attrs) > 0 {
+		entry.Text += " " + strings.Join(attrs, " ")
+	}
+	return entry
+}
+
+// Ring keeps the most recent entries up to a fixed capacity
+type Ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	start   int // index of the oldest entry once full
+	seq     int
+	dropped int
+}
+
+// NewRing returns an empty ring holding up to capacity entries
+func NewRing(capacity int) *Ring {
+	if capacity <= 0 {
+		capacity = DefaultScrollback
+	}
+	return &Ring{entries: make([]Entry, 0, capacity)}
+}
+
+// Add numbers e, stores it in place of the oldest entry when full and returns it
+func (r *Ring) Add(e Entry) Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	e.Seq = r.seq
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, e)
+		return e
+	}
+	r.entries[r.start] = e
+	r.start = (r.start + 1) % len(r.entries)
+	r.dropped++
+	return e
+}
+
+// Entries returns the stored entries, oldest first
+func (r *Ring) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]Entry, 0, len(r.entries))
+	entries = append(entries, r.entries[r.start:]...)
+	return append(entries, r.entries[:r.start]...)
+}
+
+// Dropped returns how many entries were pushed out by newer ones
+func (r *Ring) Dropped() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Filter selects the entries the log pane shows
+type Filter struct {
+	Level  Level // most verbose level shown
+	Source events.Source
+	Task   string // with Source, only entries of this task
+	Step   string // only entries of this step of the task
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Entry) bool {
+	if e.Level > f.Level {
+		return false
+	}
+	if f.Task != "" && (e.Source != f.Source || e.Task != f.Task) {
+		return false
+	}
+	return f.Step == "" || e.Step == f.Step
+}
+
+// String describes the filter for the pane title
+func (f Filter) String() string {
+	parts := []string{"level " + f.Level.String()}
+	if f.Task != "" {
+		parts = append(parts, fmt.Sprintf("%s %s", f.Source, f.Task))
+	}
+	if f.Step != "" {
+		parts = append(parts, "step "+f.Step)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// highlight escapes text for tview and marks every case-insensitive
+// occurrence of search, reporting whether there was one
+func highlight(text, search string) (string, bool) {
+	if search == "" {
+		return tview.Escape(text), false
+	}
+	lower, needle := strings.ToLower(text), strings.ToLower(search)
+	var b strings.Builder
+	found := false
+	for {
+		i := strings.Index(lower, needle)
+		if i < 0 {
+			break
+		}
+		found = true
+		b.WriteString(tview.Escape(text[:i]))
+		b.WriteString("[black:yellow]" + tview.Escape(text[i:i+len(needle)]) + "[-:-]")
+		text, lower = text[i+len(needle):], lower[i+len(needle):]
+	}
+	b.WriteString(tview.Escape(text))
+	return b.String(), found
+}
+
+// LogPane shows the entries of a ring that pass a filter, appending new ones
+// as they arrive instead of redrawing everything. Its methods must be called
+// on the tview event goroutine.
+type LogPane struct {
+	View *tview.TextView
+
+	ring    *Ring
+	filter  Filter
+	search  string
+	paused  bool
+	held    int // entries that arrived while paused
+	matches int // lines matching the search in the view
+	match   int // the highlighted match, -1 for none
+}
+
+// NewLogPane returns a pane keeping up to scrollback entries, showing info and above
+func NewLogPane(scrollback int) *LogPane {
+	p := &LogPane{
+		View:   tview.NewTextView().SetDynamicColors(true).SetRegions(true).SetScrollable(true),
+		ring:   NewRing(scrollback),
+		filter: Filter{Level: LevelInfo},
+		match:  -1,
+	}
+	p.View.SetMaxLines(cap(p.ring.entries))
+	p.View.SetBorder(true)
+	p.updateTitle()
+	return p
+}
+
+// Append stores e and shows it unless it is filtered out or the pane is paused
+func (p *LogPane) Append(e Entry) {
+	e = p.ring.Add(e)
+	if p.paused {
+		p.held++
+		p.updateTitle()
+		return
+	}
+	if p.filter.Match(e) {
+		p.write(e)
+		p.View.ScrollToEnd()
+	}
+	p.updateTitle()
+}
+
+func (p *LogPane) write(e Entry) {
+	text, found := highlight(e.Line(), p.search)
+	if found {
+		text = fmt.Sprintf(`["m%d"]%s[""]`, p.matches, text)
+		p.matches++
+	}
+	fmt.Fprintf(p.View, "%s%s[-:-]\n", levelColors[e.Level], text)
+}
+
+// Rebuild redraws the view from the ring
+func (p *LogPane) Rebuild() {
+	p.View.Clear()
+	p.matches, p.match, p.held = 0, -1, 0
+	for _, e := range p.ring.Entries() {
+		if p.filter.Match(e) {
+			p.write(e)
+		}
+	}
+	if !p.paused {
+		p.View.ScrollToEnd()
+	}
+	p.updateTitle()
+}
+
+// Filter returns the current filter
+func (p *LogPane) Filter() Filter {
+	return p.filter
+}
+
+// SetFilter shows only the entries passing f
+func (p *LogPane) SetFilter(f Filter) {
+	p.filter = f
+	p.Rebuild()
+}
+
+// SetSearch highlights the occurrences of search, none when empty
+func (p *LogPane) SetSearch(search string) {
+	p.search = search
+	p.Rebuild()
+}
+
+// TogglePause stops following new entries, or catches up and follows again
+func (p *LogPane) TogglePause() {
+	p.paused = !p.paused
+	if !p.paused {
+		p.Rebuild()
+		return
+	}
+	p.updateTitle()
+}
+
+// NextMatch scrolls to the next line matching the search, pausing the pane
+// so it stays in view
+func (p *LogPane) NextMatch() {
+	if p.matches == 0 {
+		return
+	}
+	p.paused = true
+	p.match = (p.match + 1) % p.matches
+	p.View.Highlight(fmt.Sprintf("m%d", p.match))
+	p.View.ScrollToHighlight()
+	p.updateTitle()
+}
+
+// Export writes the entries currently passing the filter to path as plain text
+func (p *LogPane) Export(path string) error {
+	var b strings.Builder
+	for _, e := range p.ring.Entries() {
+		if p.filter.Match(e) {
+			b.WriteString(e.Line())
+			b.WriteByte('\n')
+		}
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func (p *LogPane) updateTitle() {
+	title := " Log: " + p.filter.String()
+	if p.search != "" {
+		title += fmt.Sprintf(", %q %d match(es)", p.search, p.matches)
+	}
+	if p.paused {
+		title += fmt.Sprintf(", paused (+%d)", p.held)
+	}
+	if dropped := p.ring.Dropped(); dropped > 0 {
+		title += fmt.Sprintf(", %d dropped", dropped)
+	}
+	p.View.SetTitle(tview.Escape(title) + " ")
+}
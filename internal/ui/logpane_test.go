@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"spi-go-core/internal/events"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingKeepsTheNewestEntries(t *testing.T) {
+	r := NewRing(3)
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		r.Add(Entry{Text: text})
+	}
+	entries := r.Entries()
+	if len(entries) != 3 || entries[0].Text != "c" || entries[2].Text != "e" || entries[2].Seq != 5 {
+		t.Errorf("Expected c, d, e numbered up to 5, got %+v", entries)
+	}
+	if r.Dropped() != 2 {
+		t.Errorf("Expected 2 dropped entries, got %d", r.Dropped())
+	}
+}
+
+func TestEntriesFromEventsAndLogLines(t *testing.T) {
+	failed := entryFromEvent(events.Event{Source: events.SourceJob, Task: "j1", Status: events.StatusFailed, Error: "exit status 1"})
+	output := entryFromEvent(events.Event{Source: events.SourceJob, Task: "j1", Status: events.StatusInfo, Stream: "stdout", Message: "hello"})
+	if failed.Level != LevelError || output.Level != LevelInfo || !strings.HasSuffix(output.Text, "stdout: hello") {
+		t.Errorf("Unexpected entries %+v and %+v", failed, output)
+	}
+
+	record := slog.NewRecord(time.Date(2024, 5, 1, 10, 11, 12, 0, time.Local), slog.LevelInfo, "Stored profile", 0)
+	record.AddAttrs(slog.String("component", "setup"), slog.Int("steps", 3))
+	logged := entryFromRecord(record)
+	if logged.Level != LevelProgress || logged.Text != "[setup] Stored profile steps=3" || logged.Time.Hour() != 10 {
+		t.Errorf("Unexpected log entry %+v", logged)
+	}
+	record = slog.NewRecord(time.Now(), slog.LevelDebug, "Reading public key", 0)
+	if logged := entryFromRecord(record); logged.Level != LevelDebug {
+		t.Errorf("Expected a debug entry, got %+v", logged)
+	}
+}
+
+func TestFilterByLevelTaskAndStep(t *testing.T) {
+	step := Entry{Level: LevelInfo, Source: events.SourceProfile, Task: "r1", Step: "install"}
+	other := Entry{Level: LevelInfo, Source: events.SourceJob, Task: "j1"}
+	debug := Entry{Level: LevelDebug}
+
+	filter := Filter{Level: LevelInfo}
+	if !filter.Match(step) || !filter.Match(other) || filter.Match(debug) {
+		t.Error("A level filter should only hide more verbose entries")
+	}
+	filter = Filter{Level: LevelDebug, Source: events.SourceProfile, Task: "r1", Step: "install"}
+	if !filter.Match(step) || filter.Match(other) || filter.Match(Entry{Source: events.SourceProfile, Task: "r1", Step: "start"}) {
+		t.Error("A step filter should only pass entries of that step")
+	}
+}
+
+func TestHighlightEscapesAndMarksMatches(t *testing.T) {
+	text, found := highlight("Install nginx and NGINX-extras [red]", "nginx")
+	if !found || strings.Count(text, "[black:yellow]") != 2 || !strings.Contains(text, "[black:yellow]NGINX[-:-]") || !strings.HasSuffix(text, "[red[]") {
+		t.Errorf("Unexpected highlight %q", text)
+	}
+	if _, found := highlight("apt-get", "yum"); found {
+		t.Error("Expected no match")
+	}
+}
+
+func TestLogPaneSearchPauseAndExport(t *testing.T) {
+	p := NewLogPane(10)
+	now := time.Now()
+	p.Append(Entry{Time: now, Level: LevelInfo, Text: "starting nginx"})
+	p.Append(Entry{Time: now, Level: LevelDebug, Text: "nginx pid 42"})
+	p.Append(Entry{Time: now, Level: LevelError, Text: "redis failed"})
+
+	p.SetSearch("nginx")
+	if p.matches != 1 {
+		t.Errorf("Expected 1 visible match at level info, got %d", p.matches)
+	}
+	p.SetFilter(Filter{Level: LevelDebug})
+	if p.matches != 2 {
+		t.Errorf("Expected 2 visible matches at level debug, got %d", p.matches)
+	}
+
+	p.TogglePause()
+	p.Append(Entry{Time: now, Level: LevelInfo, Text: "nginx reloaded"})
+	if p.held != 1 || p.matches != 2 {
+		t.Errorf("A paused pane should hold new entries, held %d with %d matches", p.held, p.matches)
+	}
+	p.TogglePause()
+	if p.held != 0 || p.matches != 3 {
+		t.Errorf("Following again should catch up, held %d with %d matches", p.held, p.matches)
+	}
+
+	p.SetFilter(Filter{Level: LevelWarn})
+	path := filepath.Join(t.TempDir(), "export.txt")
+	if err := p.Export(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.HasSuffix(lines[0], "error redis failed") {
+		t.Errorf("Expected only the error in the export, got %q", data)
+	}
+}
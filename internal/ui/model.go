@@ -0,0 +1,175 @@
+package ui
+
+import (
+	"fmt"
+	"spi-go-core/internal/events"
+	"time"
+)
+
+// StepState is the last known state of one step of a task
+type StepState struct {
+	Name     string
+	Status   events.Status
+	Message  string
+	Error    string
+	Started  time.Time
+	Finished time.Time
+}
+
+// TaskState is the last known state of a task published on the event bus
+type TaskState struct {
+	Source   events.Source
+	ID       string
+	Title    string
+	Status   events.Status
+	Message  string
+	Error    string
+	Started  time.Time
+	Finished time.Time
+	Steps    []*StepState
+}
+
+// Elapsed returns how long the task ran, or has been running at now
+func (t *TaskState) Elapsed(now time.Time) time.Duration {
+	if !t.Finished.IsZero() {
+		return t.Finished.Sub(t.Started)
+	}
+	return now.Sub(t.Started)
+}
+
+// Name returns the title of the task, or its source and ID without one
+func (t *TaskState) Name() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	return fmt.Sprintf("%s %s", t.Source, t.ID)
+}
+
+// maxTasks bounds how many finished tasks the model remembers
+const maxTasks = 50
+
+// Model folds events into the state the UI shows. It is not safe for
+// concurrent use; the UI applies events from a single goroutine.
+type Model struct {
+	tasks     map[string]*TaskState
+	order     []string // task keys, oldest first
+	current   string
+	lastError *events.Event
+}
+
+// NewModel returns an empty model
+func NewModel() *Model {
+	return &Model{tasks: make(map[string]*TaskState)}
+}
+
+func taskKey(e events.Event) string {
+	return string(e.Source) + "/" + e.Task
+}
+
+// Apply updates the task and step e reports on
+func (m *Model) Apply(e events.Event) {
+	key := taskKey(e)
+	// A task failing without a reason keeps the step error that caused it
+	if e.Error != "" || e.Status == events.StatusFailed && (m.lastError == nil || taskKey(*m.lastError) != key) {
+		failed := e
+		m.lastError = &failed
+	}
+
+	task, exists := m.tasks[key]
+	if !exists {
+		task = &TaskState{Source: e.Source, ID: e.Task, Started: e.Time}
+		m.tasks[key] = task
+		m.order = append(m.order, key)
+		m.prune()
+	}
+	if e.Title != "" {
+		task.Title = e.Title
+	}
+
+	if e.Step == "" {
+		if e.Status != events.StatusInfo {
+			task.Status = e.Status
+		}
+		task.Message = e.Message
+		task.Error = e.Error
+		if task.Status.Done() {
+			task.Finished = e.Time
+		} else {
+			task.Finished = time.Time{}
+		}
+	} else {
+		if task.Status == "" {
+			task.Status = events.StatusRunning
+		}
+		m.applyStep(task, e)
+	}
+
+	// Whatever is running and changed last is what the user wants to see
+	if !task.Status.Done() || m.current == "" || m.current == key {
+		m.current = key
+	}
+}
+
+func (m *Model) applyStep(task *TaskState, e events.Event) {
+	var step *StepState
+	for _, candidate := range task.Steps {
+		if candidate.Name == e.Step {
+			step = candidate
+		}
+	}
+	if step == nil {
+		step = &StepState{Name: e.Step}
+		task.Steps = append(task.Steps, step)
+	}
+	if e.Status != events.StatusInfo {
+		if e.Status == events.StatusRunning && step.Status != events.StatusRunning {
+			step.Started = e.Time
+		}
+		step.Status = e.Status
+		if e.Status.Done() {
+			step.Finished = e.Time
+		}
+	}
+	step.Message = e.Message
+	step.Error = e.Error
+}
+
+// prune forgets the oldest finished tasks beyond maxTasks
+func (m *Model) prune() {
+	for i := 0; len(m.order) > maxTasks && i < len(m.order); {
+		key := m.order[i]
+		if m.tasks[key].Status.Done() && key != m.current {
+			delete(m.tasks, key)
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// Task returns the task source published as id, nil if unknown
+func (m *Model) Task(source events.Source, id string) *TaskState {
+	return m.tasks[string(source)+"/"+id]
+}
+
+// Current returns the task to show in detail, nil before the first event
+func (m *Model) Current() *TaskState {
+	return m.tasks[m.current]
+}
+
+// Tasks returns every remembered task, oldest first
+func (m *Model) Tasks() []*TaskState {
+	tasks := make([]*TaskState, 0, len(m.order))
+	for _, key := range m.order {
+		tasks = append(tasks, m.tasks[key])
+	}
+	return tasks
+}
+
+// LastError returns the most recent failure reported by any task
+func (m *Model) LastError() (events.Event, bool) {
+	if m.lastError == nil {
+		return events.Event{}, false
+	}
+	return *m.lastError, true
+}
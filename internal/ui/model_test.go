@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"spi-go-core/internal/events"
+	"testing"
+	"time"
+)
+
+func TestModelFollowsTheRunningTask(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	m := NewModel()
+	if m.Current() != nil {
+		t.Fatal("Expected no current task before the first event")
+	}
+
+	m.Apply(events.Event{Time: at(0), Source: events.SourceProfile, Task: "run-1", Title: "web", Status: events.StatusRunning})
+	m.Apply(events.Event{Time: at(1), Source: events.SourceProfile, Task: "run-1", Step: "install nginx", Status: events.StatusRunning})
+	m.Apply(events.Event{Time: at(4), Source: events.SourceProfile, Task: "run-1", Step: "install nginx", Status: events.StatusSucceeded, Message: "changed"})
+	m.Apply(events.Event{Time: at(4), Source: events.SourceProfile, Task: "run-1", Step: "start nginx", Status: events.StatusRunning})
+
+	task := m.Current()
+	if task == nil || task.Name() != "web" || task.Status != events.StatusRunning {
+		t.Fatalf("Expected the running profile as current, got %+v", task)
+	}
+	if elapsed := task.Elapsed(at(10)); elapsed != 10*time.Second {
+		t.Errorf("Expected 10s elapsed, got %s", elapsed)
+	}
+	if len(task.Steps) != 2 {
+		t.Fatalf("Expected 2 steps, got %d", len(task.Steps))
+	}
+	if step := task.Steps[0]; step.Status != events.StatusSucceeded || step.Finished.Sub(step.Started) != 3*time.Second {
+		t.Errorf("Unexpected first step %+v", step)
+	}
+
+	// A job failing meanwhile is the last error but does not take the view
+	// from the running profile
+	m.Apply(events.Event{Time: at(5), Source: events.SourceJob, Task: "job-1", Title: "install node", Status: events.StatusFailed, Error: "exit status 1"})
+	if m.Current().ID != "run-1" {
+		t.Errorf("A finished job should not replace the running task, current is %s", m.Current().ID)
+	}
+	failure, ok := m.LastError()
+	if !ok || failure.Task != "job-1" || failure.Error != "exit status 1" {
+		t.Errorf("Unexpected last error %+v", failure)
+	}
+
+	m.Apply(events.Event{Time: at(6), Source: events.SourceProfile, Task: "run-1", Step: "start nginx", Status: events.StatusFailed, Error: "unit not found"})
+	m.Apply(events.Event{Time: at(6), Source: events.SourceProfile, Task: "run-1", Status: events.StatusFailed})
+	task = m.Current()
+	if task.ID != "run-1" || task.Status != events.StatusFailed || task.Elapsed(at(60)) != 6*time.Second {
+		t.Errorf("Expected the finished run to stay current with a fixed elapsed time, got %+v", task)
+	}
+	if failure, _ := m.LastError(); failure.Step != "start nginx" {
+		t.Errorf("Expected the failed step as last error, got %+v", failure)
+	}
+	if len(m.Tasks()) != 2 {
+		t.Errorf("Expected 2 tasks, got %d", len(m.Tasks()))
+	}
+}
@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"spi-go-core/internal/profiles"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ShowPlan displays a profile plan as a table until the user presses q or Esc
+func ShowPlan(plan profiles.Plan) error {
+	app := tview.NewApplication()
+
+	table := tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+
+	for col, title := range []string{"", "Step", "Type", "Current", "Desired", "Would run"} {
+		table.SetCell(0, col, tview.NewTableCell(title).
+			SetTextColor(tcell.ColorYellow).
+			SetSelectable(false))
+	}
+
+	for i, step := range plan.Steps {
+		row := i + 1
+		marker, color := " ", tcell.ColorWhite
+		switch {
+		case step.Error != "":
+			marker, color = "!", tcell.ColorRed
+		case step.Skipped != "":
+			marker, color = "-", tcell.ColorGray
+		case step.Changes:
+			marker, color = "~", tcell.ColorGreen
+		}
+		commands := strings.Join(step.Commands, "; ")
+		if step.Error != "" {
+			commands = "check failed: " + step.Error
+		} else if step.Skipped != "" {
+			commands = "skipped: " + step.Skipped
+		}
+		for col, text := range []string{marker, step.Name, string(step.Type), step.Current, step.Desired, commands} {
+			table.SetCell(row, col, tview.NewTableCell(text).SetTextColor(color).SetMaxWidth(60))
+		}
+	}
+
+	frame := tview.NewFrame(table).
+		AddText(fmt.Sprintf("Plan for profile %s", plan.Profile), true, tview.AlignCenter, tcell.ColorWhite).
+		AddText(fmt.Sprintf("%d of %d steps would change the host, %d could not be checked", plan.Changes, len(plan.Steps), plan.Errors), true, tview.AlignLeft, tcell.ColorWhite).
+		AddText("[Press Q or Esc to close]", false, tview.AlignLeft, tcell.ColorWhite)
+	frame.SetBorder(true)
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Rune() == 'q' || event.Rune() == 'Q' {
+			app.Stop()
+			return nil
+		}
+		return event
+	})
+
+	return app.SetRoot(frame, true).Run()
+}
@@ -0,0 +1,184 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/output"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Renderer shows the progress published on the event bus until ctx is done
+type Renderer interface {
+	Run(ctx context.Context) error
+}
+
+// Renderer modes, as accepted by UI.renderer and --renderer
+const (
+	RendererAuto  = "auto"
+	RendererTUI   = "tui"
+	RendererPlain = "plain"
+	RendererJSON  = "json"
+)
+
+// Resolve turns auto (or no mode) into tui when out and stdin are terminals
+// and into plain otherwise, e.g. when piped to a file, in CI or under systemd
+func Resolve(mode string, out *os.File) string {
+	if mode != "" && mode != RendererAuto {
+		return mode
+	}
+	if term.IsTerminal(int(out.Fd())) && term.IsTerminal(int(os.Stdin.Fd())) && os.Getenv("TERM") != "dumb" {
+		return RendererTUI
+	}
+	return RendererPlain
+}
+
+// NewRenderer subscribes the renderer for mode to deps.Events right away.
+// Plain and JSON renderers write to out and leave the log output alone.
+func NewRenderer(mode string, cfg config.UI, deps Dependencies, out *os.File) (Renderer, error) {
+	switch Resolve(mode, out) {
+	case RendererTUI:
+		return New(cfg, deps)
+	case RendererPlain:
+		return NewPlain(deps.Events, out), nil
+	case RendererJSON:
+		return NewJSONLines(deps.Events, out), nil
+	default:
+		return nil, fmt.Errorf("unknown renderer %q (want %s)", mode, strings.Join(config.Renderers, ", "))
+	}
+}
+
+// consume passes each event of feed to handle until ctx is done, then the
+// events still waiting, so a finished run is reported in full. Only output
+// lines are lost when handle falls behind.
+func consume(ctx context.Context, feed *events.Feed, handle func(events.Event)) {
+	for {
+		select {
+		case <-feed.Ready():
+			for _, e := range feed.Take() {
+				handle(e)
+			}
+		case <-ctx.Done():
+			for _, e := range feed.Take() {
+				handle(e)
+			}
+			return
+		}
+	}
+}
+
+// Plain prints progress as lines of text: tasks as they start and finish,
+// each step with its position in the task, and the output the verbosity
+// shows indented below it
+type Plain struct {
+	out         io.Writer
+	model       *Model
+	feed        *events.Feed
+	unsubscribe func()
+}
+
+// NewPlain subscribes to bus and prints to out once run
+func NewPlain(bus *events.Bus, out io.Writer) *Plain {
+	feed, unsubscribe := bus.Feed(events.DefaultBuffer)
+	return &Plain{out: out, model: NewModel(), feed: feed, unsubscribe: unsubscribe}
+}
+
+// Run prints until ctx is done
+func (p *Plain) Run(ctx context.Context) error {
+	defer p.unsubscribe()
+	consume(ctx, p.feed, p.print)
+	return nil
+}
+
+func (p *Plain) print(e events.Event) {
+	p.model.Apply(e)
+	task := p.model.Task(e.Source, e.Task)
+	stamp := e.Time.Format("15:04:05")
+
+	switch {
+	case e.Stream != "":
+		if !output.Shows(e.Level) {
+			return
+		}
+		marker := "|"
+		if e.Stream == "stderr" {
+			marker = "!"
+		}
+		fmt.Fprintf(p.out, "%s     %s %s\n", stamp, marker, e.Message)
+
+	case e.Step != "":
+		// Pending steps are counted, not printed
+		if e.Status == events.StatusPending {
+			return
+		}
+		position, duration := "", ""
+		if task != nil {
+			for i, step := range task.Steps {
+				if step.Name != e.Step {
+					continue
+				}
+				position = fmt.Sprintf("[%d/%d] ", i+1, len(task.Steps))
+				if e.Status.Done() && !step.Started.IsZero() {
+					duration = fmt.Sprintf(" (%s)", step.Finished.Sub(step.Started).Round(time.Millisecond))
+				}
+			}
+		}
+		fmt.Fprintf(p.out, "%s   %s%s: %s", stamp, position, e.Step, e.Status)
+		p.details(e)
+		fmt.Fprintln(p.out, duration)
+
+	default:
+		name := fmt.Sprintf("%s %s", e.Source, e.Task)
+		if task != nil {
+			name = task.Name()
+		}
+		fmt.Fprintf(p.out, "%s %s: %s", stamp, name, e.Status)
+		p.details(e)
+		if e.Status.Done() && task != nil {
+			fmt.Fprintf(p.out, " after %s", task.Elapsed(e.Time).Round(time.Millisecond))
+		}
+		fmt.Fprintln(p.out)
+	}
+}
+
+// details appends the message and error of e to the current line
+func (p *Plain) details(e events.Event) {
+	if e.Message != "" {
+		fmt.Fprintf(p.out, " %s", e.Message)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(p.out, " (error: %s)", e.Error)
+	}
+}
+
+// JSONLines writes every event as one line of JSON, for tooling
+type JSONLines struct {
+	encoder     *json.Encoder
+	feed        *events.Feed
+	unsubscribe func()
+}
+
+// NewJSONLines subscribes to bus and writes to out once run
+func NewJSONLines(bus *events.Bus, out io.Writer) *JSONLines {
+	feed, unsubscribe := bus.Feed(events.DefaultBuffer)
+	return &JSONLines{encoder: json.NewEncoder(out), feed: feed, unsubscribe: unsubscribe}
+}
+
+// Run writes until ctx is done
+func (j *JSONLines) Run(ctx context.Context) error {
+	defer j.unsubscribe()
+	var err error
+	consume(ctx, j.feed, func(e events.Event) {
+		if err == nil {
+			err = j.encoder.Encode(e)
+		}
+	})
+	return err
+}
@@ -0,0 +1,116 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/output"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveWithoutTerminal(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if mode := Resolve(RendererAuto, out); mode != RendererPlain {
+		t.Errorf("Expected plain output to a file, got %s", mode)
+	}
+	if mode := Resolve(RendererJSON, out); mode != RendererJSON {
+		t.Errorf("An explicit renderer should be kept, got %s", mode)
+	}
+}
+
+// publishRun publishes a profile run of two steps, the second failing
+func publishRun(bus *events.Bus) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, e := range []events.Event{
+		{Status: events.StatusRunning, Title: "profile web"},
+		{Step: "install", Status: events.StatusPending},
+		{Step: "start", Status: events.StatusPending},
+		{Step: "install", Status: events.StatusRunning},
+		{Step: "install", Status: events.StatusInfo, Stream: "stdout", Message: "Setting up nginx", Level: output.LevelProgress},
+		{Step: "install", Status: events.StatusInfo, Stream: "stdout", Message: "Reading state information...", Level: output.LevelInfo},
+		{Step: "install", Status: events.StatusSucceeded, Message: "changed"},
+		{Step: "start", Status: events.StatusRunning},
+		{Step: "start", Status: events.StatusFailed, Error: "exit status 1"},
+		{Status: events.StatusFailed},
+	} {
+		e.Source, e.Task, e.Time = events.SourceProfile, "r1", start.Add(time.Duration(i)*time.Second)
+		bus.Publish(e)
+	}
+}
+
+func TestPlainCountsStepsAndAppliesTheVerbosity(t *testing.T) {
+	bus := events.New()
+	var out bytes.Buffer
+	plain := NewPlain(bus, &out)
+	publishRun(bus)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	plain.Run(ctx)
+
+	want := []string{
+		"10:00:00 profile web: running",
+		"10:00:03   [1/2] install: running",
+		"10:00:04     | Setting up nginx",
+		"10:00:06   [1/2] install: succeeded changed (3s)",
+		"10:00:07   [2/2] start: running",
+		"10:00:08   [2/2] start: failed (error: exit status 1) (1s)",
+		"10:00:09 profile web: failed after 9s",
+	}
+	if got := strings.Split(strings.TrimSpace(out.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+func TestJSONLinesWritesEveryEvent(t *testing.T) {
+	bus := events.New()
+	var out bytes.Buffer
+	stream := NewJSONLines(bus, &out)
+	publishRun(bus)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := stream.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("Expected every one of 10 events, got %d", len(lines))
+	}
+	var hidden, failed events.Event
+	json.Unmarshal([]byte(lines[5]), &hidden)
+	if err := json.Unmarshal([]byte(lines[8]), &failed); err != nil || failed.Step != "start" || failed.Error != "exit status 1" || hidden.Level != output.LevelInfo {
+		t.Errorf("Unexpected events %s and %s (%v)", lines[5], lines[8], err)
+	}
+}
+
+func TestJSONLinesKeepsStatusEventsWhenOutputFloods(t *testing.T) {
+	bus := events.New()
+	var out bytes.Buffer
+	stream := NewJSONLines(bus, &out)
+	bus.Publish(events.Event{Source: events.SourceJob, Task: "j1", Status: events.StatusRunning})
+	for i := 0; i < 2*events.DefaultBuffer; i++ {
+		bus.Publish(events.Event{Source: events.SourceJob, Task: "j1", Status: events.StatusInfo, Stream: "stdout", Message: "line"})
+	}
+	bus.Publish(events.Event{Source: events.SourceJob, Task: "j1", Status: events.StatusSucceeded})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := stream.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var last events.Event
+	json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+	if len(lines) != events.DefaultBuffer+2 || last.Status != events.StatusSucceeded {
+		t.Errorf("Expected the output lines the buffer holds between both status events, got %d lines ending in %+v", len(lines), last)
+	}
+}
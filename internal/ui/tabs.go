@@ -0,0 +1,339 @@
+package ui
+
+import (
+	"fmt"
+	"spi-go-core/internal/audit"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/jobs"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// tab is one view of the dashboard
+type tab struct {
+	name    string
+	root    tview.Primitive
+	focus   tview.Primitive
+	keys    []binding
+	refresh func(now time.Time) // called when the tab is shown and every second while it is
+}
+
+// newTable returns a selectable table with a fixed header row
+func newTable(title string, headers ...string) *tview.Table {
+	table := tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	table.SetBorder(true).SetTitle(" " + title + " ")
+	for i, header := range headers {
+		table.SetCell(0, i, tview.NewTableCell(header).SetAttributes(tcell.AttrBold).SetSelectable(false))
+	}
+	return table
+}
+
+// setRow fills row of table with values
+func setRow(table *tview.Table, row int, color tcell.Color, values ...string) {
+	for i, value := range values {
+		table.SetCell(row, i, tview.NewTableCell(tview.Escape(value)).SetTextColor(color))
+	}
+}
+
+// truncateRows drops the rows after the first n data rows
+func truncateRows(table *tview.Table, n int) {
+	for table.GetRowCount() > n+1 {
+		table.RemoveRow(table.GetRowCount() - 1)
+	}
+}
+
+// selectedRow returns the index of the selected data row, -1 for none
+func selectedRow(table *tview.Table, rows int) int {
+	row, _ := table.GetSelection()
+	if row < 1 || row > rows {
+		return -1
+	}
+	return row - 1
+}
+
+// sessionsTab lists the sessions of the encryption store and revokes them
+type sessionsTab struct {
+	table    *tview.Table
+	store    *encryption.SessionStore
+	audit    *audit.Log
+	sessions []encryption.Session
+}
+
+func newSessionsTab(store *encryption.SessionStore, auditLog *audit.Log) (*sessionsTab, tab) {
+	t := &sessionsTab{store: store, audit: auditLog, table: newTable("Active sessions", "Session", "Client", "State", "Started", "Expires in", "Client key")}
+	return t, tab{
+		name:    "Sessions",
+		root:    t.table,
+		focus:   t.table,
+		keys:    []binding{runeKey('r', "revoke the selected session", t.revoke)},
+		refresh: t.refresh,
+	}
+}
+
+func (t *sessionsTab) refresh(now time.Time) {
+	t.sessions = t.store.List()
+	for i, session := range t.sessions {
+		state, color := "handshake", tcell.ColorYellow
+		if session.Validated {
+			state, color = "validated", tcell.ColorGreen
+		}
+		fingerprint := session.KeyFingerprint
+		if len(fingerprint) > 16 {
+			fingerprint = fingerprint[:16] + "..."
+		}
+		setRow(t.table, i+1, color, session.ID, session.Client, state, session.Started.Format("15:04:05"),
+			session.Expires.Sub(now).Round(time.Second).String(), fingerprint)
+	}
+	truncateRows(t.table, len(t.sessions))
+}
+
+// revoke ends the selected session; its next request is rejected
+func (t *sessionsTab) revoke() {
+	i := selectedRow(t.table, len(t.sessions))
+	if i < 0 {
+		return
+	}
+	session := t.sessions[i]
+	if t.store.Revoke(session.ID) {
+		uiLog.Info("Revoked session from the console", "session", session.ID, "client", session.Client)
+		t.audit.Record(audit.Event{Action: "session.revoke", Session: session.ID, Detail: "from the console, client " + session.Client})
+	}
+	t.refresh(time.Now())
+}
+
+// jobsTab lists the jobs, cancels them and tails the output of one
+type jobsTab struct {
+	jobs    *jobs.Manager
+	audit   *audit.Log
+	table   *tview.Table
+	output  *tview.TextView
+	infos   []jobs.Info
+	tailing string // ID of the job whose output is shown
+	tailed  int    // lines of it shown so far
+}
+
+func newJobsTab(manager *jobs.Manager, auditLog *audit.Log) (*jobsTab, tab) {
+	t := &jobsTab{
+		jobs:   manager,
+		audit:  auditLog,
+		table:  newTable("Jobs", "Job", "Command", "Status", "Started", "Duration", "Lines"),
+		output: tview.NewTextView().SetScrollable(true),
+	}
+	t.output.SetBorder(true).SetTitle(" Output (Enter on a job to tail it) ")
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.table, 0, 1, true).
+		AddItem(t.output, 0, 1, false)
+	return t, tab{
+		name:  "Jobs",
+		root:  layout,
+		focus: t.table,
+		keys: []binding{
+			specialKey(tcell.KeyEnter, "Enter", "tail the output of the selected job", t.tail),
+			runeKey('c', "cancel the selected job", t.cancel),
+		},
+		refresh: t.refresh,
+	}
+}
+
+func (t *jobsTab) refresh(now time.Time) {
+	t.infos = t.jobs.List()
+	for i, info := range t.infos {
+		color := tcell.ColorWhite
+		switch info.Status {
+		case jobs.StatusRunning:
+			color = tcell.ColorYellow
+		case jobs.StatusAwaitingApproval:
+			color = tcell.ColorBlue
+		case jobs.StatusSucceeded:
+			color = tcell.ColorGreen
+		case jobs.StatusFailed, jobs.StatusCanceled:
+			color = tcell.ColorRed
+		}
+		finished := now
+		if info.FinishedAt != nil {
+			finished = *info.FinishedAt
+		}
+		setRow(t.table, i+1, color, info.ID, info.Command, string(info.Status), info.StartedAt.Format("15:04:05"),
+			finished.Sub(info.StartedAt).Round(time.Second).String(), fmt.Sprint(info.Lines))
+	}
+	truncateRows(t.table, len(t.infos))
+
+	// Append what the tailed job printed since the last refresh
+	if t.tailing == "" {
+		return
+	}
+	job, err := t.jobs.Get(t.tailing)
+	if err != nil {
+		return
+	}
+	lines, _, _ := job.Lines(t.tailed)
+	for _, line := range lines {
+		prefix := ""
+		if line.Stream == "stderr" {
+			prefix = "! "
+		}
+		fmt.Fprintln(t.output, prefix+line.Text)
+	}
+	if len(lines) > 0 {
+		t.tailed = lines[len(lines)-1].Seq + 1
+		t.output.ScrollToEnd()
+	}
+}
+
+// tail shows the output of the selected job, following it while it runs
+func (t *jobsTab) tail() {
+	i := selectedRow(t.table, len(t.infos))
+	if i < 0 {
+		return
+	}
+	t.tailing, t.tailed = t.infos[i].ID, 0
+	t.output.Clear()
+	t.output.SetTitle(" Output of " + t.infos[i].Command + " ")
+	t.refresh(time.Now())
+}
+
+// cancel stops the selected job
+func (t *jobsTab) cancel() {
+	i := selectedRow(t.table, len(t.infos))
+	if i < 0 {
+		return
+	}
+	job, err := t.jobs.Get(t.infos[i].ID)
+	if err != nil {
+		return
+	}
+	job.Cancel()
+	uiLog.Info("Canceled job from the console", "job", job.ID())
+	t.audit.Record(audit.Event{Action: "job.cancel", Detail: job.ID() + " from the console"})
+	t.refresh(time.Now())
+}
+
+// factsTab shows the host facts, collected when the tab is opened
+type factsTab struct {
+	collector *facts.Collector
+	text      *tview.TextView
+}
+
+func newFactsTab(collector *facts.Collector) (*factsTab, tab) {
+	t := &factsTab{collector: collector, text: tview.NewTextView().SetDynamicColors(true).SetScrollable(true)}
+	t.text.SetBorder(true).SetTitle(" Host facts ")
+	return t, tab{
+		name:  "Facts",
+		root:  t.text,
+		focus: t.text,
+		keys:  []binding{runeKey('r', "collect the facts again", t.collect)},
+		refresh: func(time.Time) {
+			if t.text.GetText(false) == "" {
+				t.collect()
+			}
+		},
+	}
+}
+
+func (t *factsTab) collect() {
+	t.text.Clear()
+	hostFacts, err := t.collector.Collect()
+	if err != nil {
+		fmt.Fprintf(t.text, "[red]Failed to collect facts: %s[-]\n", tview.Escape(err.Error()))
+		return
+	}
+	rows := [][2]string{
+		{"os", strings.TrimSpace(fmt.Sprintf("%s %s %s", hostFacts.OS.ID, hostFacts.OS.VersionID, hostFacts.OS.Codename))},
+		{"os.family", strings.Join(hostFacts.OS.Families(), ", ")},
+		{"kernel", hostFacts.Kernel},
+		{"arch", fmt.Sprintf("%s (%s)", hostFacts.Arch, hostFacts.Machine)},
+		{"init", hostFacts.Init},
+		{"container", hostFacts.Container},
+		{"virtualization", hostFacts.Virtualization},
+		{"cpus", fmt.Sprint(hostFacts.CPUs)},
+		{"memory", formatBytes(hostFacts.MemoryBytes)},
+		{"disk", fmt.Sprintf("%s free of %s on %s", formatBytes(hostFacts.Disk.FreeBytes), formatBytes(hostFacts.Disk.TotalBytes), hostFacts.Disk.Path)},
+		{"package managers", strings.Join(hostFacts.PackageManagers, ", ")},
+	}
+	for _, row := range rows {
+		value := row[1]
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(t.text, "[::b]%-17s[::-] %s\n", row[0], tview.Escape(value))
+	}
+	fmt.Fprintf(t.text, "\n[gray]collected at %s[-]\n", time.Now().Format("15:04:05"))
+}
+
+// formatBytes renders n in binary units
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// configTab shows the effective configuration with the allowlist first
+type configTab struct {
+	store *config.Store
+	text  *tview.TextView
+}
+
+func newConfigTab(store *config.Store) (*configTab, tab) {
+	t := &configTab{store: store, text: tview.NewTextView().SetDynamicColors(true).SetScrollable(true)}
+	t.text.SetBorder(true).SetTitle(" Effective configuration ")
+	return t, tab{
+		name:  "Config",
+		root:  t.text,
+		focus: t.text,
+		keys:  []binding{runeKey('r', "show the running configuration again", t.show)},
+		refresh: func(time.Time) {
+			if t.text.GetText(false) == "" {
+				t.show()
+			}
+		},
+	}
+}
+
+// show renders the running configuration; reloads call it too
+func (t *configTab) show() {
+	t.text.Clear()
+	cfg := t.store.Current()
+	status := t.store.Status()
+
+	exec := "[green]enabled[-]"
+	if !cfg.Commands.ExecEnabled() {
+		exec = "[red]disabled[-]"
+	}
+	fmt.Fprintf(t.text, "[::b]Command execution[::-] %s\n", exec)
+	fmt.Fprintf(t.text, "[::b]Allowlist[::-]         %s\n", tview.Escape(listOrNone(cfg.Commands.Allowed)))
+	fmt.Fprintf(t.text, "[::b]Needs approval[::-]    commands %s, steps %s\n",
+		tview.Escape(listOrNone(cfg.Approval.Commands)), tview.Escape(listOrNone(cfg.Approval.Steps)))
+	fmt.Fprintf(t.text, "[::b]Generation[::-]        %d, loaded %s from %s\n", status.Generation,
+		status.LoadedAt.Format("15:04:05"), tview.Escape(listOrNone(status.Files)))
+	if status.LastError != "" {
+		fmt.Fprintf(t.text, "[red]Last reload (%s) failed: %s[-]\n", tview.Escape(status.LastTrigger), tview.Escape(status.LastError))
+	}
+	fmt.Fprintln(t.text)
+
+	for _, setting := range t.store.Effective() {
+		value := fmt.Sprint(setting.Value)
+		if setting.Value == nil {
+			value = "unset"
+		}
+		fmt.Fprintf(t.text, "%-32s %s [gray]# %s[-]\n", setting.Key, tview.Escape(value), tview.Escape(setting.Source))
+	}
+}
+
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
@@ -1,158 +1,559 @@
 package ui
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/audit"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/events"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/output"
 	"strings"
-	"sync"
-
-	"io"
+	"syscall"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-// UI state to manage the visibility of debug messages
-var showDebug = false
-var mutex = &sync.Mutex{}
-
-// StartUI starts the terminal-based UI
-func StartUI() {
-	// Create application
-	app := tview.NewApplication()
-
-	// Create the main frame to show context metadata and progress
-	frame := tview.NewFrame(tview.NewBox().SetBorder(true)).
-		AddText("Server Profile Installer", true, tview.AlignCenter, tcell.ColorWhite).
-		AddText("Task: Initializing Environment", false, tview.AlignLeft, tcell.ColorWhite).
-		AddText("Status: Waiting for input...", false, tview.AlignLeft, tcell.ColorWhite).
-		AddText("[Press Y to Confirm, N to Cancel, D to Toggle Debug]", false, tview.AlignLeft, tcell.ColorWhite)
-
-	// Create the text view to display subprocess output
-	outputView := tview.NewTextView().
-		SetDynamicColors(true).
-		SetScrollable(true).
-		SetChangedFunc(func() {
-			app.Draw()
-		})
-
-	// Store output in a buffer for toggling debug visibility
-	var outputBuffer []string
-
-	// Create a flex layout to arrange the frame and output view
-	flex := tview.NewFlex().
-		SetDirection(tview.FlexRow).
-		AddItem(frame, 10, 1, false).
-		AddItem(outputView, 0, 1, true)
-
-	// Define keybindings for confirmation and toggling debug visibility
-	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Rune() {
-		case 'y', 'Y':
-			fmt.Fprintln(outputView, "[green]Confirmation received: Proceeding...")
-			go executeSubprocess(outputView, &outputBuffer)
-		case 'n', 'N':
-			fmt.Fprintln(outputView, "[red]Process canceled.")
-		case 'd', 'D':
-			// Toggle debug visibility
-			mutex.Lock()
-			showDebug = !showDebug
-			mutex.Unlock()
-			updateDisplay(outputView, outputBuffer)
+// uiLog is the log of the ui component
+var uiLog = logging.For(logging.UI)
+
+// statusColors maps a status to its tview color tag
+var statusColors = map[events.Status]string{
+	events.StatusPending:   "[white]",
+	events.StatusRunning:   "[yellow]",
+	events.StatusSucceeded: "[green]",
+	events.StatusFailed:    "[red]",
+	events.StatusSkipped:   "[gray]",
+	events.StatusInfo:      "[white]",
+}
+
+// Dependencies are the services the dashboard shows. Events is required;
+// the view of every other nil service is left out.
+type Dependencies struct {
+	Events    *events.Bus
+	Approvals *approval.Gate // the UI is its operator console while it runs
+	Jobs      *jobs.Manager
+	Sessions  *encryption.SessionStore
+	Facts     *facts.Collector
+	Config    *config.Store
+	Audit     *audit.Log // records revocations and cancellations made at the console
+}
+
+// UI is the terminal dashboard. Create it with New and show it with Run.
+type UI struct {
+	deps         Dependencies
+	subscription <-chan events.Event
+	unsubscribe  func()
+	logFile      *logging.File
+	scrollback   int
+}
+
+// New subscribes to the event bus right away, so no event published after
+// New returns is missed, and opens cfg.LogFile, which receives the log output
+// and every event while the UI owns the terminal
+func New(cfg config.UI, deps Dependencies) (*UI, error) {
+	logPath := cfg.LogFile
+	if logPath == "" {
+		logPath = "logs/subprocess.log"
+	}
+	logFile, err := logging.OpenFile(logPath, logging.CurrentRotation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UI log: %v", err)
+	}
+	subscription, unsubscribe := deps.Events.Subscribe(events.DefaultBuffer)
+	return &UI{deps: deps, subscription: subscription, unsubscribe: unsubscribe, logFile: logFile, scrollback: cfg.Scrollback}, nil
+}
+
+// Run shows what the server, jobs, profile runs and the app publish until
+// ctx is done or the user presses Q. The server keeps running either way;
+// Ctrl-C shuts it down as it would without the UI. Run can be called once.
+func (u *UI) Run(ctx context.Context) error {
+	defer u.logFile.Close()
+	defer u.unsubscribe()
+	logFile, subscription := u.logFile, u.subscription
+
+	v := newView(u.deps, u.scrollback)
+	v.exportDir = filepath.Dir(logFile.Name())
+
+	// Log lines meant for stderr go to the log file and, without blocking the logger, to the pane
+	logEntries := make(chan Entry, events.DefaultBuffer)
+	restore := logging.Redirect(newPaneHandler(logFile, logEntries))
+	defer restore()
+
+	// Requests needing approval wait for this console while it is open
+	if u.deps.Approvals != nil {
+		detach := u.deps.Approvals.Attach()
+		defer detach()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				v.app.Stop()
+				return
+			case <-done:
+				return
+			case e, ok := <-subscription:
+				if !ok {
+					return
+				}
+				writeEvent(logFile, e)
+				v.app.QueueUpdateDraw(func() {
+					v.model.Apply(e)
+					v.pane.Append(entryFromEvent(e))
+					if e.Source == events.SourceConfig && v.config != nil {
+						v.config.show()
+					}
+					v.render(time.Now())
+				})
+			case entry := <-logEntries:
+				v.app.QueueUpdateDraw(func() { v.pane.Append(entry) })
+			case now := <-ticker.C:
+				// Keep the elapsed time and the lists of the open tab moving
+				v.app.QueueUpdateDraw(func() {
+					v.render(now)
+					v.tabs[v.active].refresh(now)
+				})
+			}
 		}
-		return event
-	})
+	}()
+
+	v.render(time.Now())
+	return v.app.Run()
+}
+
+// paneHandler writes log records to the UI log and passes them on to the
+// pane as entries, dropping those nobody is ready for
+type paneHandler struct {
+	file    slog.Handler
+	entries chan<- Entry
+}
+
+func newPaneHandler(w io.Writer, entries chan<- Entry) *paneHandler {
+	return &paneHandler{file: slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}), entries: entries}
+}
+
+func (h *paneHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
 
-	// Set the UI in motion
-	if err := app.SetRoot(flex, true).Run(); err != nil {
-		log.Fatalf("Failed to run UI: %v", err)
+func (h *paneHandler) Handle(ctx context.Context, r slog.Record) error {
+	select {
+	case h.entries <- entryFromRecord(r):
+	default:
 	}
+	return h.file.Handle(ctx, r)
 }
 
-// executeSubprocess runs a subprocess and logs every line of output to both a file and optionally the UI
-func executeSubprocess(outputView *tview.TextView, outputBuffer *[]string) {
-	// Open or create a log file for subprocess output
-	logFile, err := os.OpenFile("logs/subprocess.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintln(outputView, "[red]Error: Failed to open log file")
-		return
+func (h *paneHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &paneHandler{file: h.file.WithAttrs(attrs), entries: h.entries}
+}
+
+func (h *paneHandler) WithGroup(name string) slog.Handler {
+	return &paneHandler{file: h.file.WithGroup(name), entries: h.entries}
+}
+
+// view holds the widgets and the state they show. Everything but app is only
+// touched on the tview event goroutine.
+type view struct {
+	app       *tview.Application
+	pages     *tview.Pages
+	tabBar    *tview.TextView
+	tabs      []tab
+	active    int
+	keys      []binding // work on every tab
+	helpOpen  bool
+	approvals *approval.Gate
+	approval  *tview.TextView
+
+	// the overview tab
+	overview  *tview.Flex
+	header    *tview.TextView
+	steps     *tview.TextView
+	tasks     *tview.TextView
+	pane      *LogPane
+	search    *tview.InputField
+	model     *Model
+	exportDir string
+
+	config *configTab // refreshed on reloads
+}
+
+func newView(deps Dependencies, scrollback int) *view {
+	v := &view{
+		app:       tview.NewApplication(),
+		pages:     tview.NewPages(),
+		tabBar:    tview.NewTextView().SetDynamicColors(true).SetRegions(true),
+		approvals: deps.Approvals,
+		approval:  tview.NewTextView().SetDynamicColors(true),
+		header:    tview.NewTextView().SetDynamicColors(true),
+		steps:     tview.NewTextView().SetDynamicColors(true),
+		tasks:     tview.NewTextView().SetDynamicColors(true),
+		pane:      NewLogPane(scrollback),
+		search:    tview.NewInputField().SetLabel("/"),
+		model:     NewModel(),
 	}
-	defer logFile.Close()
+	// The log starts out showing what logging.verbosity shows everywhere else
+	v.pane.SetFilter(Filter{Level: levelOf(output.MaxShown())})
+	v.header.SetBorder(true).SetTitle(" Server Profile Installer ")
+	v.steps.SetBorder(true).SetTitle(" Steps ")
+	v.tasks.SetBorder(true).SetTitle(" Tasks ")
+	v.approval.SetBorder(true).SetTitle(" Approval ")
+	v.search.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			v.pane.SetSearch(v.search.GetText())
+		}
+		v.overview.ResizeItem(v.search, 0, 0)
+		v.app.SetFocus(v.pane.View)
+	})
 
-	// Example subprocess (install Node.js)
-	cmd := exec.Command("bash", "-c", "curl -fsSL https://deb.nodesource.com/setup_16.x | bash - && apt-get install -y nodejs")
+	middle := tview.NewFlex().
+		AddItem(v.steps, 0, 2, false).
+		AddItem(v.tasks, 0, 1, false)
+	v.overview = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.header, 5, 0, false).
+		AddItem(middle, 0, 1, false).
+		AddItem(v.pane.View, 0, 1, true).
+		AddItem(v.search, 0, 0, false)
+	v.tabs = append(v.tabs, tab{
+		name:  "Overview",
+		root:  v.overview,
+		focus: v.pane.View,
+		keys: []binding{
+			runeKey('/', "search the log", v.openSearch),
+			specialKey(tcell.KeyCtrlN, "Ctrl-N", "jump to the next match and pause the log", v.pane.NextMatch),
+			runeKey('l', "cycle the most verbose log level shown", v.cycleLevel),
+			runeKey('t', "show the log of the current task only, or everything", v.filterTask),
+			runeKey('s', "cycle through the steps of that task", v.filterStep),
+			runeKey('p', "pause or follow the log", v.pane.TogglePause),
+			runeKey('e', "export the log as filtered next to the UI log file", v.export),
+		},
+		refresh: func(time.Time) {},
+	})
+	if deps.Jobs != nil {
+		_, jobsTab := newJobsTab(deps.Jobs, deps.Audit)
+		v.tabs = append(v.tabs, jobsTab)
+	}
+	if deps.Sessions != nil {
+		_, sessionsTab := newSessionsTab(deps.Sessions, deps.Audit)
+		v.tabs = append(v.tabs, sessionsTab)
+	}
+	if deps.Facts != nil {
+		_, factsTab := newFactsTab(deps.Facts)
+		v.tabs = append(v.tabs, factsTab)
+	}
+	if deps.Config != nil {
+		var configTab tab
+		v.config, configTab = newConfigTab(deps.Config)
+		v.tabs = append(v.tabs, configTab)
+	}
 
-	// Capture both stdout and stderr for logging
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		fmt.Fprintln(outputView, "[red]Error: Failed to get stdout pipe")
-		return
+	v.keys = []binding{
+		specialKey(tcell.KeyTab, "Tab", "show the next view", func() { v.showTab((v.active + 1) % len(v.tabs)) }),
+		runeKey('?', "show or hide this help", v.toggleHelp),
+		runeKey('q', "close the UI and leave the server running", v.app.Stop),
+		specialKey(tcell.KeyCtrlC, "Ctrl-C", "shut the server down", v.interrupt),
+	}
+	for i := range v.tabs {
+		i := i
+		v.keys = append(v.keys, runeKey(rune('1'+i), "show "+v.tabs[i].name, func() { v.showTab(i) }))
+		v.pages.AddPage(v.tabs[i].name, v.tabs[i].root, true, i == 0)
+	}
+	if deps.Approvals != nil {
+		v.keys = append(v.keys,
+			runeKey('y', "approve the request in the Approval pane", func() { v.decide(true) }),
+			runeKey('n', "deny the request in the Approval pane", func() { v.decide(false) }))
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		fmt.Fprintln(outputView, "[red]Error: Failed to get stderr pipe")
-		return
+	sections := []helpSection{{title: "Everywhere", bindings: v.keys}}
+	for _, t := range v.tabs {
+		sections = append(sections, helpSection{title: t.name, bindings: t.keys})
+	}
+	help := tview.NewTextView().SetDynamicColors(true).SetScrollable(true).SetText(helpText(sections))
+	help.SetBorder(true).SetTitle(" Keys (Esc closes) ")
+	v.pages.AddPage("help", centered(help, 72, 30), true, false)
+
+	hint := tview.NewTextView().SetText("? help  1-" + fmt.Sprint(len(v.tabs)) + "/Tab switch views  Q close UI  Ctrl-C stop server")
+	root := tview.NewFlex().SetDirection(tview.FlexRow).AddItem(v.tabBar, 1, 0, false)
+	if deps.Approvals != nil {
+		// Shown on every view, so a waiting request is never missed
+		root.AddItem(v.approval, 7, 0, false)
+	}
+	root.AddItem(v.pages, 0, 1, true).AddItem(hint, 1, 0, false)
+	v.app.SetRoot(root, true).SetFocus(v.pane.View)
+	v.app.SetInputCapture(v.handleKey)
+	v.renderTabBar()
+	return v
+}
+
+// centered places p in the middle of the screen at most width by height
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+}
+
+// handleKey runs the binding for event: a typed search goes to the search
+// field, the help overlay only closes, then the keys working everywhere come
+// before those of the open view
+func (v *view) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() == tcell.KeyCtrlC {
+		v.interrupt()
+		return nil
+	}
+	if v.app.GetFocus() == v.search {
+		return event
+	}
+	if v.helpOpen {
+		if event.Key() == tcell.KeyEscape || event.Rune() == '?' || event.Rune() == 'q' || event.Rune() == 'Q' {
+			v.toggleHelp()
+			return nil
+		}
+		return event
+	}
+	if dispatch(v.keys, event) || dispatch(v.tabs[v.active].keys, event) {
+		return nil
 	}
+	return event
+}
+
+// interrupt hands Ctrl-C to the server's signal handling
+func (v *view) interrupt() {
+	v.app.Stop()
+	syscall.Kill(os.Getpid(), syscall.SIGINT)
+}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		fmt.Fprintln(outputView, "[red]Error: Failed to start command")
+// showTab switches to the i-th view, bringing it up to date
+func (v *view) showTab(i int) {
+	v.active = i
+	v.tabs[i].refresh(time.Now())
+	v.pages.SwitchToPage(v.tabs[i].name)
+	v.app.SetFocus(v.tabs[i].focus)
+	v.renderTabBar()
+}
+
+// toggleHelp shows or hides the key overlay on top of the open view
+func (v *view) toggleHelp() {
+	v.helpOpen = !v.helpOpen
+	if v.helpOpen {
+		v.pages.ShowPage("help")
+		v.pages.SendToFront("help")
+		v.app.SetFocus(v.pages)
 		return
 	}
+	v.pages.HidePage("help")
+	v.app.SetFocus(v.tabs[v.active].focus)
+}
 
-	// Use a separate goroutine to log stdout to the file
-	go logOutput(stdout, logFile, outputView, outputBuffer)
+func (v *view) renderTabBar() {
+	v.tabBar.Clear()
+	for i, t := range v.tabs {
+		if i == v.active {
+			fmt.Fprintf(v.tabBar, " [black:white] %d %s [-:-]", i+1, t.name)
+		} else {
+			fmt.Fprintf(v.tabBar, "  %d %s ", i+1, t.name)
+		}
+	}
+}
 
-	// Use a separate goroutine to log stderr to the file
-	go logOutput(stderr, logFile, outputView, outputBuffer)
+// openSearch shows the search field below the log pane
+func (v *view) openSearch() {
+	v.overview.ResizeItem(v.search, 1, 0)
+	v.app.SetFocus(v.search)
+}
 
-	// Wait for the command to finish
-	if err := cmd.Wait(); err != nil {
-		fmt.Fprintln(logFile, "[red]Error: Command execution failed")
+// cycleLevel shows the next more verbose level, wrapping to errors only
+func (v *view) cycleLevel() {
+	filter := v.pane.Filter()
+	filter.Level = (filter.Level + 1) % Level(len(levelNames))
+	v.pane.SetFilter(filter)
+}
+
+// filterTask limits the log pane to the current task, or lifts that limit
+func (v *view) filterTask() {
+	filter := v.pane.Filter()
+	task := v.model.Current()
+	if filter.Task != "" || task == nil {
+		filter.Source, filter.Task, filter.Step = "", "", ""
 	} else {
-		fmt.Fprintln(logFile, "[green]Success: Node.js installation complete")
+		filter.Source, filter.Task = task.Source, task.ID
 	}
+	v.pane.SetFilter(filter)
 }
 
-// logOutput reads from the subprocess pipe and writes to both the log file and optionally the UI
-func logOutput(pipe io.ReadCloser, logFile *os.File, outputView *tview.TextView, outputBuffer *[]string) {
-	scanner := bufio.NewScanner(pipe)
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Log everything to the file
-		fmt.Fprintln(logFile, line)
+// filterStep cycles the log pane through the steps of the filtered task
+func (v *view) filterStep() {
+	filter := v.pane.Filter()
+	if filter.Task == "" {
+		return
+	}
+	var steps []string
+	for _, task := range v.model.Tasks() {
+		if task.Source == filter.Source && task.ID == filter.Task {
+			for _, step := range task.Steps {
+				steps = append(steps, step.Name)
+			}
+		}
+	}
+	next := ""
+	for i, step := range steps {
+		if filter.Step == "" {
+			next = step
+			break
+		}
+		if step == filter.Step && i+1 < len(steps) {
+			next = steps[i+1]
+			break
+		}
+	}
+	filter.Step = next
+	v.pane.SetFilter(filter)
+}
 
-		// Optionally store in buffer for display in UI
-		mutex.Lock()
-		*outputBuffer = append(*outputBuffer, line)
-		mutex.Unlock()
+// export writes the log pane as filtered to a file next to the UI log
+func (v *view) export() {
+	path := filepath.Join(v.exportDir, "log-export-"+time.Now().Format("20060102-150405")+".txt")
+	if err := v.pane.Export(path); err != nil {
+		uiLog.Error("Failed to export the log view", "error", err)
+		return
+	}
+	uiLog.Info("Exported the log view", "file", path)
+}
 
-		// Update the display with relevant lines based on debug mode
-		updateDisplay(outputView, *outputBuffer)
+// decide settles the oldest request waiting for approval
+func (v *view) decide(approve bool) {
+	pending := v.approvals.Pending()
+	if len(pending) == 0 {
+		return
 	}
+	if err := v.approvals.Decide(pending[0].ID, approve); err != nil {
+		uiLog.Warn("Approval failed", "request", pending[0].Summary(), "error", err)
+	}
+	v.render(time.Now())
+}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(logFile, "[red]Error reading from pipe: ", err)
+// renderApproval shows the oldest request waiting for approval
+func (v *view) renderApproval(now time.Time) {
+	v.approval.Clear()
+	pending := v.approvals.Pending()
+	if len(pending) == 0 {
+		fmt.Fprint(v.approval, "No requests waiting for approval")
+		return
+	}
+	request := pending[0]
+	fmt.Fprintf(v.approval, "[yellow::b]%s[-::-] requested by session %s from %s", request.Kind, tview.Escape(request.Session), tview.Escape(request.Client))
+	if len(pending) > 1 {
+		fmt.Fprintf(v.approval, " (%d more waiting)", len(pending)-1)
 	}
+	fmt.Fprintln(v.approval)
+	if request.Detail != "" {
+		fmt.Fprintln(v.approval, tview.Escape(request.Detail))
+	}
+	if len(request.Argv) > 0 {
+		fmt.Fprintf(v.approval, "argv: [::b]%s[::-]\n", tview.Escape(fmt.Sprintf("%q", request.Argv)))
+	}
+	for _, command := range request.Commands {
+		fmt.Fprintf(v.approval, "runs: [::b]%s[::-]\n", tview.Escape(command))
+	}
+	fmt.Fprintf(v.approval, "%s denied in %s", tview.Escape("[Press Y to Confirm, N to Cancel]"), request.Deadline.Sub(now).Round(time.Second))
 }
 
-// updateDisplay updates the text view based on the current state (showDebug toggle)
-func updateDisplay(outputView *tview.TextView, outputBuffer []string) {
-	// Clear the current output
-	outputView.Clear()
+// render redraws every widget from the model as of now
+func (v *view) render(now time.Time) {
+	if v.approvals != nil {
+		v.renderApproval(now)
+	}
 
-	// Re-display only the relevant lines (hide debug lines if showDebug is false)
-	for _, line := range outputBuffer {
-		if strings.Contains(line, "Debug:") && !showDebug {
-			// Skip debug lines if debug mode is not active
-			continue
+	v.header.Clear()
+	if task := v.model.Current(); task != nil {
+		fmt.Fprintf(v.header, "Task: [::b]%s[::-] (%s)\n", tview.Escape(task.Name()), task.Source)
+		fmt.Fprintf(v.header, "Status: %s%s[white]  elapsed %s", statusColors[task.Status], task.Status, task.Elapsed(now).Round(time.Second))
+		if task.Message != "" {
+			fmt.Fprintf(v.header, "  %s", tview.Escape(task.Message))
 		}
-		// Display the line
-		fmt.Fprintln(outputView, line)
+		fmt.Fprintln(v.header)
+	} else {
+		fmt.Fprintln(v.header, "Task: none yet")
+		fmt.Fprintln(v.header, "Status: waiting for events...")
 	}
+	if failure, ok := v.model.LastError(); ok {
+		message := failure.Error
+		if message == "" {
+			message = failure.Message
+		}
+		fmt.Fprintf(v.header, "Last error: [red]%s[white] (%s %s, %s)", tview.Escape(message), failure.Source, failure.Task, failure.Time.Format("15:04:05"))
+	} else {
+		fmt.Fprint(v.header, "Last error: none")
+	}
+
+	v.steps.Clear()
+	if task := v.model.Current(); task != nil {
+		for _, step := range task.Steps {
+			fmt.Fprintf(v.steps, "%s%-9s[white] %s", statusColors[step.Status], step.Status, tview.Escape(step.Name))
+			switch {
+			case !step.Finished.IsZero() && !step.Started.IsZero():
+				fmt.Fprintf(v.steps, "  %s", step.Finished.Sub(step.Started).Round(time.Millisecond))
+			case step.Status == events.StatusRunning:
+				fmt.Fprintf(v.steps, "  %s", now.Sub(step.Started).Round(time.Second))
+			}
+			if step.Error != "" {
+				fmt.Fprintf(v.steps, "  [red]%s[white]", tview.Escape(step.Error))
+			} else if step.Message != "" {
+				fmt.Fprintf(v.steps, "  %s", tview.Escape(step.Message))
+			}
+			fmt.Fprintln(v.steps)
+		}
+	}
+
+	v.tasks.Clear()
+	tasks := v.model.Tasks()
+	for i := len(tasks) - 1; i >= 0; i-- {
+		task := tasks[i]
+		fmt.Fprintf(v.tasks, "%s%-9s[white] %s\n", statusColors[task.Status], task.Status, tview.Escape(task.Name()))
+	}
+}
+
+// eventText renders e as one line of the log, without the time
+func eventText(e events.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-8s %s", e.Source, e.Task)
+	if e.Step != "" {
+		fmt.Fprintf(&b, " / %s", e.Step)
+	}
+	if e.Stream != "" {
+		fmt.Fprintf(&b, " %s: %s", e.Stream, e.Message)
+		return b.String()
+	}
+	fmt.Fprintf(&b, ": %s", e.Status)
+	if e.Message != "" {
+		fmt.Fprintf(&b, " %s", e.Message)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, " (error: %s)", e.Error)
+	}
+	return b.String()
+}
+
+// writeEvent appends e to the UI log
+func writeEvent(w io.Writer, e events.Event) {
+	fmt.Fprintf(w, "%s %s\n", e.Time.Format("2006/01/02 15:04:05"), eventText(e))
 }
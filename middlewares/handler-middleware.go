@@ -3,22 +3,34 @@
 package middlewares
 
 import (
-	"log"
 	"net/http"
 	"spi-go-core/helpers"
 	"spi-go-core/internal/encryption"
 )
 
 // ValidateConnection middleware checks if the connection is validated
-func ValidateConnection(next http.HandlerFunc) http.HandlerFunc {
+func ValidateConnection(sessions *encryption.SessionStore, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract the request ID from the headers
 		requestID := r.Header.Get("X-Request-ID")
-		if requestID == "" || !encryption.IsConnectionValidated(requestID) {
-			log.Printf("Invalid or missing request ID, connection not validated. Request ID: %s", requestID)
+		if requestID == "" || !sessions.IsValidated(requestID) {
+			serverLog.InfoContext(r.Context(), "Connection not validated", "path", r.URL.Path)
 			helpers.JSONError(w, "Connection is not validated", http.StatusUnauthorized)
 			return
 		}
 		next(w, r)
 	}
 }
+
+// ValidateSession middleware checks if the request belongs to an active session that may still be mid-handshake
+func ValidateSession(sessions *encryption.SessionStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || !sessions.IsActive(requestID) {
+			serverLog.InfoContext(r.Context(), "No active session", "path", r.URL.Path)
+			helpers.JSONError(w, "Session is not active", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
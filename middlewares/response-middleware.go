@@ -4,14 +4,29 @@ package middlewares
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/logging"
+	"spi-go-core/internal/metrics"
+	"spi-go-core/internal/tracing"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// serverLog is the log of the server component
+var serverLog = logging.For(logging.Server)
+
 type ResponseWrapper struct {
 	http.ResponseWriter
 	StatusCode int
-	Body       []byte
+	Size       int // bytes written, the body itself is never logged
 }
 
 func (rw *ResponseWrapper) WriteHeader(statusCode int) {
@@ -20,26 +35,78 @@ func (rw *ResponseWrapper) WriteHeader(statusCode int) {
 }
 
 func (rw *ResponseWrapper) Write(body []byte) (int, error) {
-	rw.Body = body
-	return rw.ResponseWriter.Write(body)
+	n, err := rw.ResponseWriter.Write(body)
+	rw.Size += n
+	return n, err
+}
+
+// Unwrap exposes the underlying ResponseWriter so http.ResponseController can flush streamed responses
+func (rw *ResponseWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
+// OutputMiddleware gives each request an ID, which every line logged with the
+// request's context carries along with the session, and a span, continuing
+// the trace of the client's traceparent header. It logs the response and
+// records its status and latency by route.
 func OutputMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Wrap the ResponseWriter
 		wrapper := &ResponseWrapper{ResponseWriter: w, StatusCode: http.StatusOK}
+		route := routeOf(r)
+		ctx := logging.WithIDs(tracing.Extract(r.Context(), r.Header), encryption.GenerateReqId(), r.Header.Get("X-Request-ID"))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path), attribute.String("spi.request_id", logging.RequestID(ctx))))
+		started := time.Now()
 
 		// Call the next handler
-		next(wrapper, r)
+		next(wrapper, r.WithContext(ctx))
+
+		elapsed := time.Since(started)
+		metrics.HTTPRequests.Inc(route, r.Method, strconv.Itoa(wrapper.StatusCode))
+		metrics.HTTPDuration.Observe(elapsed.Seconds(), route)
+		span.SetAttributes(attribute.Int("http.response.status_code", wrapper.StatusCode))
+		if wrapper.StatusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(wrapper.StatusCode))
+		}
+		span.End()
+
+		level := slog.LevelDebug
+		if wrapper.StatusCode >= 500 {
+			level = slog.LevelWarn
+		}
+		serverLog.Log(ctx, level, "Request served", "method", r.Method, "path", r.URL.Path,
+			"status", wrapper.StatusCode, "bytes", wrapper.Size, "duration", elapsed)
+	}
+}
+
+// routeOf returns the pattern r was routed by without its method, so paths
+// with IDs share one series
+func routeOf(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
 
-		// Process the response
+// HandshakeStage counts the requests of a handshake stage and those answered
+// with an error, and traces each in a span of its own
+func HandshakeStage(stage string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wrapper := &ResponseWrapper{ResponseWriter: w, StatusCode: http.StatusOK}
+		ctx, span := tracing.Start(r.Context(), "handshake."+stage, attribute.String("spi.handshake.stage", stage))
+		next(wrapper, r.WithContext(ctx))
+		metrics.HandshakeAttempts.Inc(stage)
+		var err error
 		if wrapper.StatusCode >= 400 {
-			// Handle error responses
-			//jsonError(w, "An error occurred", wrapper.StatusCode)
-		} else {
-			// You can process successful responses if needed
-			log.Printf("Status Code: %d, Response Body: %s", wrapper.StatusCode, wrapper.Body)
+			metrics.HandshakeFailures.Inc(stage)
+			err = fmt.Errorf("%s failed with %d", stage, wrapper.StatusCode)
 		}
+		tracing.End(span, err)
 	}
 }
 
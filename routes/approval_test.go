@@ -0,0 +1,79 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"spi-go-core/handlers"
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/testutil"
+)
+
+// decideNext settles the next request reaching the harness' gate and returns it
+func decideNext(t *testing.T, h *testutil.Harness, approve bool) <-chan approval.Request {
+	t.Helper()
+	decided := make(chan approval.Request, 1)
+	go func() {
+		defer close(decided)
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if pending := h.Approvals.Pending(); len(pending) > 0 {
+				h.Approvals.Decide(pending[0].ID, approve)
+				decided <- pending[0]
+				return
+			}
+		}
+	}()
+	return decided
+}
+
+func TestApprovalGatesPolicyCommands(t *testing.T) {
+	h := testutil.NewHarness(t)
+	h.UpdateConfig(t, func(raw map[string]any) {
+		raw["approval"] = map[string]any{"commands": []string{"pwd"}, "timeout_seconds": 5}
+	})
+	if err := h.ConfigStore.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	sessionID := handshake(t, h)
+
+	if status := execStatus(t, h, sessionID); status != http.StatusForbidden {
+		t.Errorf("Exec needing approval without a console returned %d, expected 403", status)
+	}
+
+	detach := h.Approvals.Attach()
+	defer detach()
+	decided := decideNext(t, h, true)
+	if status := execStatus(t, h, sessionID); status != http.StatusOK {
+		t.Errorf("Approved exec returned %d", status)
+	}
+	request := <-decided
+	if request.Kind != approval.KindExec || request.Session != sessionID || request.Client == "" || len(request.Argv) != 1 || request.Argv[0] != "pwd" {
+		t.Errorf("Unexpected approval request %+v", request)
+	}
+
+	// A job waits for the decision instead of the request
+	response := h.Post(t, "/api/jobs", sessionID, handlers.RequestPayload{Command: "pwd"})
+	var job jobs.Info
+	json.NewDecoder(response.Body).Decode(&job)
+	response.Body.Close()
+	if response.StatusCode != http.StatusAccepted || job.Status != jobs.StatusAwaitingApproval {
+		t.Fatalf("Expected an accepted job awaiting approval, got %d %+v", response.StatusCode, job)
+	}
+	<-decideNext(t, h, false)
+	for deadline := time.Now().Add(5 * time.Second); job.FinishedAt == nil && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		request, _ := http.NewRequest(http.MethodGet, h.Server.URL+"/api/jobs/"+job.ID, nil)
+		request.Header.Set("X-Request-ID", sessionID)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(response.Body).Decode(&job)
+		response.Body.Close()
+	}
+	if job.Status != jobs.StatusFailed || job.Error != approval.ErrDenied.Error() {
+		t.Errorf("Expected the denied job to fail, got %+v", job)
+	}
+}
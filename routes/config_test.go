@@ -0,0 +1,95 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"spi-go-core/handlers"
+	"spi-go-core/internal/testutil"
+)
+
+func getHealth(t *testing.T, h *testutil.Harness) handlers.HealthResponse {
+	t.Helper()
+	response, err := http.Get(h.Server.URL + "/api/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var health handlers.HealthResponse
+	if err := json.NewDecoder(response.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode health: %v", err)
+	}
+	return health
+}
+
+func reload(t *testing.T, h *testutil.Harness, sessionID string) (int, handlers.ReloadResponse) {
+	t.Helper()
+	response := h.Post(t, "/api/admin/reload", sessionID, nil)
+	defer response.Body.Close()
+	var result handlers.ReloadResponse
+	json.NewDecoder(response.Body).Decode(&result)
+	return response.StatusCode, result
+}
+
+func TestReloadReplacesTheAllowlist(t *testing.T) {
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+
+	if status, _ := reload(t, h, "unknown-session"); status != http.StatusUnauthorized {
+		t.Errorf("Reload without a validated session returned %d, expected 401", status)
+	}
+
+	// pwd is removed from the allowlist
+	h.UpdateConfig(t, func(raw map[string]any) {
+		raw["commands"] = map[string]any{"allowed": []string{"whoami"}}
+	})
+	status, result := reload(t, h, sessionID)
+	if status != http.StatusOK || !result.Reloaded || result.Status.Generation != 2 || result.Status.LastTrigger != "admin" {
+		t.Fatalf("Unexpected reload response %d %+v", status, result)
+	}
+	if status := execStatus(t, h, sessionID); status != http.StatusForbidden {
+		t.Errorf("Exec of a removed command returned %d, expected 403", status)
+	}
+	if health := getHealth(t, h); health.Status != handlers.HealthOK {
+		t.Errorf("Expected a healthy server, got %+v", health)
+	}
+
+	// A broken config is rejected and the running one stays in effect
+	h.UpdateConfig(t, func(raw map[string]any) {
+		raw["commands"] = map[string]any{"allowed": []string{"pwd"}}
+		raw["logging"] = map[string]any{"verbosity": "loud"}
+	})
+	status, result = reload(t, h, sessionID)
+	if status != http.StatusUnprocessableEntity || result.Reloaded || len(result.Status.Problems) != 1 || result.Status.Problems[0].Key != "logging.verbosity" {
+		t.Errorf("Unexpected reload response %d %+v", status, result)
+	}
+	if status := execStatus(t, h, sessionID); status != http.StatusForbidden {
+		t.Errorf("A failed reload must not change the allowlist, exec returned %d", status)
+	}
+	if h.ConfigStore.Current().Commands.Allowed[0] != "whoami" {
+		t.Errorf("A failed reload must keep the running config, got %v", h.ConfigStore.Current().Commands.Allowed)
+	}
+	health := getHealth(t, h)
+	if health.Status != handlers.HealthDegraded || health.Config == nil || health.Config.LastError == "" || health.Config.Generation != 2 {
+		t.Errorf("Expected the failed reload in health, got %+v", health)
+	}
+}
+
+func TestServersSideBySideKeepTheirOwnConfig(t *testing.T) {
+	first := testutil.NewHarness(t)
+	second := testutil.NewHarness(t)
+	second.UpdateConfig(t, func(raw map[string]any) {
+		raw["commands"] = map[string]any{"enabled": false, "allowed": []string{}}
+	})
+	if err := second.ConfigStore.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := execStatus(t, first, handshake(t, first)); status != http.StatusOK {
+		t.Errorf("First server should still allow pwd, exec returned %d", status)
+	}
+	if status := execStatus(t, second, handshake(t, second)); status != http.StatusForbidden {
+		t.Errorf("Second server has exec disabled, exec returned %d", status)
+	}
+}
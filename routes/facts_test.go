@@ -0,0 +1,49 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"spi-go-core/client"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/testutil"
+)
+
+func TestFactsEndpoint(t *testing.T) {
+	h := testutil.NewHarness(t)
+	release := filepath.Join(h.Dir, "root", "etc", "os-release")
+	if err := os.MkdirAll(filepath.Dir(release), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(release, []byte("ID=debian\nVERSION_ID=\"12\"\nVERSION_CODENAME=bookworm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, h.Server.URL+"/api/facts", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected facts to require a session, got %d", response.StatusCode)
+	}
+
+	request.Header.Set(client.SessionHeader, handshake(t, h))
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var hostFacts facts.Facts
+	if err := json.NewDecoder(response.Body).Decode(&hostFacts); err != nil {
+		t.Fatalf("Failed to decode facts: %v", err)
+	}
+	if hostFacts.OS.ID != "debian" || hostFacts.OS.VersionID != "12" || hostFacts.OS.Codename != "bookworm" {
+		t.Errorf("Unexpected facts: %+v", hostFacts.OS)
+	}
+}
@@ -0,0 +1,289 @@
+package routes_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"spi-go-core/handlers"
+	"spi-go-core/helpers"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/testutil"
+)
+
+// keyExchange performs step one and returns the session ID and the server public key
+func keyExchange(t *testing.T, h *testutil.Harness, clientKey *rsa.PrivateKey) (string, *rsa.PublicKey) {
+	t.Helper()
+
+	resp := h.Post(t, "/api/key-exchange", "", handlers.KeyExchangeRequest{
+		TSAppPublicKey: testutil.PublicKeyPEM(t, &clientKey.PublicKey),
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Key exchange returned %d", resp.StatusCode)
+	}
+	sessionID := resp.Header.Get("X-Request-ID")
+	if sessionID == "" {
+		t.Fatal("Key exchange did not return a session ID")
+	}
+
+	var body handlers.KeyExchangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode key exchange response: %v", err)
+	}
+	serverKey, err := encryption.ParsePublicKey(body.GoCorePublicKey)
+	if err != nil {
+		t.Fatalf("Failed to parse server public key: %v", err)
+	}
+	if !serverKey.Equal(&h.ServerKey.PublicKey) {
+		t.Fatal("Server returned a different public key than the configured one")
+	}
+	return sessionID, serverKey
+}
+
+// verifyMessage performs step two and returns the decrypted server challenge
+func verifyMessage(t *testing.T, h *testutil.Harness, sessionID string, clientKey *rsa.PrivateKey, serverKey *rsa.PublicKey) []byte {
+	t.Helper()
+
+	probe := []byte("probe-" + sessionID)
+	resp := h.Post(t, "/api/verify-message", sessionID, handlers.VerificationRequest{
+		EncryptedResponse: testutil.Encrypt(t, serverKey, probe),
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Message verification returned %d", resp.StatusCode)
+	}
+
+	var body handlers.VerificationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode verification response: %v", err)
+	}
+	if echoed := testutil.Decrypt(t, clientKey, body.EncryptedResponse); !bytes.Equal(echoed, probe) {
+		t.Fatalf("Server echoed %q, expected %q", echoed, probe)
+	}
+	return testutil.Decrypt(t, clientKey, body.OwnChallenge)
+}
+
+// finalize performs step three with the given secret and returns the response status
+func finalize(t *testing.T, h *testutil.Harness, sessionID string, serverKey *rsa.PublicKey, secret []byte) int {
+	t.Helper()
+	resp := h.Post(t, "/api/handshake-success", sessionID, handlers.FinalizationRequest{
+		Secret: testutil.Encrypt(t, serverKey, secret),
+	})
+	return resp.StatusCode
+}
+
+// handshake runs all three steps and returns the validated session ID
+func handshake(t *testing.T, h *testutil.Harness) string {
+	t.Helper()
+	clientKey := testutil.GenerateKey(t)
+	sessionID, serverKey := keyExchange(t, h, clientKey)
+	challenge := verifyMessage(t, h, sessionID, clientKey, serverKey)
+	if status := finalize(t, h, sessionID, serverKey, challenge); status != http.StatusOK {
+		t.Fatalf("Finalization returned %d", status)
+	}
+	return sessionID
+}
+
+func execStatus(t *testing.T, h *testutil.Harness, sessionID string) int {
+	t.Helper()
+	return h.Post(t, "/api/exec", sessionID, handlers.RequestPayload{Command: "pwd"}).StatusCode
+}
+
+func TestHandshakeHappyPath(t *testing.T) {
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+
+	if !h.Sessions.IsValidated(sessionID) {
+		t.Error("Session should be validated after the handshake")
+	}
+	if status := execStatus(t, h, sessionID); status != http.StatusOK {
+		t.Errorf("Exec on a validated session returned %d", status)
+	}
+}
+
+func TestExecRejectedBeforeFinalization(t *testing.T) {
+	h := testutil.NewHarness(t)
+	clientKey := testutil.GenerateKey(t)
+	sessionID, serverKey := keyExchange(t, h, clientKey)
+
+	if status := execStatus(t, h, sessionID); status != http.StatusUnauthorized {
+		t.Errorf("Exec after key exchange only returned %d, expected 401", status)
+	}
+
+	verifyMessage(t, h, sessionID, clientKey, serverKey)
+	if status := execStatus(t, h, sessionID); status != http.StatusUnauthorized {
+		t.Errorf("Exec before finalization returned %d, expected 401", status)
+	}
+}
+
+func TestExecErrorsAreJSON(t *testing.T) {
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+
+	for name, body := range map[string]any{
+		"refused command": handlers.RequestPayload{Command: "rm -rf /"},
+		"invalid payload": "not an object",
+	} {
+		resp := h.Post(t, "/api/exec", sessionID, body)
+		var apiErr helpers.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" || apiErr.Code != resp.StatusCode {
+			t.Errorf("Expected a JSON error for the %s, got %d %+v (%v)", name, resp.StatusCode, apiErr, err)
+		}
+	}
+}
+
+func TestHandshakeWrongChallenge(t *testing.T) {
+	h := testutil.NewHarness(t)
+	clientKey := testutil.GenerateKey(t)
+	sessionID, serverKey := keyExchange(t, h, clientKey)
+	challenge := verifyMessage(t, h, sessionID, clientKey, serverKey)
+
+	if status := finalize(t, h, sessionID, serverKey, []byte("not-the-challenge")); status != http.StatusUnauthorized {
+		t.Errorf("Wrong challenge returned %d, expected 401", status)
+	}
+	if h.Sessions.IsValidated(sessionID) {
+		t.Error("Session must not be validated after a wrong challenge")
+	}
+
+	// The challenge is burned by the failed attempt
+	if status := finalize(t, h, sessionID, serverKey, challenge); status != http.StatusUnauthorized {
+		t.Errorf("Correct challenge after a failed attempt returned %d, expected 401", status)
+	}
+}
+
+func TestHandshakeExpiredSession(t *testing.T) {
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+
+	h.Sessions.SetTTL(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if status := execStatus(t, h, sessionID); status != http.StatusUnauthorized {
+		t.Errorf("Exec on an expired session returned %d, expected 401", status)
+	}
+}
+
+func TestHandshakeMissingHeader(t *testing.T) {
+	h := testutil.NewHarness(t)
+	clientKey := testutil.GenerateKey(t)
+	_, serverKey := keyExchange(t, h, clientKey)
+
+	resp := h.Post(t, "/api/verify-message", "", handlers.VerificationRequest{
+		EncryptedResponse: testutil.Encrypt(t, serverKey, []byte("probe")),
+	})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Verification without session header returned %d, expected 401", resp.StatusCode)
+	}
+	if status := finalize(t, h, "", serverKey, []byte("secret")); status != http.StatusUnauthorized {
+		t.Errorf("Finalization without session header returned %d, expected 401", status)
+	}
+	if status := execStatus(t, h, ""); status != http.StatusUnauthorized {
+		t.Errorf("Exec without session header returned %d, expected 401", status)
+	}
+}
+
+func TestHandshakeMalformedPEM(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	for name, key := range map[string]string{
+		"garbage":   "not a pem block",
+		"truncated": "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOC\n-----END PUBLIC KEY-----\n",
+		"empty":     "",
+	} {
+		resp := h.Post(t, "/api/key-exchange", "", handlers.KeyExchangeRequest{TSAppPublicKey: key})
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s key returned %d, expected 400", name, resp.StatusCode)
+		}
+		if resp.Header.Get("X-Request-ID") != "" {
+			t.Errorf("%s key should not issue a session ID", name)
+		}
+	}
+}
+
+func TestHandshakeReplayedFinalization(t *testing.T) {
+	h := testutil.NewHarness(t)
+	clientKey := testutil.GenerateKey(t)
+	sessionID, serverKey := keyExchange(t, h, clientKey)
+	challenge := verifyMessage(t, h, sessionID, clientKey, serverKey)
+
+	if status := finalize(t, h, sessionID, serverKey, challenge); status != http.StatusOK {
+		t.Fatalf("Finalization returned %d", status)
+	}
+	if status := finalize(t, h, sessionID, serverKey, challenge); status == http.StatusOK {
+		t.Error("Replayed finalization must be rejected")
+	}
+
+	// A replay against a different session must not validate it either
+	otherSession, otherServerKey := keyExchange(t, h, testutil.GenerateKey(t))
+	if status := finalize(t, h, otherSession, otherServerKey, challenge); status != http.StatusUnauthorized {
+		t.Errorf("Finalization replayed on another session returned %d, expected 401", status)
+	}
+	if h.Sessions.IsValidated(otherSession) {
+		t.Error("Replayed finalization validated another session")
+	}
+}
+
+func TestHandshakeConcurrentReplays(t *testing.T) {
+	h := testutil.NewHarness(t)
+	clientKey := testutil.GenerateKey(t)
+	sessionID, serverKey := keyExchange(t, h, clientKey)
+	challenge := verifyMessage(t, h, sessionID, clientKey, serverKey)
+
+	// One open connection per attempt, so none waits for a dial while another
+	// is already finalizing
+	const attempts = 16
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: attempts}}
+	defer client.CloseIdleConnections()
+	send := func(method, path string, body []byte) int {
+		request, _ := http.NewRequest(method, h.Server.URL+path, bytes.NewReader(body))
+		request.Header.Set("X-Request-ID", sessionID)
+		response, err := client.Do(request)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			send(http.MethodGet, "/healthz", nil)
+		}()
+	}
+	wg.Wait()
+
+	// The attempts are encrypted up front and released together
+	statuses := make(chan int, attempts)
+	start := make(chan struct{})
+	for range attempts {
+		body, _ := json.Marshal(handlers.FinalizationRequest{Secret: testutil.Encrypt(t, serverKey, challenge)})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			statuses <- send(http.MethodPost, "/api/handshake-success", body)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(statuses)
+
+	succeeded := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("Expected exactly one of %d concurrent finalizations to succeed, %d did", attempts, succeeded)
+	}
+	if !h.Sessions.IsValidated(sessionID) {
+		t.Error("Session should be validated by the one that succeeded")
+	}
+}
@@ -0,0 +1,85 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"spi-go-core/client"
+	"spi-go-core/handlers"
+	"spi-go-core/internal/health"
+	"spi-go-core/internal/testutil"
+)
+
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func TestLivenessAndReadiness(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	if status := getStatus(t, h.Server.URL+"/healthz"); status != http.StatusOK {
+		t.Errorf("Expected /healthz to answer 200, got %d", status)
+	}
+
+	response, err := http.Get(h.Server.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var readiness handlers.ReadinessResponse
+	json.NewDecoder(response.Body).Decode(&readiness)
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || readiness.Ready {
+		t.Errorf("Expected not ready while the app has not started, got %d %+v", response.StatusCode, readiness)
+	}
+
+	h.Supervisor.Disable("no app")
+	if status := getStatus(t, h.Server.URL+"/readyz"); status != http.StatusOK {
+		t.Errorf("Expected ready without an app to supervise, got %d", status)
+	}
+}
+
+func TestDiagnosticsRequireASession(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	if status := getStatus(t, h.Server.URL+"/api/diagnostics"); status != http.StatusUnauthorized {
+		t.Errorf("Expected the diagnostics to require a session, got %d", status)
+	}
+
+	sessionID := handshake(t, h)
+	request, _ := http.NewRequest(http.MethodGet, h.Server.URL+"/api/diagnostics", nil)
+	request.Header.Set(client.SessionHeader, sessionID)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var diagnostics health.Diagnostics
+	if err := json.NewDecoder(response.Body).Decode(&diagnostics); err != nil {
+		t.Fatalf("Failed to decode diagnostics: %v", err)
+	}
+	if diagnostics.TLS != "http" || diagnostics.CoreKey == "" || len(diagnostics.Checks) == 0 {
+		t.Errorf("Unexpected diagnostics: %+v", diagnostics)
+	}
+}
+
+func TestRootMentionsPlainHTTP(t *testing.T) {
+	h := testutil.NewHarness(t)
+	response, err := http.Get(h.Server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if !strings.Contains(string(body), "plain HTTP") {
+		t.Errorf("Expected the root page to say it runs over plain HTTP, got %q", body)
+	}
+}
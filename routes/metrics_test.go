@@ -0,0 +1,34 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"spi-go-core/internal/metrics"
+	"spi-go-core/internal/testutil"
+)
+
+func TestMetricsCountHandshakeStagesAndRoutes(t *testing.T) {
+	h := testutil.NewHarness(t)
+	attempts := metrics.HandshakeAttempts.Value("finalize")
+	failures := metrics.HandshakeFailures.Value("finalize")
+	keyExchanges := metrics.HTTPRequests.Value("/api/key-exchange", http.MethodPost, "200")
+
+	clientKey := testutil.GenerateKey(t)
+	sessionID, serverKey := keyExchange(t, h, clientKey)
+	verifyMessage(t, h, sessionID, clientKey, serverKey)
+	finalize(t, h, sessionID, serverKey, []byte("not-the-challenge"))
+
+	if got := metrics.HandshakeAttempts.Value("finalize") - attempts; got != 1 {
+		t.Errorf("Expected 1 finalize attempt, got %v", got)
+	}
+	if got := metrics.HandshakeFailures.Value("finalize") - failures; got != 1 {
+		t.Errorf("Expected 1 finalize failure, got %v", got)
+	}
+	if got := metrics.HTTPRequests.Value("/api/key-exchange", http.MethodPost, "200") - keyExchanges; got != 1 {
+		t.Errorf("Expected 1 key exchange by route, got %v", got)
+	}
+	if metrics.HTTPDuration.Count("/api/key-exchange") == 0 {
+		t.Error("Expected the latency of the key exchange")
+	}
+}
@@ -0,0 +1,123 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"spi-go-core/internal/profiles"
+	"spi-go-core/internal/testutil"
+)
+
+// commandProfile is a profile with a single command step running argv
+func commandProfile(name string, argv ...string) profiles.Profile {
+	return profiles.Profile{Name: name, Steps: []profiles.Step{{Name: "run", Type: profiles.StepCommand, Command: argv}}}
+}
+
+func TestProfilesRefuseCommandsThePolicyDenies(t *testing.T) {
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+
+	response := h.Post(t, "/api/profiles", sessionID, commandProfile("fetch", "curl", "http://example.com"))
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Uploading a profile running a command outside the allowlist returned %d, expected 403", response.StatusCode)
+	}
+
+	response = h.Post(t, "/api/profiles", sessionID, commandProfile("where", "pwd"))
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		t.Fatalf("Uploading a profile running an allowed command returned %d", response.StatusCode)
+	}
+
+	// The allowlist is checked again when the profile is applied
+	h.UpdateConfig(t, func(raw map[string]any) {
+		raw["commands"] = map[string]any{"allowed": []string{"whoami"}}
+	})
+	if err := h.ConfigStore.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	response = h.Post(t, "/api/profiles/where/apply", sessionID, nil)
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Applying a profile whose command left the allowlist returned %d, expected 403", response.StatusCode)
+	}
+}
+
+// get sends an authenticated GET to the harness and decodes the JSON reply into out
+func get(t *testing.T, h *testutil.Harness, path, sessionID string, out any) int {
+	t.Helper()
+	request, _ := http.NewRequest(http.MethodGet, h.Server.URL+path, nil)
+	request.Header.Set("X-Request-ID", sessionID)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	json.NewDecoder(response.Body).Decode(out)
+	return response.StatusCode
+}
+
+func TestProfileNamedRunsIsNotShadowed(t *testing.T) {
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+
+	response := h.Post(t, "/api/profiles", sessionID, commandProfile("runs", "pwd"))
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		t.Fatalf("Uploading the profile returned %d", response.StatusCode)
+	}
+	var profile profiles.Profile
+	if status := get(t, h, "/api/profiles/runs", sessionID, &profile); status != http.StatusOK || profile.Name != "runs" {
+		t.Errorf("Expected the profile named runs, got %d %+v", status, profile)
+	}
+
+	response = h.Post(t, "/api/profiles/runs/apply", sessionID, nil)
+	var run profiles.Run
+	json.NewDecoder(response.Body).Decode(&run)
+	response.Body.Close()
+	if response.StatusCode != http.StatusAccepted || run.ID == "" {
+		t.Fatalf("Expected an accepted run, got %d %+v", response.StatusCode, run)
+	}
+	var runs []profiles.Run
+	if status := get(t, h, "/api/profile-runs", sessionID, &runs); status != http.StatusOK || len(runs) != 1 || runs[0].ID != run.ID {
+		t.Errorf("Expected the run in the list, got %d %+v", status, runs)
+	}
+	if status := get(t, h, "/api/profile-runs/"+run.ID, sessionID, &run); status != http.StatusOK || run.Profile != "runs" {
+		t.Errorf("Expected the run of profile runs, got %d %+v", status, run)
+	}
+}
+
+func TestProfilesRefuseStepsOutsideThePolicy(t *testing.T) {
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+	upload := func(path string) int {
+		t.Helper()
+		response := h.Post(t, "/api/profiles", sessionID, profiles.Profile{Name: "cron", Steps: []profiles.Step{
+			{Name: "write", Type: profiles.StepFile, Path: path, Content: "* * * * * root sh\n"},
+		}})
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// Only command steps are allowed by default
+	if status := upload("/etc/cron.d/x"); status != http.StatusForbidden {
+		t.Errorf("Uploading a file step by default returned %d, expected 403", status)
+	}
+
+	h.UpdateConfig(t, func(raw map[string]any) {
+		raw["profiles"] = map[string]any{"allowed_steps": []string{"file"}, "allowed_paths": []string{"/srv/app"}}
+	})
+	if err := h.ConfigStore.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	if status := upload("/etc/cron.d/x"); status != http.StatusForbidden {
+		t.Errorf("Uploading a file step outside the allowed paths returned %d, expected 403", status)
+	}
+	if status := upload("/srv/application"); status != http.StatusForbidden {
+		t.Errorf("Uploading a file step next to an allowed path returned %d, expected 403", status)
+	}
+	if status := upload("/srv/app/cron"); status != http.StatusCreated {
+		t.Errorf("Uploading a file step below an allowed path returned %d, expected 201", status)
+	}
+}
@@ -5,27 +5,100 @@ package routes
 import (
 	"net/http"
 	"spi-go-core/handlers"
+	"spi-go-core/internal/approval"
+	"spi-go-core/internal/audit"
+	"spi-go-core/internal/config"
+	"spi-go-core/internal/encryption"
+	"spi-go-core/internal/executor"
+	"spi-go-core/internal/facts"
+	"spi-go-core/internal/jobs"
+	"spi-go-core/internal/profiles"
+	"spi-go-core/internal/supervisor"
 	"spi-go-core/middlewares"
 )
 
+// Dependencies are the long-lived services the routes are served from
+type Dependencies struct {
+	Jobs          *jobs.Manager
+	Profiles      *profiles.Store
+	ProfileRunner *profiles.Runner
+	Facts         *facts.Collector
+	Supervisor    *supervisor.Supervisor
+	Config        *config.Store            // the running configuration, required
+	Sessions      *encryption.SessionStore // sessions of the handshake, required
+	Approvals     *approval.Gate           // without one, work needing approval is refused
+	Executor      executor.Executor        // spawns the processes of /api/exec, required
+	Audit         *audit.Log               // records commands, jobs and profile runs; nil discards
+}
+
 // Router holds the routing logic
-type Router struct{}
+type Router struct {
+	mux  *http.ServeMux
+	deps Dependencies
+}
 
-// NewRouter creates a new Router
-func NewRouter() *Router {
-	return &Router{}
+// NewRouter creates a new Router backed by its own ServeMux
+func NewRouter(deps Dependencies) *Router {
+	return &Router{
+		mux:  http.NewServeMux(),
+		deps: deps,
+	}
+}
+
+// Handler returns the http.Handler serving the registered routes
+func (r *Router) Handler() http.Handler {
+	return r.mux
 }
 
 // RegisterRoutes registers routes directly with the necessary handlers and middleware
 func (r *Router) RegisterRoutes() {
 	// Handshake routes
-	http.HandleFunc("/api/key-exchange", middlewares.OutputMiddleware(handlers.HandleKeyExchange))
-	http.HandleFunc("/api/verify-message", middlewares.OutputMiddleware(middlewares.ValidateConnection(handlers.HandleMessageVerification)))
-	http.HandleFunc("/api/handshake-success", middlewares.OutputMiddleware(middlewares.ValidateConnection(handlers.HandleSuccess)))
+	handshakeHandler := &handlers.HandshakeHandler{Config: r.deps.Config, Sessions: r.deps.Sessions}
+	r.mux.HandleFunc("/api/key-exchange", middlewares.OutputMiddleware(middlewares.HandshakeStage("key_exchange", handshakeHandler.HandleKeyExchange)))
+	r.mux.HandleFunc("/api/verify-message", middlewares.OutputMiddleware(middlewares.HandshakeStage("verify", middlewares.ValidateSession(r.deps.Sessions, handshakeHandler.HandleMessageVerification))))
+	r.mux.HandleFunc("/api/handshake-success", middlewares.OutputMiddleware(middlewares.HandshakeStage("finalize", middlewares.ValidateSession(r.deps.Sessions, handshakeHandler.HandleSuccess))))
 
 	// Protected routes (Require validated connection)
-	http.HandleFunc("/api/exec", middlewares.OutputMiddleware(middlewares.ValidateConnection(handlers.HandleExecCommand)))
+	execHandler := &handlers.ExecHandler{Config: r.deps.Config, Approvals: r.deps.Approvals, Executor: r.deps.Executor, Audit: r.deps.Audit}
+	r.mux.HandleFunc("/api/exec", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, execHandler.HandleExecCommand)))
+
+	// Job routes (Require validated connection)
+	jobsHandler := &handlers.JobsHandler{Jobs: r.deps.Jobs, Config: r.deps.Config, Approvals: r.deps.Approvals, Audit: r.deps.Audit}
+	r.mux.HandleFunc("POST /api/jobs", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, jobsHandler.HandleStart)))
+	r.mux.HandleFunc("GET /api/jobs", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, jobsHandler.HandleList)))
+	r.mux.HandleFunc("GET /api/jobs/{id}", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, jobsHandler.HandleGet)))
+	r.mux.HandleFunc("POST /api/jobs/{id}/cancel", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, jobsHandler.HandleCancel)))
+	r.mux.HandleFunc("GET /api/jobs/{id}/stream", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, jobsHandler.HandleStream)))
+
+	// Profile routes (Require validated connection)
+	profilesHandler := &handlers.ProfilesHandler{Store: r.deps.Profiles, Runner: r.deps.ProfileRunner, Config: r.deps.Config, Approvals: r.deps.Approvals, Audit: r.deps.Audit}
+	r.mux.HandleFunc("POST /api/profiles", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, profilesHandler.HandleUpload)))
+	r.mux.HandleFunc("GET /api/profiles", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, profilesHandler.HandleList)))
+	r.mux.HandleFunc("GET /api/profiles/{name}", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, profilesHandler.HandleGet)))
+	r.mux.HandleFunc("POST /api/profiles/{name}/plan", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, profilesHandler.HandlePlan)))
+	r.mux.HandleFunc("POST /api/profiles/{name}/apply", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, profilesHandler.HandleApply)))
+	r.mux.HandleFunc("GET /api/profile-runs", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, profilesHandler.HandleListRuns)))
+	r.mux.HandleFunc("GET /api/profile-runs/{id}", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, profilesHandler.HandleGetRun)))
+
+	// Host facts (Require validated connection)
+	factsHandler := &handlers.FactsHandler{Collector: r.deps.Facts}
+	r.mux.HandleFunc("GET /api/facts", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, factsHandler.HandleGet)))
+
+	// Supervised app status (Require validated connection)
+	supervisorHandler := &handlers.SupervisorHandler{Supervisor: r.deps.Supervisor}
+	r.mux.HandleFunc("GET /api/supervisor", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, supervisorHandler.HandleGet)))
+
+	// Health is public so probes work without a session, diagnostics are not
+	healthHandler := &handlers.HealthHandler{Config: r.deps.Config, Supervisor: r.deps.Supervisor}
+	r.mux.HandleFunc("GET /api/health", middlewares.OutputMiddleware(healthHandler.HandleGet))
+	r.mux.HandleFunc("GET /healthz", middlewares.OutputMiddleware(healthHandler.HandleLive))
+	r.mux.HandleFunc("GET /readyz", middlewares.OutputMiddleware(healthHandler.HandleReady))
+	r.mux.HandleFunc("GET /api/diagnostics", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, healthHandler.HandleDiagnostics)))
+
+	// Admin routes (Require validated connection)
+	configHandler := &handlers.ConfigHandler{Store: r.deps.Config}
+	r.mux.HandleFunc("POST /api/admin/reload", middlewares.OutputMiddleware(middlewares.ValidateConnection(r.deps.Sessions, configHandler.HandleReload)))
 
 	// Root route
-	http.HandleFunc("/", middlewares.OutputMiddleware(handlers.HandleRoot))
+	r.mux.HandleFunc("/", middlewares.OutputMiddleware(handlers.HandleRoot))
 }
@@ -0,0 +1,57 @@
+package routes_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"spi-go-core/client"
+	"spi-go-core/internal/supervisor"
+	"spi-go-core/internal/testutil"
+)
+
+func getSupervisorStatus(t *testing.T, h *testutil.Harness, sessionID string) supervisor.Status {
+	t.Helper()
+	request, _ := http.NewRequest(http.MethodGet, h.Server.URL+"/api/supervisor", nil)
+	request.Header.Set(client.SessionHeader, sessionID)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", response.StatusCode)
+	}
+	var status supervisor.Status
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	return status
+}
+
+func TestSupervisorEndpoint(t *testing.T) {
+	h := testutil.NewHarness(t)
+
+	response, err := http.Get(h.Server.URL + "/api/supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the supervisor status to require a session, got %d", response.StatusCode)
+	}
+
+	sessionID := handshake(t, h)
+	if status := getSupervisorStatus(t, h, sessionID); status.Name != "app" || status.State != supervisor.StateIdle {
+		t.Errorf("Unexpected status before start: %+v", status)
+	}
+
+	if err := h.Supervisor.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	status := getSupervisorStatus(t, h, sessionID)
+	if status.State != supervisor.StateExited || status.Command != "node dist/index.js" || status.ExitCode == nil || *status.ExitCode != 0 {
+		t.Errorf("Unexpected status after exit: %+v", status)
+	}
+}
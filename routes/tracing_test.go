@@ -0,0 +1,61 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"spi-go-core/client"
+	"spi-go-core/handlers"
+	"spi-go-core/internal/testutil"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestExecIsTracedUnderTheClientsTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	h := testutil.NewHarness(t)
+	sessionID := handshake(t, h)
+
+	body, _ := json.Marshal(handlers.RequestPayload{Command: "pwd"})
+	request, _ := http.NewRequest(http.MethodPost, h.Server.URL+"/api/exec", bytes.NewReader(body))
+	request.Header.Set(client.SessionHeader, sessionID)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", response.StatusCode)
+	}
+
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			names[span.Name()] = true
+		}
+	}
+	for _, name := range []string{"POST /api/exec", "policy.evaluate", "process.spawn", "process.wait"} {
+		if !names[name] {
+			t.Errorf("Expected a %s span in the client's trace, got %v", name, names)
+		}
+	}
+
+	handshakeSpans := 0
+	for _, span := range recorder.Ended() {
+		if span.Name() == "handshake.key_exchange" || span.Name() == "handshake.verify" || span.Name() == "handshake.finalize" {
+			handshakeSpans++
+		}
+	}
+	if handshakeSpans != 3 {
+		t.Errorf("Expected a span per handshake stage, got %d", handshakeSpans)
+	}
+}
@@ -36,20 +36,25 @@ class SPIClient {
         return decrypted.toString('utf8');
     }
 
-    // Send an encrypted command to the Go server
-    public sendCommand(command: string): Promise<string> {
+    // Send an encrypted command to the Go server. A W3C traceparent, e.g. from
+    // the active OpenTelemetry span, makes the server continue that trace.
+    public sendCommand(command: string, traceparent?: string): Promise<string> {
         return new Promise((resolve, reject) => {
             const encryptedCommand = this.encryptCommand(command);
+            const headers: Record<string, string | number> = {
+                'Content-Type': 'application/octet-stream',
+                'Content-Length': encryptedCommand.length,
+            };
+            if (traceparent) {
+                headers['traceparent'] = traceparent;
+            }
 
             const options = {
                 hostname: this.hostname,
                 port: this.port,
                 path: '/api/exec',
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/octet-stream',
-                    'Content-Length': encryptedCommand.length,
-                },
+                headers,
                 rejectUnauthorized: this.rejectUnauthorized, // For self-signed certificates
             };
 